@@ -0,0 +1,291 @@
+package address
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchutil"
+	"github.com/gcash/bchutil/base58"
+)
+
+// Type is the kind of script an address pays to
+type Type byte
+
+const (
+	// TypeP2PKH is a pay-to-pubkey-hash address
+	TypeP2PKH Type = 0
+	// TypeP2SH is a pay-to-script-hash address
+	TypeP2SH Type = 1
+)
+
+const (
+	// MainNetPrefix is the cashaddr prefix of mainnet SLP addresses
+	MainNetPrefix = "simpleledger"
+	// TestNetPrefix is the cashaddr prefix of testnet SLP addresses
+	TestNetPrefix = "slptest"
+	// RegTestPrefix is the cashaddr prefix of regtest SLP addresses
+	RegTestPrefix = "slpreg"
+
+	// hashSize is the length of a hash160
+	hashSize = 20
+)
+
+var (
+	// ErrUnknownPrefix is returned when an address prefix does not belong
+	// to a supported network
+	ErrUnknownPrefix = errors.New("unknown address prefix")
+
+	// ErrUnsupportedType is returned for addresses that are not P2PKH or P2SH
+	ErrUnsupportedType = errors.New("address type must be p2pkh or p2sh")
+
+	// ErrWrongNetwork is returned when an address belongs to a different
+	// network than expected
+	ErrWrongNetwork = errors.New("address is for a different network")
+)
+
+// network ties SLP and cash address prefixes to chain parameters
+type network struct {
+	params    *chaincfg.Params
+	slpPrefix string
+}
+
+var networks = []network{
+	{&chaincfg.MainNetParams, MainNetPrefix},
+	{&chaincfg.TestNet3Params, TestNetPrefix},
+	{&chaincfg.RegressionNetParams, RegTestPrefix},
+}
+
+func networkForParams(params *chaincfg.Params) (*network, error) {
+	for i := range networks {
+		if networks[i].params.Net == params.Net {
+			return &networks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported network %s", params.Name)
+}
+
+// Address is a P2PKH or P2SH address that can be displayed in simpleledger,
+// bitcoincash and legacy form.
+type Address struct {
+	hash [hashSize]byte
+	typ  Type
+	net  *network
+}
+
+// NewAddressPubKeyHash creates a P2PKH address from a hash160
+func NewAddressPubKeyHash(hash []byte, params *chaincfg.Params) (*Address, error) {
+	return newAddress(hash, TypeP2PKH, params)
+}
+
+// NewAddressScriptHash creates a P2SH address from a script hash160
+func NewAddressScriptHash(hash []byte, params *chaincfg.Params) (*Address, error) {
+	return newAddress(hash, TypeP2SH, params)
+}
+
+func newAddress(hash []byte, typ Type, params *chaincfg.Params) (*Address, error) {
+	if len(hash) != hashSize {
+		return nil, errors.New("hash must be 20 bytes")
+	}
+	net, err := networkForParams(params)
+	if err != nil {
+		return nil, err
+	}
+	a := &Address{typ: typ, net: net}
+	copy(a.hash[:], hash)
+	return a, nil
+}
+
+// Decode parses an address in simpleledger, bitcoincash or legacy base58
+// form. Cash addresses without a prefix are assumed to use the simpleledger
+// prefix of params. The decoded address must belong to params.
+func Decode(addr string, params *chaincfg.Params) (*Address, error) {
+	net, err := networkForParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.IndexByte(addr, ':') >= 0 {
+		return decodePrefixed(addr, net)
+	}
+
+	var cashErr error
+	for _, prefix := range []string{net.slpPrefix, net.params.CashAddressPrefix} {
+		if strings.ToUpper(addr) == addr {
+			prefix = strings.ToUpper(prefix)
+		}
+		a, err := decodePrefixed(prefix+":"+addr, net)
+		if err == nil {
+			return a, nil
+		}
+		if cashErr == nil {
+			cashErr = err
+		}
+		if err != ErrChecksumMismatch {
+			break
+		}
+	}
+
+	// fall back to legacy base58 before reporting the cashaddr error
+	a, err := decodeLegacy(addr, net)
+	if err == nil {
+		return a, nil
+	}
+	if cashErr == ErrChecksumMismatch {
+		return nil, cashErr
+	}
+	if err == base58.ErrChecksum {
+		return nil, ErrChecksumMismatch
+	}
+	if err == ErrWrongNetwork || err == ErrUnsupportedType {
+		return nil, err
+	}
+	return nil, fmt.Errorf("invalid address format: %v", cashErr)
+}
+
+func decodePrefixed(addr string, net *network) (*Address, error) {
+	// check the prefix first since a wrong prefix also fails the checksum
+	prefix := strings.ToLower(addr[:strings.LastIndexByte(addr, ':')])
+	if prefix != net.slpPrefix && prefix != net.params.CashAddressPrefix {
+		for _, n := range networks {
+			if prefix == n.slpPrefix || prefix == n.params.CashAddressPrefix {
+				return nil, ErrWrongNetwork
+			}
+		}
+		return nil, ErrUnknownPrefix
+	}
+
+	_, version, hash, err := decodeCashAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// the version byte holds the type in bits 3-6 and the hash size in
+	// bits 0-2, only 160 bit hashes are supported
+	if version&0x80 != 0 || version&0x07 != 0 || len(hash) != hashSize {
+		return nil, errors.New("address hash must be 160 bits")
+	}
+	typ := Type(version >> 3)
+	if typ != TypeP2PKH && typ != TypeP2SH {
+		return nil, ErrUnsupportedType
+	}
+	return newAddress(hash, typ, net.params)
+}
+
+func decodeLegacy(addr string, net *network) (*Address, error) {
+	hash, netID, err := base58.CheckDecode(addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(hash) != hashSize {
+		return nil, errors.New("address hash must be 160 bits")
+	}
+	switch netID {
+	case net.params.LegacyPubKeyHashAddrID:
+		return newAddress(hash, TypeP2PKH, net.params)
+	case net.params.LegacyScriptHashAddrID:
+		return newAddress(hash, TypeP2SH, net.params)
+	}
+	if chaincfg.IsPubKeyHashAddrID(netID) || chaincfg.IsScriptHashAddrID(netID) {
+		return nil, ErrWrongNetwork
+	}
+	return nil, ErrUnsupportedType
+}
+
+// FromBchAddress converts a bchutil address to an Address
+func FromBchAddress(addr bchutil.Address, params *chaincfg.Params) (*Address, error) {
+	if !addr.IsForNet(params) {
+		return nil, ErrWrongNetwork
+	}
+	switch addr.(type) {
+	case *bchutil.AddressPubKeyHash, *bchutil.LegacyAddressPubKeyHash:
+		return NewAddressPubKeyHash(addr.ScriptAddress(), params)
+	case *bchutil.AddressScriptHash, *bchutil.LegacyAddressScriptHash:
+		return NewAddressScriptHash(addr.ScriptAddress(), params)
+	case *bchutil.AddressPubKey:
+		return NewAddressPubKeyHash(bchutil.Hash160(addr.ScriptAddress()), params)
+	}
+	return nil, ErrUnsupportedType
+}
+
+// FromPkScript returns the address paid by a standard P2PKH or P2SH script
+func FromPkScript(pkScript []byte, params *chaincfg.Params) (*Address, error) {
+	if len(pkScript) == 25 && pkScript[0] == 0x76 && pkScript[1] == 0xa9 &&
+		pkScript[2] == 0x14 && pkScript[23] == 0x88 && pkScript[24] == 0xac {
+		return NewAddressPubKeyHash(pkScript[3:23], params)
+	}
+	if len(pkScript) == 23 && pkScript[0] == 0xa9 && pkScript[1] == 0x14 && pkScript[22] == 0x87 {
+		return NewAddressScriptHash(pkScript[2:22], params)
+	}
+	return nil, ErrUnsupportedType
+}
+
+// String returns the simpleledger cashaddr with prefix
+func (a *Address) String() string {
+	return encodeCashAddr(a.net.slpPrefix, byte(a.typ)<<3, a.hash[:])
+}
+
+// CashAddress returns the bitcoincash cashaddr with prefix
+func (a *Address) CashAddress() string {
+	return encodeCashAddr(a.net.params.CashAddressPrefix, byte(a.typ)<<3, a.hash[:])
+}
+
+// Legacy returns the legacy base58 encoding
+func (a *Address) Legacy() string {
+	netID := a.net.params.LegacyPubKeyHashAddrID
+	if a.typ == TypeP2SH {
+		netID = a.net.params.LegacyScriptHashAddrID
+	}
+	return base58.CheckEncode(a.hash[:], netID)
+}
+
+// Type returns whether the address is P2PKH or P2SH
+func (a *Address) Type() Type {
+	return a.typ
+}
+
+// Hash160 returns the hash paid to by the address
+func (a *Address) Hash160() []byte {
+	return append([]byte{}, a.hash[:]...)
+}
+
+// Params returns the network the address belongs to
+func (a *Address) Params() *chaincfg.Params {
+	return a.net.params
+}
+
+// PkScript returns the output script paying to the address
+func (a *Address) PkScript() []byte {
+	if a.typ == TypeP2SH {
+		return bytes.Join([][]byte{{0xa9, 0x14}, a.hash[:], {0x87}}, nil)
+	}
+	return bytes.Join([][]byte{{0x76, 0xa9, 0x14}, a.hash[:], {0x88, 0xac}}, nil)
+}
+
+// BchAddress converts the address to a bchutil cashaddr address
+func (a *Address) BchAddress() (bchutil.Address, error) {
+	if a.typ == TypeP2SH {
+		return bchutil.NewAddressScriptHashFromHash(a.hash[:], a.net.params)
+	}
+	return bchutil.NewAddressPubKeyHash(a.hash[:], a.net.params)
+}
+
+// ToSlpAddress converts a bitcoincash or legacy address to simpleledger form
+func ToSlpAddress(addr string, params *chaincfg.Params) (string, error) {
+	a, err := Decode(addr, params)
+	if err != nil {
+		return "", err
+	}
+	return a.String(), nil
+}
+
+// ToCashAddress converts a simpleledger or legacy address to bitcoincash form
+func ToCashAddress(addr string, params *chaincfg.Params) (string, error) {
+	a, err := Decode(addr, params)
+	if err != nil {
+		return "", err
+	}
+	return a.CashAddress(), nil
+}
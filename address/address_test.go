@@ -0,0 +1,157 @@
+package address
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchutil"
+)
+
+// test vectors are from the cashaddr specification:
+// https://github.com/bitcoincashorg/bitcoincash.org/blob/master/spec/cashaddr.md
+const (
+	testLegacy   = "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu"
+	testCashAddr = "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a"
+	testHash     = "76a04053bda0a88bda5177b86a15c3b29f559873"
+)
+
+func TestDecodeFormats(t *testing.T) {
+	hash, _ := hex.DecodeString(testHash)
+	for _, s := range []string{testLegacy, testCashAddr, strings.ToUpper(testCashAddr), "qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a"} {
+		a, err := Decode(s, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if !bytes.Equal(a.Hash160(), hash) || a.Type() != TypeP2PKH {
+			t.Errorf("%s: decoded incorrect hash or type", s)
+		}
+		if a.Legacy() != testLegacy || a.CashAddress() != testCashAddr {
+			t.Errorf("%s: incorrect conversion", s)
+		}
+	}
+}
+
+func TestSlpAddressRoundTrip(t *testing.T) {
+	tests := []struct {
+		params *chaincfg.Params
+		prefix string
+	}{
+		{&chaincfg.MainNetParams, "simpleledger:"},
+		{&chaincfg.TestNet3Params, "slptest:"},
+		{&chaincfg.RegressionNetParams, "slpreg:"},
+	}
+	hash, _ := hex.DecodeString(testHash)
+	for _, test := range tests {
+		for _, newFn := range []func([]byte, *chaincfg.Params) (*Address, error){NewAddressPubKeyHash, NewAddressScriptHash} {
+			a, err := newFn(hash, test.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slpAddr := a.String()
+			if !strings.HasPrefix(slpAddr, test.prefix) {
+				t.Fatalf("unexpected prefix %s", slpAddr)
+			}
+
+			decoded, err := Decode(slpAddr, test.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.String() != slpAddr || decoded.Type() != a.Type() {
+				t.Errorf("%s did not round trip", slpAddr)
+			}
+
+			// the payload without prefix decodes to the same address
+			decoded, err = Decode(strings.TrimPrefix(slpAddr, test.prefix), test.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.String() != slpAddr {
+				t.Errorf("%s did not round trip without prefix", slpAddr)
+			}
+
+			bchAddr, err := a.BchAddress()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.params.CashAddressPrefix+":"+bchAddr.EncodeAddress() != a.CashAddress() {
+				t.Errorf("cash address %s does not match bchutil", a.CashAddress())
+			}
+			fromBch, err := FromBchAddress(bchAddr, test.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fromBch.String() != slpAddr {
+				t.Errorf("%s did not round trip through bchutil", slpAddr)
+			}
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	a, err := Decode(testCashAddr, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slpAddr := a.String()
+
+	tests := []struct {
+		addr   string
+		params *chaincfg.Params
+		err    error
+	}{
+		{slpAddr[:len(slpAddr)-1] + "q", &chaincfg.MainNetParams, ErrChecksumMismatch},
+		{"1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggv", &chaincfg.MainNetParams, ErrChecksumMismatch},
+		{slpAddr, &chaincfg.TestNet3Params, ErrWrongNetwork},
+		{"simpleledger:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6A", &chaincfg.MainNetParams, ErrMixedCase},
+		{"simpleledger:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6b", &chaincfg.MainNetParams, ErrInvalidCharacter},
+		{"bitcoin:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", &chaincfg.MainNetParams, ErrUnknownPrefix},
+	}
+	for _, test := range tests {
+		if _, err := Decode(test.addr, test.params); err != test.err {
+			t.Errorf("%s: expected %v, got %v", test.addr, test.err, err)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	slpAddr, err := ToSlpAddress(testLegacy, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cashAddr, err := ToCashAddress(slpAddr, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cashAddr != testCashAddr {
+		t.Errorf("expected %s, got %s", testCashAddr, cashAddr)
+	}
+}
+
+func TestPkScript(t *testing.T) {
+	a, err := Decode(testCashAddr, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := FromPkScript(a.PkScript(), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != a.String() {
+		t.Error("pkScript did not round trip")
+	}
+
+	bchAddr, err := bchutil.DecodeAddress(testCashAddr, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bchAddr.ScriptAddress(), a.Hash160()) {
+		t.Error("hash does not match bchutil")
+	}
+
+	if _, err := FromPkScript([]byte{0x6a}, &chaincfg.MainNetParams); err != ErrUnsupportedType {
+		t.Errorf("expected ErrUnsupportedType, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package address
+
+import (
+	"errors"
+	"strings"
+)
+
+// charset is the base32 alphabet used by cashaddr
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var (
+	// ErrChecksumMismatch is returned when an address checksum is invalid
+	ErrChecksumMismatch = errors.New("address checksum mismatch")
+
+	// ErrMixedCase is returned when a cashaddr mixes upper and lower case
+	ErrMixedCase = errors.New("address must not mix upper and lower case")
+
+	// ErrInvalidCharacter is returned when a cashaddr contains a character
+	// outside the base32 alphabet
+	ErrInvalidCharacter = errors.New("address contains an invalid character")
+)
+
+// polyMod computes the cashaddr BCH code checksum of v
+func polyMod(v []byte) uint64 {
+	c := uint64(1)
+	for _, d := range v {
+		c0 := byte(c >> 35)
+		c = ((c & 0x07ffffffff) << 5) ^ uint64(d)
+		if c0&0x01 != 0 {
+			c ^= 0x98f2bc8e61
+		}
+		if c0&0x02 != 0 {
+			c ^= 0x79b76d99e2
+		}
+		if c0&0x04 != 0 {
+			c ^= 0xf33e5fb3c4
+		}
+		if c0&0x08 != 0 {
+			c ^= 0xae2eabe2a8
+		}
+		if c0&0x10 != 0 {
+			c ^= 0x1e4f43e470
+		}
+	}
+	return c ^ 1
+}
+
+// expandPrefix returns the lower 5 bits of each prefix character followed
+// by the zero separator
+func expandPrefix(prefix string) []byte {
+	ret := make([]byte, len(prefix)+1)
+	for i := 0; i < len(prefix); i++ {
+		ret[i] = prefix[i] & 0x1f
+	}
+	return ret
+}
+
+func createChecksum(prefix string, payload []byte) []byte {
+	enc := append(expandPrefix(prefix), payload...)
+	enc = append(enc, make([]byte, 8)...)
+	mod := polyMod(enc)
+	ret := make([]byte, 8)
+	for i := 0; i < 8; i++ {
+		ret[i] = byte((mod >> uint(5*(7-i))) & 0x1f)
+	}
+	return ret
+}
+
+func verifyChecksum(prefix string, payload []byte) bool {
+	return polyMod(append(expandPrefix(prefix), payload...)) == 0
+}
+
+// convertBits regroups data from fromBits to toBits per element
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	maxv := uint(1<<toBits) - 1
+	ret := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, v := range data {
+		if uint(v)>>fromBits != 0 {
+			return nil, errors.New("invalid data range")
+		}
+		acc = acc<<fromBits | uint(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			ret = append(ret, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			ret = append(ret, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return ret, nil
+}
+
+// encodeCashAddr encodes a version byte and hash with prefix
+func encodeCashAddr(prefix string, version byte, hash []byte) string {
+	payload, _ := convertBits(append([]byte{version}, hash...), 8, 5, true)
+	payload = append(payload, createChecksum(prefix, payload)...)
+
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	sb.WriteByte(':')
+	for _, b := range payload {
+		sb.WriteByte(charset[b])
+	}
+	return sb.String()
+}
+
+// decodeCashAddr decodes a prefixed cashaddr, returning the lower case
+// prefix, version byte and hash
+func decodeCashAddr(addr string) (string, byte, []byte, error) {
+	lower := strings.ToLower(addr)
+	if lower != addr && strings.ToUpper(addr) != addr {
+		return "", 0, nil, ErrMixedCase
+	}
+
+	sep := strings.LastIndexByte(lower, ':')
+	if sep < 1 {
+		return "", 0, nil, errors.New("address is missing a prefix")
+	}
+	prefix, data := lower[:sep], lower[sep+1:]
+	if len(data) < 8 {
+		return "", 0, nil, errors.New("address is too short")
+	}
+
+	payload := make([]byte, len(data))
+	for i := 0; i < len(data); i++ {
+		idx := strings.IndexByte(charset, data[i])
+		if idx < 0 {
+			return "", 0, nil, ErrInvalidCharacter
+		}
+		payload[i] = byte(idx)
+	}
+	if !verifyChecksum(prefix, payload) {
+		return "", 0, nil, ErrChecksumMismatch
+	}
+
+	decoded, err := convertBits(payload[:len(payload)-8], 5, 8, false)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if len(decoded) == 0 {
+		return "", 0, nil, errors.New("address payload is empty")
+	}
+	return prefix, decoded[0], decoded[1:], nil
+}
@@ -0,0 +1,260 @@
+package airdrop
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Method is the rule used to compute each holder's allocation
+type Method int
+
+const (
+	// MethodProRata distributes Rule.Total proportionally to holder balances
+	MethodProRata Method = iota
+	// MethodFlat gives every eligible holder Rule.Amount
+	MethodFlat
+	// MethodTiered gives each holder the amount of the highest tier reached
+	MethodTiered
+)
+
+// ResidualMode controls what happens to tokens left over after rounding
+// a pro-rata distribution down
+type ResidualMode int
+
+const (
+	// ResidualKeep leaves the residual undistributed
+	ResidualKeep ResidualMode = iota
+	// ResidualLargestRemainder hands out the residual one unit at a time to
+	// the holders with the largest rounding remainders
+	ResidualLargestRemainder
+	// ResidualLargestHolder gives the residual to the largest holder
+	ResidualLargestHolder
+)
+
+// Tier is the allocation given to holders with at least MinBalance
+type Tier struct {
+	MinBalance uint64
+	Amount     uint64
+}
+
+// Rule describes how an airdrop is computed from a holder snapshot. All
+// amounts are in the airdropped token's base units.
+type Rule struct {
+	Method   Method
+	Total    uint64
+	Amount   uint64
+	Tiers    []Tier
+	Residual ResidualMode
+
+	// MinBalance excludes holders with a snapshot balance below it
+	MinBalance uint64
+
+	// TruncateDecimals is the number of least significant decimal places
+	// dropped from every allocation, it must not exceed the token decimals
+	TruncateDecimals int
+}
+
+// Allocation is the amount given to a single holder
+type Allocation struct {
+	Address         string
+	SnapshotBalance uint64
+	Amount          uint64
+}
+
+// Result is the computed airdrop
+type Result struct {
+	Allocations []*Allocation
+	Total       uint64
+	Residual    uint64
+}
+
+// Amounts returns the allocation amounts in the same order as Allocations,
+// suitable for metadatamaker.CreateOpReturnSend in batches of up to 19.
+func (r *Result) Amounts() []uint64 {
+	amounts := make([]uint64, len(r.Allocations))
+	for i, a := range r.Allocations {
+		amounts[i] = a.Amount
+	}
+	return amounts
+}
+
+// Plan computes the allocations for a snapshot of holder balances. Results
+// are ordered by address so the same input always yields the same output.
+func Plan(snapshot map[string]uint64, rule *Rule, decimals int) (*Result, error) {
+	if decimals < 0 || decimals > 9 {
+		return nil, errors.New("decimals out of range")
+	}
+	if rule.TruncateDecimals < 0 || rule.TruncateDecimals > decimals {
+		return nil, errors.New("truncateDecimals must be between 0 and the token decimals")
+	}
+	unit := uint64(1)
+	for i := 0; i < rule.TruncateDecimals; i++ {
+		unit *= 10
+	}
+
+	holders := make([]*Allocation, 0, len(snapshot))
+	for addr, bal := range snapshot {
+		if bal == 0 || bal < rule.MinBalance {
+			continue
+		}
+		holders = append(holders, &Allocation{Address: addr, SnapshotBalance: bal})
+	}
+	sort.Slice(holders, func(i, j int) bool {
+		return holders[i].Address < holders[j].Address
+	})
+
+	res := &Result{}
+	switch rule.Method {
+	case MethodProRata:
+		if err := planProRata(holders, rule, unit, res); err != nil {
+			return nil, err
+		}
+	case MethodFlat:
+		for _, h := range holders {
+			h.Amount = rule.Amount / unit * unit
+		}
+	case MethodTiered:
+		if err := planTiered(holders, rule.Tiers, unit); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown airdrop method %d", rule.Method)
+	}
+
+	for _, h := range holders {
+		if h.Amount == 0 {
+			continue
+		}
+		if res.Total+h.Amount < res.Total {
+			return nil, errors.New("airdrop total overflows uint64")
+		}
+		res.Total += h.Amount
+		res.Allocations = append(res.Allocations, h)
+	}
+	return res, nil
+}
+
+func planProRata(holders []*Allocation, rule *Rule, unit uint64, res *Result) error {
+	if rule.Total == 0 {
+		return errors.New("pro-rata airdrop requires a total")
+	}
+	if len(holders) == 0 {
+		res.Residual = rule.Total
+		return nil
+	}
+
+	sum := new(big.Int)
+	for _, h := range holders {
+		sum.Add(sum, new(big.Int).SetUint64(h.SnapshotBalance))
+	}
+
+	units := rule.Total / unit
+	remainders := make([]*big.Int, len(holders))
+	var distributed uint64
+	for i, h := range holders {
+		share := new(big.Int).Mul(new(big.Int).SetUint64(units), new(big.Int).SetUint64(h.SnapshotBalance))
+		q, r := new(big.Int).QuoRem(share, sum, new(big.Int))
+		h.Amount = q.Uint64() * unit
+		remainders[i] = r
+		distributed += h.Amount
+	}
+
+	leftover := (rule.Total - distributed) / unit
+	switch rule.Residual {
+	case ResidualKeep:
+	case ResidualLargestRemainder:
+		order := make([]int, len(holders))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			ra, rb := remainders[order[a]], remainders[order[b]]
+			if c := ra.Cmp(rb); c != 0 {
+				return c > 0
+			}
+			return holders[order[a]].SnapshotBalance > holders[order[b]].SnapshotBalance
+		})
+		for i := 0; uint64(i) < leftover && i < len(order); i++ {
+			holders[order[i]].Amount += unit
+			distributed += unit
+		}
+	case ResidualLargestHolder:
+		largest := holders[0]
+		for _, h := range holders[1:] {
+			if h.SnapshotBalance > largest.SnapshotBalance {
+				largest = h
+			}
+		}
+		largest.Amount += leftover * unit
+		distributed += leftover * unit
+	default:
+		return fmt.Errorf("unknown residual mode %d", rule.Residual)
+	}
+
+	res.Residual = rule.Total - distributed
+	return nil
+}
+
+func planTiered(holders []*Allocation, tiers []Tier, unit uint64) error {
+	if len(tiers) == 0 {
+		return errors.New("tiered airdrop requires at least one tier")
+	}
+	sorted := append([]Tier{}, tiers...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].MinBalance > sorted[j].MinBalance
+	})
+	for _, h := range holders {
+		for _, t := range sorted {
+			if h.SnapshotBalance >= t.MinBalance {
+				h.Amount = t.Amount / unit * unit
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// ParseAmount converts a decimal string such as "1.25" to base units for a
+// token with the given decimals.
+func ParseAmount(s string, decimals int) (uint64, error) {
+	if decimals < 0 || decimals > 9 {
+		return 0, errors.New("decimals out of range")
+	}
+	parts := strings.SplitN(s, ".", 2)
+	if parts[0] == "" {
+		parts[0] = "0"
+	}
+	frac := ""
+	if len(parts) == 2 {
+		frac = parts[1]
+	}
+	if len(frac) > decimals {
+		return 0, fmt.Errorf("amount %q has more than %d decimal places", s, decimals)
+	}
+	frac += strings.Repeat("0", decimals-len(frac))
+
+	v, ok := new(big.Int).SetString(parts[0]+frac, 10)
+	if !ok || v.Sign() < 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if !v.IsUint64() {
+		return 0, fmt.Errorf("amount %q overflows uint64", s)
+	}
+	return v.Uint64(), nil
+}
+
+// FormatAmount converts base units to a decimal string for a token with the
+// given decimals.
+func FormatAmount(amount uint64, decimals int) string {
+	s := new(big.Int).SetUint64(amount).String()
+	if decimals <= 0 {
+		return s
+	}
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	return s[:len(s)-decimals] + "." + s[len(s)-decimals:]
+}
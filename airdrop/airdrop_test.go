@@ -0,0 +1,132 @@
+package airdrop
+
+import (
+	"testing"
+)
+
+var testSnapshot = map[string]uint64{
+	"simpleledger:a": 100,
+	"simpleledger:b": 100,
+	"simpleledger:c": 100,
+	"simpleledger:d": 5,
+}
+
+func TestPlanProRataKeepResidual(t *testing.T) {
+	res, err := Plan(testSnapshot, &Rule{Method: MethodProRata, Total: 1000, MinBalance: 10}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Allocations) != 3 {
+		t.Fatalf("expected 3 allocations, got %d", len(res.Allocations))
+	}
+	for _, a := range res.Allocations {
+		if a.Amount != 333 {
+			t.Errorf("%s: expected 333, got %d", a.Address, a.Amount)
+		}
+	}
+	if res.Total != 999 || res.Residual != 1 {
+		t.Errorf("unexpected total %d residual %d", res.Total, res.Residual)
+	}
+}
+
+func TestPlanProRataLargestRemainder(t *testing.T) {
+	res, err := Plan(testSnapshot, &Rule{
+		Method:   MethodProRata,
+		Total:    1000,
+		Residual: ResidualLargestRemainder,
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1000 || res.Residual != 0 {
+		t.Errorf("unexpected total %d residual %d", res.Total, res.Residual)
+	}
+
+	// the three larger remainders each receive one of the residual units
+	for i, want := range []uint64{328, 328, 328, 16} {
+		if res.Allocations[i].Amount != want {
+			t.Errorf("allocation %d: expected %d, got %d", i, want, res.Allocations[i].Amount)
+		}
+	}
+}
+
+func TestPlanProRataTruncate(t *testing.T) {
+	res, err := Plan(map[string]uint64{"a": 1, "b": 2}, &Rule{
+		Method:           MethodProRata,
+		Total:            1000,
+		TruncateDecimals: 2,
+		Residual:         ResidualLargestHolder,
+	}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allocations[0].Amount != 300 || res.Allocations[1].Amount != 700 {
+		t.Errorf("unexpected allocations %d, %d", res.Allocations[0].Amount, res.Allocations[1].Amount)
+	}
+}
+
+func TestPlanTiered(t *testing.T) {
+	res, err := Plan(testSnapshot, &Rule{
+		Method: MethodTiered,
+		Tiers:  []Tier{{MinBalance: 1, Amount: 10}, {MinBalance: 50, Amount: 50}},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 160 {
+		t.Errorf("expected total 160, got %d", res.Total)
+	}
+}
+
+func TestPlanFlat(t *testing.T) {
+	res, err := Plan(testSnapshot, &Rule{Method: MethodFlat, Amount: 7, MinBalance: 6}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	amounts := res.Amounts()
+	if len(amounts) != 3 || res.Total != 21 {
+		t.Errorf("unexpected amounts %v", amounts)
+	}
+}
+
+func TestPlanBadTruncate(t *testing.T) {
+	_, err := Plan(testSnapshot, &Rule{Method: MethodFlat, Amount: 7, TruncateDecimals: 3}, 2)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParseFormatAmount(t *testing.T) {
+	tests := []struct {
+		s        string
+		decimals int
+		amount   uint64
+	}{
+		{"1.25", 2, 125},
+		{"0.000000001", 9, 1},
+		{"42", 0, 42},
+		{".5", 1, 5},
+	}
+	for _, test := range tests {
+		amt, err := ParseAmount(test.s, test.decimals)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if amt != test.amount {
+			t.Errorf("%s: expected %d, got %d", test.s, test.amount, amt)
+		}
+	}
+
+	if _, err := ParseAmount("1.234", 2); err == nil {
+		t.Error("expected too many decimal places error")
+	}
+	if _, err := ParseAmount("-1", 2); err == nil {
+		t.Error("expected negative amount error")
+	}
+	if s := FormatAmount(5, 3); s != "0.005" {
+		t.Errorf("unexpected format %s", s)
+	}
+	if s := FormatAmount(12345, 2); s != "123.45" {
+		t.Errorf("unexpected format %s", s)
+	}
+}
@@ -0,0 +1,310 @@
+package blockfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/gcash/bchd/blockchain"
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+var (
+	// ErrNoGenesis is returned when the block files do not contain the
+	// genesis block of the network
+	ErrNoGenesis = errors.New("block files do not contain the genesis block")
+
+	// ErrBadMagic is returned when a record does not start with the network
+	// magic
+	ErrBadMagic = errors.New("unexpected network magic")
+)
+
+// diskMagics holds the bytes nodes write before every block in their block
+// files by network. They are the legacy network magic, which differs from
+// the message magic bchd uses on the wire.
+var diskMagics = map[wire.BitcoinNet][4]byte{
+	wire.MainNet:  {0xf9, 0xbe, 0xb4, 0xd9},
+	wire.TestNet3: {0x0b, 0x11, 0x09, 0x07},
+	wire.TestNet:  {0xfa, 0xbf, 0xb5, 0xda},
+}
+
+// diskMagic returns the magic preceding every block in the block files of
+// the network of params, the wire magic for networks without a legacy one
+func diskMagic(params *chaincfg.Params) [4]byte {
+	if magic, ok := diskMagics[params.Net]; ok {
+		return magic
+	}
+	var magic [4]byte
+	binary.LittleEndian.PutUint32(magic[:], uint32(params.Net))
+	return magic
+}
+
+// recordHeaderSize is the magic and the block size preceding each block
+const recordHeaderSize = 8
+
+// BlockFunc is called for every block of the best chain in height order,
+// returning an error stops the scan
+type BlockFunc func(block *wire.MsgBlock, height int32) error
+
+// SlpTx is an SLP transaction found in a block
+type SlpTx struct {
+	Tx        *wire.MsgTx
+	SlpMsg    v1parser.ParseResult
+	BlockHash chainhash.Hash
+	Height    int32
+}
+
+// SlpTxFunc is called for every parsable SLP transaction of the best chain,
+// returning an error stops the scan
+type SlpTxFunc func(tx *SlpTx) error
+
+// blockLoc is where a block was found and its place in the block tree
+type blockLoc struct {
+	file   string
+	offset int64
+	size   uint32
+	header wire.BlockHeader
+	hash   chainhash.Hash
+
+	height int32
+	work   *big.Int
+}
+
+// Scanner reads blocks from bitcoind style blk*.dat files. Blocks are
+// stored in the order they were downloaded, so the best chain is rebuilt
+// from the headers before blocks are returned in height order.
+type Scanner struct {
+	dir    string
+	params *chaincfg.Params
+	magic  [4]byte
+	chain  []*blockLoc
+}
+
+// NewScanner creates a Scanner for the blk*.dat files in dir
+func NewScanner(dir string, params *chaincfg.Params) *Scanner {
+	return &Scanner{dir: dir, params: params, magic: diskMagic(params)}
+}
+
+// Index reads the header of every block and selects the chain with the
+// most work. It is called by the scan methods when needed and only has to
+// be called directly to inspect the chain first.
+func (s *Scanner) Index() error {
+	files, err := filepath.Glob(filepath.Join(s.dir, "blk*.dat"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	blocks := make(map[chainhash.Hash]*blockLoc)
+	children := make(map[chainhash.Hash][]*blockLoc)
+	for _, file := range files {
+		if err := s.indexFile(file, blocks, children); err != nil {
+			return err
+		}
+	}
+
+	genesis, ok := blocks[*s.params.GenesisHash]
+	if !ok {
+		return ErrNoGenesis
+	}
+
+	// walk the tree from the genesis block, blocks that do not connect to
+	// it are ignored
+	genesis.work = blockchain.CalcWork(genesis.header.Bits)
+	best := genesis
+	queue := []*blockLoc{genesis}
+	for len(queue) > 0 {
+		b := queue[0]
+		queue = queue[1:]
+		if b.work.Cmp(best.work) > 0 {
+			best = b
+		}
+		for _, child := range children[b.hash] {
+			child.height = b.height + 1
+			child.work = new(big.Int).Add(b.work, blockchain.CalcWork(child.header.Bits))
+			queue = append(queue, child)
+		}
+	}
+
+	s.chain = make([]*blockLoc, best.height+1)
+	for b := best; ; b = blocks[b.header.PrevBlock] {
+		s.chain[b.height] = b
+		if b.height == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// indexFile records the location and header of every block in file
+func (s *Scanner) indexFile(file string, blocks map[chainhash.Hash]*blockLoc, children map[chainhash.Hash][]*blockLoc) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	var rec [recordHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(r, rec[:]); err != nil {
+			// a partial record is left behind when a node stops mid write
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		if binary.LittleEndian.Uint32(rec[:4]) == 0 {
+			// the rest of the file is preallocated space
+			return nil
+		}
+		if !bytes.Equal(rec[:4], s.magic[:]) {
+			return fmt.Errorf("%s at offset %d: %w", file, offset, ErrBadMagic)
+		}
+		size := binary.LittleEndian.Uint32(rec[4:])
+		if size < wire.MaxBlockHeaderPayload {
+			return fmt.Errorf("%s at offset %d: block size %d is too small", file, offset, size)
+		}
+		offset += recordHeaderSize
+
+		b := &blockLoc{file: file, offset: offset, size: size}
+		if err := b.header.Deserialize(r); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		if _, err := r.Discard(int(size) - wire.MaxBlockHeaderPayload); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		offset += int64(size)
+
+		b.hash = b.header.BlockHash()
+		if _, ok := blocks[b.hash]; ok {
+			continue
+		}
+		blocks[b.hash] = b
+		children[b.header.PrevBlock] = append(children[b.header.PrevBlock], b)
+	}
+}
+
+// BestHeight returns the height of the best chain, or -1 when the files
+// have not been indexed
+func (s *Scanner) BestHeight() int32 {
+	return int32(len(s.chain)) - 1
+}
+
+// BlockHash returns the hash of the best chain block at height
+func (s *Scanner) BlockHash(height int32) (chainhash.Hash, bool) {
+	if height < 0 || int(height) >= len(s.chain) {
+		return chainhash.Hash{}, false
+	}
+	return s.chain[height].hash, true
+}
+
+// Scan calls fn for every best chain block from fromHeight to the tip
+func (s *Scanner) Scan(fromHeight int32, fn BlockFunc) error {
+	if s.chain == nil {
+		if err := s.Index(); err != nil {
+			return err
+		}
+	}
+	if fromHeight < 0 {
+		fromHeight = 0
+	}
+
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	for height := fromHeight; int(height) < len(s.chain); height++ {
+		loc := s.chain[height]
+		if f == nil || f.Name() != loc.file {
+			if f != nil {
+				f.Close()
+			}
+			var err error
+			if f, err = os.Open(loc.file); err != nil {
+				return err
+			}
+		}
+
+		block := new(wire.MsgBlock)
+		r := bufio.NewReader(io.NewSectionReader(f, loc.offset, int64(loc.size)))
+		if err := block.Deserialize(r); err != nil {
+			return fmt.Errorf("block %s: %v", loc.hash, err)
+		}
+		if err := fn(block, height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScanSlp calls fn for every transaction with a parsable SLP message from
+// fromHeight to the tip. Transactions are checked for the lokad prefix
+// before being parsed.
+func (s *Scanner) ScanSlp(fromHeight int32, fn SlpTxFunc) error {
+	return s.Scan(fromHeight, func(block *wire.MsgBlock, height int32) error {
+		hash := block.BlockHash()
+		for _, tx := range block.Transactions {
+			if len(tx.TxOut) == 0 || !goslp.HasSlpLokadPrefix(tx.TxOut[0].PkScript) {
+				continue
+			}
+			slpMsg, err := v1parser.ParseSLP(tx.TxOut[0].PkScript)
+			if err != nil {
+				continue
+			}
+			err = fn(&SlpTx{Tx: tx, SlpMsg: slpMsg, BlockHash: hash, Height: height})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// errStopped ends a scan feeding a channel whose reader has gone away
+var errStopped = errors.New("scan stopped")
+
+// SlpTxs runs ScanSlp in a goroutine, sending each transaction on the
+// returned channel. The channel is closed when the scan ends, after which
+// the error channel yields the scan error, if any. Closing done stops the
+// scan early.
+func (s *Scanner) SlpTxs(fromHeight int32, done <-chan struct{}) (<-chan *SlpTx, <-chan error) {
+	txs := make(chan *SlpTx)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(txs)
+		err := s.ScanSlp(fromHeight, func(tx *SlpTx) error {
+			select {
+			case txs <- tx:
+				return nil
+			case <-done:
+				return errStopped
+			}
+		})
+		if err != nil && err != errStopped {
+			errc <- err
+		}
+	}()
+	return txs, errc
+}
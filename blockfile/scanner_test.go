@@ -0,0 +1,179 @@
+package blockfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+)
+
+var testParams = &chaincfg.RegressionNetParams
+
+// regtestBlkPrefix is the start of the blk00000.dat of a fresh regtest
+// node, the disk magic and size of the genesis block followed by the block
+const regtestBlkPrefix = "fabfb5da1d010000" +
+	"0100000000000000000000000000000000000000000000000000000000000000" +
+	"000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa" +
+	"4b1e5e4adae5494dffff7f200200000001010000000100000000000000000000" +
+	"00000000000000000000000000000000000000000000ffffffff4d04ffff001d" +
+	"0104455468652054696d65732030332f4a616e2f32303039204368616e63656c" +
+	"6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f75742066" +
+	"6f722062616e6b73ffffffff0100f2052a01000000434104678afdb0fe554827" +
+	"1967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4" +
+	"f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+
+// regtestMagic is the disk magic of regtest block files
+var regtestMagic = []byte{0xfa, 0xbf, 0xb5, 0xda}
+
+func testBlock(prev *wire.MsgBlock, nonce uint32, txs ...*wire.MsgTx) *wire.MsgBlock {
+	prevHash := prev.BlockHash()
+	block := wire.NewMsgBlock(wire.NewBlockHeader(1, &prevHash, &prevHash, prev.Header.Bits, nonce))
+	for _, tx := range txs {
+		block.AddTransaction(tx)
+	}
+	return block
+}
+
+func testTx(pkScript []byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil))
+	tx.AddTxOut(wire.NewTxOut(0, pkScript))
+	return tx
+}
+
+// writeBlocks writes blocks as blk file records to buf
+func writeBlocks(t *testing.T, buf *bytes.Buffer, blocks ...*wire.MsgBlock) {
+	for _, block := range blocks {
+		var b bytes.Buffer
+		if err := block.Serialize(&b); err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(regtestMagic)
+		binary.Write(buf, binary.LittleEndian, uint32(b.Len()))
+		buf.Write(b.Bytes())
+	}
+}
+
+func testFiles(t *testing.T) (string, []*wire.MsgBlock) {
+	dir, err := ioutil.TempDir("", "blockfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slpMsg, err := metadatamaker.TokenType1Genesis([]byte("T"), []byte("test"), nil, nil, 0, nil, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := testParams.GenesisBlock
+	a1 := testBlock(genesis, 1, testTx([]byte{0x51}))
+	a2 := testBlock(a1, 2, testTx(slpMsg), testTx([]byte{0x6a, 0x04, 'S', 'L', 'P', 0x00, 0x01}))
+	a3 := testBlock(a2, 3, testTx([]byte{0x6a, 0x01, 0x02}))
+	stale := testBlock(genesis, 4, testTx(slpMsg))
+
+	// blocks are written out of order with a stale block in between, the
+	// first file ends with a partial record and the second with padding
+	prefix, err := hex.DecodeString(regtestBlkPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f0, f1 bytes.Buffer
+	f0.Write(prefix)
+	writeBlocks(t, &f0, a2, stale)
+	f0.Write([]byte{0xfa, 0xbf, 0xb5, 0xda, 0xff})
+	writeBlocks(t, &f1, a3, a1)
+	f1.Write(make([]byte, 64))
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "blk00000.dat"), f0.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "blk00001.dat"), f1.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return dir, []*wire.MsgBlock{genesis, a1, a2, a3}
+}
+
+func TestScanBestChain(t *testing.T) {
+	dir, chain := testFiles(t)
+	defer os.RemoveAll(dir)
+
+	s := NewScanner(dir, testParams)
+	if err := s.Index(); err != nil {
+		t.Fatal(err)
+	}
+	if s.BestHeight() != 3 {
+		t.Fatalf("expected best height 3, got %d", s.BestHeight())
+	}
+
+	var heights []int32
+	err := s.Scan(0, func(block *wire.MsgBlock, height int32) error {
+		if block.BlockHash() != chain[height].BlockHash() {
+			t.Errorf("unexpected block at height %d", height)
+		}
+		heights = append(heights, height)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) != 4 {
+		t.Errorf("expected 4 blocks, got %v", heights)
+	}
+
+	stop := errors.New("stop")
+	var n int
+	err = s.Scan(2, func(block *wire.MsgBlock, height int32) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("expected scan to stop after one block, got %v after %d", err, n)
+	}
+}
+
+func TestScanSlp(t *testing.T) {
+	dir, chain := testFiles(t)
+	defer os.RemoveAll(dir)
+
+	txs, errc := NewScanner(dir, testParams).SlpTxs(0, nil)
+	var found []*SlpTx
+	for tx := range txs {
+		found = append(found, tx)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	// the stale block and the malformed SLP message are skipped
+	if len(found) != 1 {
+		t.Fatalf("expected 1 slp tx, got %d", len(found))
+	}
+	if found[0].Height != 2 || found[0].BlockHash != chain[2].BlockHash() {
+		t.Errorf("unexpected slp tx location %d %s", found[0].Height, found[0].BlockHash)
+	}
+
+	done := make(chan struct{})
+	close(done)
+	txs, errc = NewScanner(dir, testParams).SlpTxs(0, done)
+	for range txs {
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("expected stopped scan without error, got %v", err)
+	}
+}
+
+func TestScanBadMagic(t *testing.T) {
+	dir, _ := testFiles(t)
+	defer os.RemoveAll(dir)
+
+	if err := NewScanner(dir, &chaincfg.MainNetParams).Index(); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("expected ErrBadMagic, got %v", err)
+	}
+}
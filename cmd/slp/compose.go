@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/address"
+	"github.com/simpleledgerinc/goslp/airdrop"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+	"github.com/simpleledgerinc/goslp/txbuilder"
+	"github.com/simpleledgerinc/goslp/v1parser"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func init() {
+	for _, kind := range []string{"genesis", "mint", "send"} {
+		kind := kind
+		commands = append(commands, &command{
+			name:  kind,
+			short: "compose a " + strings.ToUpper(kind) + " OP_RETURN script",
+			run: func(args []string, stdin io.Reader, stdout io.Writer) error {
+				return runCompose(kind, args, stdin, stdout)
+			},
+		})
+	}
+}
+
+// specAmount is a token amount in display units, specs may give it as a
+// number or a string
+type specAmount string
+
+// UnmarshalJSON accepts a JSON number or string
+func (a *specAmount) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = specAmount(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("amount must be a number or string: %s", b)
+	}
+	*a = specAmount(n)
+	return nil
+}
+
+// specRecipient is one SEND output
+type specRecipient struct {
+	Address string     `json:"address" yaml:"address"`
+	Amount  specAmount `json:"amount" yaml:"amount"`
+}
+
+// composeSpec describes the message to compose, read from a JSON or YAML
+// file and overridden by flags
+type composeSpec struct {
+	TokenType int    `json:"tokenType" yaml:"tokenType"`
+	TokenID   string `json:"tokenId" yaml:"tokenId"`
+
+	Ticker       string `json:"ticker" yaml:"ticker"`
+	Name         string `json:"name" yaml:"name"`
+	DocumentURI  string `json:"documentUri" yaml:"documentUri"`
+	DocumentFile string `json:"documentFile" yaml:"documentFile"`
+	DocumentHash string `json:"documentHash" yaml:"documentHash"`
+
+	// Decimals is declared by a GENESIS, MINT and SEND amounts are parsed
+	// with it
+	Decimals   int             `json:"decimals" yaml:"decimals"`
+	BatonVout  int             `json:"batonVout" yaml:"batonVout"`
+	Quantity   specAmount      `json:"quantity" yaml:"quantity"`
+	Recipients []specRecipient `json:"recipients" yaml:"recipients"`
+
+	// Receiver and BatonReceiver are the addresses paid by a GENESIS or
+	// MINT template, Inputs are the outpoints it spends
+	Receiver      string   `json:"receiver" yaml:"receiver"`
+	BatonReceiver string   `json:"batonReceiver" yaml:"batonReceiver"`
+	Inputs        []string `json:"inputs" yaml:"inputs"`
+}
+
+// loadSpec reads a spec from path, decoding JSON for .json files and YAML
+// otherwise. A path of - reads YAML from stdin. Relative document files are
+// resolved against the directory of the spec.
+func loadSpec(path string, stdin io.Reader) (*composeSpec, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = ioutil.ReadAll(stdin)
+	} else {
+		b, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &composeSpec{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(spec)
+	} else {
+		err = yaml.UnmarshalStrict(b, spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec %s: %v", path, err)
+	}
+	if spec.DocumentFile != "" && path != "-" && !filepath.IsAbs(spec.DocumentFile) {
+		spec.DocumentFile = filepath.Join(filepath.Dir(path), spec.DocumentFile)
+	}
+	return spec, nil
+}
+
+// listFlag collects the values of a repeated flag
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// composed is the result of composing a message
+type composed struct {
+	OpReturn string   `json:"opReturn"`
+	Size     int      `json:"size"`
+	Tx       string   `json:"tx,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func runCompose(kind string, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet(kind, "", stdout)
+	specPath := fs.String("spec", "", "read the message from a JSON or YAML `file`, flags override its fields")
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	withTx := fs.Bool("tx", false, "also print an unsigned transaction template")
+	testnet := fs.Bool("testnet", false, "decode addresses for testnet")
+
+	f := &composeSpec{}
+	var to, inputs listFlag
+	fs.IntVar(&f.TokenType, "token-type", 1, "token type `n`, 1, 0x81 (nft1 group) or 0x41 (nft1 child)")
+	if kind == "genesis" {
+		fs.StringVar(&f.Ticker, "ticker", "", "token ticker")
+		fs.StringVar(&f.Name, "name", "", "token name")
+		fs.StringVar(&f.DocumentURI, "uri", "", "document URI")
+		fs.StringVar(&f.DocumentFile, "doc-file", "", "set the document hash to the sha256 of `path`")
+		fs.StringVar(&f.DocumentHash, "doc-hash", "", "document sha256 in `hex`")
+		fs.IntVar(&f.Decimals, "decimals", 0, "decimal places of the token")
+	} else {
+		fs.StringVar(&f.TokenID, "token-id", "", "token id in `hex`")
+		fs.IntVar(&f.Decimals, "decimals", 0, "decimal places of the token, used to parse amounts")
+	}
+	if kind == "send" {
+		fs.Var(&to, "to", "send `address=amount`, repeat for each output")
+	} else {
+		fs.IntVar(&f.BatonVout, "baton-vout", 0, "output `index` of the mint baton, 0 for none")
+		fs.StringVar((*string)(&f.Quantity), "quantity", "", "`amount` to create")
+		fs.StringVar(&f.Receiver, "receiver", "", "`address` receiving the tokens in the template")
+		fs.StringVar(&f.BatonReceiver, "baton-receiver", "", "`address` receiving the baton in the template, defaults to -receiver")
+	}
+	fs.Var(&inputs, "input", "spend `txid:vout` in the template, repeat for each input")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return errSilent
+	}
+
+	spec := &composeSpec{TokenType: 1}
+	if *specPath != "" {
+		var err error
+		if spec, err = loadSpec(*specPath, stdin); err != nil {
+			return err
+		}
+		if spec.TokenType == 0 {
+			spec.TokenType = 1
+		}
+	}
+	if err := spec.override(fs, f, to, inputs); err != nil {
+		return err
+	}
+
+	params := &chaincfg.MainNetParams
+	if *testnet {
+		params = &chaincfg.TestNet3Params
+	}
+	c, err := spec.compose(kind, *withTx, params)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	}
+	return c.print(stdout)
+}
+
+// override copies the flags set on the command line from f
+func (s *composeSpec) override(fs *flag.FlagSet, f *composeSpec, to, inputs listFlag) error {
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "token-type":
+			s.TokenType = f.TokenType
+		case "token-id":
+			s.TokenID = f.TokenID
+		case "ticker":
+			s.Ticker = f.Ticker
+		case "name":
+			s.Name = f.Name
+		case "uri":
+			s.DocumentURI = f.DocumentURI
+		case "doc-file":
+			s.DocumentFile, s.DocumentHash = f.DocumentFile, ""
+		case "doc-hash":
+			s.DocumentHash, s.DocumentFile = f.DocumentHash, ""
+		case "decimals":
+			s.Decimals = f.Decimals
+		case "baton-vout":
+			s.BatonVout = f.BatonVout
+		case "quantity":
+			s.Quantity = f.Quantity
+		case "receiver":
+			s.Receiver = f.Receiver
+		case "baton-receiver":
+			s.BatonReceiver = f.BatonReceiver
+		case "to":
+			s.Recipients = nil
+			for _, r := range to {
+				i := strings.LastIndexByte(r, '=')
+				if i < 0 {
+					err = fmt.Errorf("invalid -to %q, expected address=amount", r)
+					return
+				}
+				s.Recipients = append(s.Recipients, specRecipient{Address: r[:i], Amount: specAmount(r[i+1:])})
+			}
+		case "input":
+			s.Inputs = inputs
+		}
+	})
+	if s.DocumentFile != "" && s.DocumentHash != "" {
+		return errors.New("set only one of documentFile and documentHash")
+	}
+	return err
+}
+
+// documentHash returns the document hash of a GENESIS
+func (s *composeSpec) documentHash() ([]byte, error) {
+	if s.DocumentFile != "" {
+		b, err := ioutil.ReadFile(s.DocumentFile)
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.Sum256(b)
+		return h[:], nil
+	}
+	h, err := hex.DecodeString(s.DocumentHash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document hash: %v", err)
+	}
+	return h, nil
+}
+
+// tokenID returns the decoded token id of a MINT or SEND
+func (s *composeSpec) tokenID() ([]byte, error) {
+	if s.TokenID == "" {
+		return nil, errors.New("token id is required")
+	}
+	id, err := hex.DecodeString(s.TokenID)
+	if err != nil || len(id) != 32 {
+		return nil, fmt.Errorf("invalid token id %q", s.TokenID)
+	}
+	return id, nil
+}
+
+// quantity returns the GENESIS or MINT quantity in base units, an NFT1
+// child defaults to 1
+func (s *composeSpec) quantity() (uint64, error) {
+	if s.Quantity == "" {
+		if s.TokenType == int(v1parser.TokenTypeNft1Child41) {
+			return 1, nil
+		}
+		return 0, errors.New("quantity is required")
+	}
+	return airdrop.ParseAmount(string(s.Quantity), s.Decimals)
+}
+
+// batonVout returns the baton output of a GENESIS or MINT, nil for none
+func (s *composeSpec) batonVout() *metadatamaker.MintBatonVout {
+	if s.BatonVout == 0 {
+		return nil
+	}
+	return metadatamaker.NewMintBatonVout(s.BatonVout)
+}
+
+// compose builds the message of kind, checks it by parsing it again and
+// builds the transaction template when withTx is set
+func (s *composeSpec) compose(kind string, withTx bool, params *chaincfg.Params) (*composed, error) {
+	var script, docHash, id []byte
+	var quantity uint64
+	var amounts []uint64
+	var err error
+	switch kind {
+	case "genesis":
+		if docHash, err = s.documentHash(); err != nil {
+			return nil, err
+		}
+		if quantity, err = s.quantity(); err != nil {
+			return nil, err
+		}
+		script, err = metadatamaker.CreateOpReturnGenesis(s.TokenType, []byte(s.Ticker), []byte(s.Name),
+			[]byte(s.DocumentURI), docHash, s.Decimals, s.batonVout(), quantity)
+	case "mint":
+		if id, err = s.tokenID(); err != nil {
+			return nil, err
+		}
+		if quantity, err = s.quantity(); err != nil {
+			return nil, err
+		}
+		script, err = metadatamaker.CreateOpReturnMint(s.TokenType, id, s.batonVout(), quantity)
+	case "send":
+		if id, err = s.tokenID(); err != nil {
+			return nil, err
+		}
+		for _, r := range s.Recipients {
+			amount, err := airdrop.ParseAmount(string(r.Amount), s.Decimals)
+			if err != nil {
+				return nil, fmt.Errorf("recipient %s: %v", r.Address, err)
+			}
+			amounts = append(amounts, amount)
+		}
+		script, err = metadatamaker.CreateOpReturnSend(s.TokenType, id, amounts)
+	default:
+		return nil, fmt.Errorf("unknown message %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.check(script, quantity, amounts); err != nil {
+		return nil, fmt.Errorf("composed script does not parse back: %v", err)
+	}
+
+	c := &composed{OpReturn: hex.EncodeToString(script), Size: len(script)}
+	if len(script) > txbuilder.MaxOpReturnSize {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("op_return is %d bytes, nodes relay at most %d by default", len(script), txbuilder.MaxOpReturnSize))
+	}
+	if withTx {
+		tx, err := s.template(kind, script, params)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tx.Serialize(&buf); err != nil {
+			return nil, err
+		}
+		c.Tx = hex.EncodeToString(buf.Bytes())
+		if len(tx.TxIn) == 0 {
+			c.Warnings = append(c.Warnings, "transaction template has no inputs")
+		}
+	}
+	return c, nil
+}
+
+// check parses script and compares it with the spec
+func (s *composeSpec) check(script []byte, quantity uint64, amounts []uint64) error {
+	slpMsg, err := v1parser.ParseSLP(script)
+	if err != nil {
+		return err
+	}
+	if int(slpMsg.TokenType()) != s.TokenType {
+		return fmt.Errorf("token type is %d", slpMsg.TokenType())
+	}
+	switch msg := slpMsg.(type) {
+	case *v1parser.SlpGenesis:
+		docHash, err := s.documentHash()
+		if err != nil {
+			return err
+		}
+		switch {
+		case string(msg.Ticker) != s.Ticker:
+			return errors.New("ticker differs")
+		case string(msg.Name) != s.Name:
+			return errors.New("name differs")
+		case string(msg.DocumentURI) != s.DocumentURI:
+			return errors.New("document uri differs")
+		case !bytes.Equal(msg.DocumentHash, docHash):
+			return errors.New("document hash differs")
+		case msg.Decimals != s.Decimals:
+			return errors.New("decimals differ")
+		case msg.MintBatonVout != s.BatonVout:
+			return errors.New("baton vout differs")
+		case msg.Qty != quantity:
+			return errors.New("quantity differs")
+		}
+	case *v1parser.SlpMint:
+		switch {
+		case hex.EncodeToString(msg.TokenID()) != strings.ToLower(s.TokenID):
+			return errors.New("token id differs")
+		case msg.MintBatonVout != s.BatonVout:
+			return errors.New("baton vout differs")
+		case msg.Qty != quantity:
+			return errors.New("quantity differs")
+		}
+	case *v1parser.SlpSend:
+		if hex.EncodeToString(msg.TokenID()) != strings.ToLower(s.TokenID) {
+			return errors.New("token id differs")
+		}
+		if len(msg.Amounts) != len(amounts) {
+			return errors.New("number of amounts differs")
+		}
+		for i := range amounts {
+			if msg.Amounts[i] != amounts[i] {
+				return fmt.Errorf("amount %d differs", i+1)
+			}
+		}
+	}
+	return nil
+}
+
+// template builds an unsigned transaction with the OP_RETURN at output 0
+// and dust outputs to the receivers. Outputs between the tokens and the
+// baton of a GENESIS or MINT go to the receiver.
+func (s *composeSpec) template(kind string, script []byte, params *chaincfg.Params) (*wire.MsgTx, error) {
+	tx := wire.NewMsgTx(1)
+	for _, in := range s.Inputs {
+		op, err := parseOutPoint(in)
+		if err != nil {
+			return nil, err
+		}
+		tx.AddTxIn(wire.NewTxIn(op, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, script))
+
+	pay := func(addr string) error {
+		a, err := address.Decode(addr, params)
+		if err != nil {
+			return fmt.Errorf("invalid address %q: %v", addr, err)
+		}
+		tx.AddTxOut(wire.NewTxOut(txbuilder.DustLimit, a.PkScript()))
+		return nil
+	}
+	if kind == "send" {
+		for _, r := range s.Recipients {
+			if err := pay(r.Address); err != nil {
+				return nil, err
+			}
+		}
+		return tx, nil
+	}
+
+	if s.Receiver == "" {
+		return nil, errors.New("receiver is required for the transaction template")
+	}
+	last := 1
+	if s.BatonVout > last {
+		last = s.BatonVout
+	}
+	for vout := 1; vout <= last; vout++ {
+		addr := s.Receiver
+		if vout == s.BatonVout && s.BatonReceiver != "" {
+			addr = s.BatonReceiver
+		}
+		if err := pay(addr); err != nil {
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// parseOutPoint parses an outpoint written as txid:vout
+func parseOutPoint(s string) (*wire.OutPoint, error) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return nil, fmt.Errorf("invalid outpoint %q, expected txid:vout", s)
+	}
+	hash, err := chainhash.NewHashFromStr(s[:i])
+	if err != nil {
+		return nil, fmt.Errorf("invalid outpoint %q: %v", s, err)
+	}
+	vout, err := strconv.ParseUint(s[i+1:], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid outpoint %q: %v", s, err)
+	}
+	return wire.NewOutPoint(hash, uint32(vout)), nil
+}
+
+// print writes c as aligned text
+func (c *composed) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "op_return\t%s\n", c.OpReturn)
+	fmt.Fprintf(tw, "size\t%d bytes\n", c.Size)
+	if c.Tx != "" {
+		fmt.Fprintf(tw, "tx\t%s\n", c.Tx)
+	}
+	for _, warning := range c.Warnings {
+		fmt.Fprintf(tw, "warning\t%s\n", warning)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+const testAddress = "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a"
+
+func composeJSON(t *testing.T, stdin string, args ...string) *composed {
+	out, code := runTest(t, stdin, append(args, "-json")...)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, out)
+	}
+	c := &composed{}
+	if err := json.Unmarshal([]byte(out), c); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	return c
+}
+
+func parseComposed(t *testing.T, c *composed) v1parser.ParseResult {
+	script, err := hex.DecodeString(c.OpReturn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slpMsg, err := v1parser.ParseSLP(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return slpMsg
+}
+
+func TestComposeGenesisFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	doc := filepath.Join(dir, "doc.txt")
+	if err := ioutil.WriteFile(doc, []byte("terms"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := composeJSON(t, "", "genesis", "-ticker", "TST", "-name", "Test", "-uri", "https://example.com",
+		"-doc-file", doc, "-decimals", "2", "-baton-vout", "2", "-quantity", "123.45")
+	genesis, ok := parseComposed(t, c).(*v1parser.SlpGenesis)
+	if !ok {
+		t.Fatal("expected a genesis")
+	}
+	hash := sha256.Sum256([]byte("terms"))
+	if string(genesis.Ticker) != "TST" || genesis.Qty != 12345 || genesis.MintBatonVout != 2 || !bytes.Equal(genesis.DocumentHash, hash[:]) {
+		t.Fatalf("unexpected genesis %+v", genesis)
+	}
+	if c.Size != len(c.OpReturn)/2 || len(c.Warnings) != 0 || c.Tx != "" {
+		t.Fatalf("unexpected result %+v", c)
+	}
+
+	if _, code := runTest(t, "", "genesis", "-ticker", "TST", "-quantity", "1.234", "-decimals", "2"); code != 1 {
+		t.Fatalf("expected too many decimal places to fail, got %d", code)
+	}
+	if _, code := runTest(t, "", "genesis", "-quantity", "1", "-baton-vout", "1"); code != 1 {
+		t.Fatalf("expected baton vout 1 to fail, got %d", code)
+	}
+}
+
+func TestComposeSpecFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	id := strings.Repeat("ab", 32)
+	yamlSpec := "tokenId: " + id + "\ndecimals: 1\nrecipients:\n" +
+		"  - address: " + testAddress + "\n    amount: 1.5\n" +
+		"  - address: " + testAddress + "\n    amount: \"2\"\n"
+	yamlPath := filepath.Join(dir, "send.yaml")
+	if err := ioutil.WriteFile(yamlPath, []byte(yamlSpec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := composeJSON(t, "", "send", "-spec", yamlPath)
+	send, ok := parseComposed(t, c).(*v1parser.SlpSend)
+	if !ok || hex.EncodeToString(send.TokenID()) != id || len(send.Amounts) != 2 || send.Amounts[0] != 15 || send.Amounts[1] != 20 {
+		t.Fatalf("unexpected send %+v", send)
+	}
+
+	// flags override the spec
+	c = composeJSON(t, "", "send", "-spec", yamlPath, "-to", testAddress+"=3")
+	if send := parseComposed(t, c).(*v1parser.SlpSend); len(send.Amounts) != 1 || send.Amounts[0] != 30 {
+		t.Fatalf("unexpected send %+v", send)
+	}
+
+	jsonSpec := `{"tokenType": 129, "tokenId": "` + id + `", "batonVout": 3, "quantity": 100}`
+	jsonPath := filepath.Join(dir, "mint.json")
+	if err := ioutil.WriteFile(jsonPath, []byte(jsonSpec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c = composeJSON(t, "", "mint", "-spec", jsonPath)
+	mint, ok := parseComposed(t, c).(*v1parser.SlpMint)
+	if !ok || mint.TokenType() != v1parser.TokenTypeNft1Group81 || mint.Qty != 100 || mint.MintBatonVout != 3 {
+		t.Fatalf("unexpected mint %+v", mint)
+	}
+
+	if err := ioutil.WriteFile(jsonPath, []byte(`{"tokenId": "`+id+`", "qty": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, code := runTest(t, "", "mint", "-spec", jsonPath); code != 1 || !strings.Contains(out, "unknown field") {
+		t.Fatalf("expected unknown field error, got %d: %s", code, out)
+	}
+}
+
+func TestComposeTemplate(t *testing.T) {
+	txid := strings.Repeat("11", 32)
+	c := composeJSON(t, "", "genesis", "-quantity", "10", "-baton-vout", "3",
+		"-receiver", testAddress, "-input", txid+":1", "-tx")
+	raw, err := hex.DecodeString(c.Tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := wire.NewMsgTx(1)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TxIn) != 1 || tx.TxIn[0].PreviousOutPoint.Index != 1 || tx.TxIn[0].PreviousOutPoint.Hash.String() != txid {
+		t.Fatalf("unexpected inputs %+v", tx.TxIn)
+	}
+	if len(tx.TxOut) != 4 || hex.EncodeToString(tx.TxOut[0].PkScript) != c.OpReturn || tx.TxOut[3].Value != 546 {
+		t.Fatalf("unexpected outputs %+v", tx.TxOut)
+	}
+
+	if out, code := runTest(t, "", "mint", "-token-id", strings.Repeat("ab", 32), "-quantity", "1", "-tx"); code != 1 || !strings.Contains(out, "receiver is required") {
+		t.Fatalf("expected missing receiver error, got %d: %s", code, out)
+	}
+}
+
+func TestComposeSizeWarning(t *testing.T) {
+	out, code := runTest(t, "", "genesis", "-quantity", "1", "-name", strings.Repeat("n", 200))
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, out)
+	}
+	if !strings.Contains(out, "warning") || !strings.Contains(out, "223") {
+		t.Fatalf("expected a relay size warning:\n%s", out)
+	}
+}
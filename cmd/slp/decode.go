@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gcash/bchd/txscript"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+func init() {
+	commands = append(commands, &command{
+		name:  "decode",
+		short: "decode an SLP OP_RETURN script or raw transaction",
+		run:   runDecode,
+	})
+}
+
+// decodedGenesis holds the fields only a GENESIS declares
+type decodedGenesis struct {
+	Ticker       string `json:"ticker"`
+	Name         string `json:"name"`
+	DocumentURI  string `json:"documentUri"`
+	DocumentHash string `json:"documentHash"`
+	Decimals     int    `json:"decimals"`
+}
+
+// decodedOutput is one transaction output, or one output the message
+// assigns tokens to when decoding a script alone
+type decodedOutput struct {
+	Vout      int    `json:"vout"`
+	Value     *int64 `json:"value,omitempty"`
+	PkScript  string `json:"pkScript,omitempty"`
+	Amount    string `json:"amount,omitempty"`
+	MintBaton bool   `json:"mintBaton,omitempty"`
+}
+
+// decoded is the result of decoding a script or transaction
+type decoded struct {
+	TxID          string           `json:"txid,omitempty"`
+	TokenType     int              `json:"tokenType,omitempty"`
+	TokenTypeName string           `json:"tokenTypeName,omitempty"`
+	TxType        string           `json:"txType,omitempty"`
+	TokenID       string           `json:"tokenId,omitempty"`
+	Genesis       *decodedGenesis  `json:"genesis,omitempty"`
+	Outputs       []*decodedOutput `json:"outputs,omitempty"`
+	Warnings      []string         `json:"warnings,omitempty"`
+	Errors        []string         `json:"errors,omitempty"`
+}
+
+func runDecode(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("decode", "[hex]", stdout)
+	file := fs.String("file", "", "read hex from `path`, - for stdin")
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	decimals := fs.Int("decimals", -1, "format MINT and SEND amounts with `n` decimals")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errSilent
+	}
+	input, err := readHex(fs.Arg(0), *file, stdin)
+	if err != nil {
+		return err
+	}
+
+	d := decode(input, *decimals)
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d); err != nil {
+			return err
+		}
+	} else if err := d.print(stdout); err != nil {
+		return err
+	}
+	if len(d.Errors) > 0 {
+		return errSilent
+	}
+	return nil
+}
+
+// decode decodes input as an OP_RETURN script when it starts with
+// OP_RETURN and as a raw transaction otherwise. decimals formats MINT and
+// SEND amounts when not negative.
+func decode(input []byte, decimals int) *decoded {
+	if len(input) > 0 && input[0] == txscript.OP_RETURN {
+		return decodeScript(input, decimals)
+	}
+	return decodeTx(input, decimals)
+}
+
+func tokenTypeName(t v1parser.TokenType) string {
+	switch t {
+	case v1parser.TokenTypeFungible01:
+		return "fungible"
+	case v1parser.TokenTypeNft1Group81:
+		return "nft1-group"
+	case v1parser.TokenTypeNft1Child41:
+		return "nft1-child"
+	}
+	return "unknown"
+}
+
+// describe fills the message fields of d and returns the decimals to format
+// amounts with
+func (d *decoded) describe(slpMsg v1parser.ParseResult, decimals int) int {
+	d.TokenType = int(slpMsg.TokenType())
+	d.TokenTypeName = tokenTypeName(slpMsg.TokenType())
+	switch msg := slpMsg.(type) {
+	case *v1parser.SlpGenesis:
+		d.TxType = "GENESIS"
+		d.Genesis = &decodedGenesis{
+			Ticker:       string(msg.Ticker),
+			Name:         string(msg.Name),
+			DocumentURI:  string(msg.DocumentURI),
+			DocumentHash: hex.EncodeToString(msg.DocumentHash),
+			Decimals:     msg.Decimals,
+		}
+		decimals = msg.Decimals
+	case *v1parser.SlpMint:
+		d.TxType = "MINT"
+		d.TokenID = hex.EncodeToString(msg.TokenID())
+	case *v1parser.SlpSend:
+		d.TxType = "SEND"
+		d.TokenID = hex.EncodeToString(msg.TokenID())
+	}
+	return decimals
+}
+
+// formatAmount formats amount with decimals, or in base units when decimals
+// is negative
+func formatAmount(amount *big.Int, decimals int) string {
+	s := amount.String()
+	if decimals <= 0 {
+		return s
+	}
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	return s[:len(s)-decimals] + "." + s[len(s)-decimals:]
+}
+
+// lastVout returns the highest output index the message assigns to
+func lastVout(slpMsg v1parser.ParseResult) int {
+	switch msg := slpMsg.(type) {
+	case *v1parser.SlpGenesis:
+		if msg.MintBatonVout > 1 {
+			return msg.MintBatonVout
+		}
+	case *v1parser.SlpMint:
+		if msg.MintBatonVout > 1 {
+			return msg.MintBatonVout
+		}
+	case *v1parser.SlpSend:
+		return len(msg.Amounts)
+	}
+	return 1
+}
+
+// missingOutputs describes what the message assigns to outputs the
+// transaction does not have. Excess SEND amounts are burned, a GENESIS or
+// MINT without its quantity output issues nothing and one without its baton
+// output destroys the baton.
+func missingOutputs(slpMsg v1parser.ParseResult, nOutputs int, decimals int) []string {
+	var qty uint64
+	var batonVout int
+	switch msg := slpMsg.(type) {
+	case *v1parser.SlpSend:
+		if len(msg.Amounts) < nOutputs {
+			return nil
+		}
+		burned := new(big.Int)
+		for vout := nOutputs; vout <= len(msg.Amounts); vout++ {
+			burned.Add(burned, new(big.Int).SetUint64(msg.Amounts[vout-1]))
+		}
+		return []string{fmt.Sprintf("message assigns output %d but the last output is %d, %s tokens are burned",
+			len(msg.Amounts), nOutputs-1, formatAmount(burned, decimals))}
+	case *v1parser.SlpGenesis:
+		qty, batonVout = msg.Qty, msg.MintBatonVout
+	case *v1parser.SlpMint:
+		qty, batonVout = msg.Qty, msg.MintBatonVout
+	}
+
+	var warnings []string
+	if qty > 0 && nOutputs <= 1 {
+		warnings = append(warnings, fmt.Sprintf("quantity output 1 does not exist, the %s issued tokens are lost",
+			formatAmount(new(big.Int).SetUint64(qty), decimals)))
+	}
+	if batonVout > 1 && batonVout >= nOutputs {
+		warnings = append(warnings, fmt.Sprintf("mint baton output %d does not exist, the baton is destroyed", batonVout))
+	}
+	return warnings
+}
+
+func decodeScript(script []byte, decimals int) *decoded {
+	d := &decoded{}
+	slpMsg, err := v1parser.ParseSLP(script)
+	if err != nil {
+		d.Errors = append(d.Errors, err.Error())
+		return d
+	}
+	decimals = d.describe(slpMsg, decimals)
+	for vout := 1; vout <= lastVout(slpMsg); vout++ {
+		amount, baton := slpMsg.GetVoutValue(vout)
+		out := &decodedOutput{Vout: vout, MintBaton: baton}
+		if amount != nil {
+			out.Amount = formatAmount(amount, decimals)
+		}
+		d.Outputs = append(d.Outputs, out)
+	}
+	return d
+}
+
+func decodeTx(raw []byte, decimals int) *decoded {
+	d := &decoded{}
+	tx := wire.NewMsgTx(1)
+	r := bytes.NewReader(raw)
+	if err := tx.Deserialize(r); err != nil {
+		d.Errors = append(d.Errors, fmt.Sprintf("invalid transaction: %v", err))
+		return d
+	}
+	if r.Len() > 0 {
+		d.Errors = append(d.Errors, fmt.Sprintf("%d bytes after the transaction", r.Len()))
+		return d
+	}
+	d.TxID = tx.TxHash().String()
+
+	var slpMsg v1parser.ParseResult
+	if len(tx.TxOut) > 0 {
+		var err error
+		slpMsg, err = v1parser.ParseSLP(tx.TxOut[0].PkScript)
+		if err != nil && goslp.HasSlpLokadPrefix(tx.TxOut[0].PkScript) {
+			d.Errors = append(d.Errors, err.Error())
+		}
+	}
+	if slpMsg != nil {
+		decimals = d.describe(slpMsg, decimals)
+		tokenID, err := goslp.GetSlpTokenID(tx)
+		if err != nil {
+			d.Errors = append(d.Errors, err.Error())
+		}
+		d.TokenID = hex.EncodeToString(tokenID)
+		d.Warnings = append(d.Warnings, missingOutputs(slpMsg, len(tx.TxOut), decimals)...)
+	}
+
+	for vout, txOut := range tx.TxOut {
+		value := txOut.Value
+		out := &decodedOutput{
+			Vout:     vout,
+			Value:    &value,
+			PkScript: hex.EncodeToString(txOut.PkScript),
+		}
+		if slpMsg != nil && vout > 0 {
+			amount, baton := slpMsg.GetVoutValue(vout)
+			out.MintBaton = baton
+			if amount != nil {
+				out.Amount = formatAmount(amount, decimals)
+			}
+		}
+		d.Outputs = append(d.Outputs, out)
+	}
+	return d
+}
+
+// print writes d as aligned text
+func (d *decoded) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(tw, "%s\t%s\n", name, value)
+		}
+	}
+	field("txid", d.TxID)
+	if d.TxType != "" {
+		field("token type", fmt.Sprintf("0x%02x (%s)", d.TokenType, d.TokenTypeName))
+		field("tx type", d.TxType)
+	}
+	field("token id", d.TokenID)
+	if g := d.Genesis; g != nil {
+		field("ticker", g.Ticker)
+		field("name", g.Name)
+		field("document uri", g.DocumentURI)
+		field("document hash", g.DocumentHash)
+		field("decimals", fmt.Sprint(g.Decimals))
+	}
+	if len(d.Outputs) > 0 {
+		fmt.Fprintln(tw, "outputs")
+	}
+	for _, out := range d.Outputs {
+		line := fmt.Sprintf("  %d\t", out.Vout)
+		switch {
+		case out.MintBaton:
+			line += "mint baton"
+		case out.Amount != "":
+			line += out.Amount
+		default:
+			line += "-"
+		}
+		if out.Value != nil {
+			line += fmt.Sprintf("\t%d sat\t%s", *out.Value, out.PkScript)
+		}
+		fmt.Fprintln(tw, line)
+	}
+	for _, warning := range d.Warnings {
+		fmt.Fprintf(tw, "warning\t%s\n", warning)
+	}
+	for _, e := range d.Errors {
+		fmt.Fprintf(tw, "error\t%s\n", e)
+	}
+	return tw.Flush()
+}
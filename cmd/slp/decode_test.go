@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+func runTest(t *testing.T, stdin string, args ...string) (string, int) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String() + stderr.String(), code
+}
+
+func TestDecodeScript(t *testing.T) {
+	script, err := metadatamaker.CreateOpReturnGenesis(0x01, []byte("TST"), []byte("Test"), []byte("https://example.com"), nil, 2, metadatamaker.NewMintBatonVout(2), 12345)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, code := runTest(t, "", "decode", hex.EncodeToString(script))
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, out)
+	}
+	for _, want := range []string{"0x01 (fungible)", "GENESIS", "TST", "123.45", "mint baton"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+
+	id := bytes.Repeat([]byte{0xaa}, 32)
+	script, err = metadatamaker.CreateOpReturnSend(0x01, id, []uint64{150, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, code = runTest(t, hex.EncodeToString(script)+"\n", "decode", "-json", "-decimals", "1", "-file", "-")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, out)
+	}
+	var d decoded
+	if err := json.Unmarshal([]byte(out), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.TxType != "SEND" || d.TokenID != hex.EncodeToString(id) || len(d.Outputs) != 2 || d.Outputs[0].Amount != "15.0" {
+		t.Errorf("unexpected send %+v", d)
+	}
+
+	if out, code := runTest(t, "", "decode", "6a0401"); code != 1 || !strings.Contains(out, "error") {
+		t.Errorf("expected parse error, got %d: %s", code, out)
+	}
+}
+
+func TestDecodeTx(t *testing.T) {
+	id := bytes.Repeat([]byte{0xbb}, 32)
+	script, err := metadatamaker.CreateOpReturnSend(0x01, id, []uint64{0, 7, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil))
+	tx.AddTxOut(wire.NewTxOut(0, script))
+	tx.AddTxOut(wire.NewTxOut(546, []byte{0x51}))
+	tx.AddTxOut(wire.NewTxOut(546, []byte{0x51}))
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// the message assigns three outputs but the transaction has two, the
+	// excess amount is burned
+	out, code := runTest(t, hex.EncodeToString(buf.Bytes()), "decode", "-json")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, out)
+	}
+	var d decoded
+	if err := json.Unmarshal([]byte(out), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.TxID != tx.TxHash().String() || d.TokenID != hex.EncodeToString(id) || len(d.Outputs) != 3 {
+		t.Fatalf("unexpected tx %+v", d)
+	}
+	if d.Outputs[1].Amount != "0" || d.Outputs[2].Amount != "7" || *d.Outputs[2].Value != 546 {
+		t.Errorf("unexpected outputs %+v %+v", d.Outputs[1], d.Outputs[2])
+	}
+	if len(d.Errors) != 0 || len(d.Warnings) != 1 || !strings.Contains(d.Warnings[0], "3 tokens are burned") {
+		t.Errorf("unexpected warnings %v errors %v", d.Warnings, d.Errors)
+	}
+
+	out, code = runTest(t, hex.EncodeToString(buf.Bytes()), "decode")
+	if code != 0 || !regexp.MustCompile(`(?m)^ +1 +0 +546 sat`).MatchString(out) || !strings.Contains(out, "warning") {
+		t.Errorf("unexpected text output %d: %s", code, out)
+	}
+
+	if out, code := runTest(t, "", "decode", "0100"); code != 1 || !strings.Contains(out, "invalid transaction") {
+		t.Errorf("expected invalid transaction, got %d: %s", code, out)
+	}
+	if _, code := runTest(t, "", "nope"); code != 2 {
+		t.Errorf("expected usage exit code, got %d", code)
+	}
+}
+
+func TestMissingOutputs(t *testing.T) {
+	id := bytes.Repeat([]byte{0xbb}, 32)
+	parse := func(script []byte, err error) v1parser.ParseResult {
+		if err != nil {
+			t.Fatal(err)
+		}
+		slpMsg, err := v1parser.ParseSLP(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return slpMsg
+	}
+
+	genesis := parse(metadatamaker.CreateOpReturnGenesis(0x01, []byte("T"), []byte("t"), nil, nil, 2, nil, 1000))
+	if w := missingOutputs(genesis, 1, 2); len(w) != 1 || !strings.Contains(w[0], "the 10.00 issued tokens are lost") {
+		t.Errorf("unexpected genesis warnings %v", w)
+	}
+	mint := parse(metadatamaker.CreateOpReturnMint(0x01, id, metadatamaker.NewMintBatonVout(2), 5))
+	if w := missingOutputs(mint, 2, -1); len(w) != 1 || !strings.Contains(w[0], "mint baton output 2") {
+		t.Errorf("unexpected mint warnings %v", w)
+	}
+	if w := missingOutputs(mint, 1, -1); len(w) != 2 {
+		t.Errorf("expected quantity and baton warnings, got %v", w)
+	}
+
+	// the burned total does not overflow
+	send := parse(metadatamaker.CreateOpReturnSend(0x01, id, []uint64{math.MaxUint64, math.MaxUint64}))
+	if w := missingOutputs(send, 1, -1); len(w) != 1 || !strings.Contains(w[0], "36893488147419103230 tokens are burned") {
+		t.Errorf("unexpected send warnings %v", w)
+	}
+	if w := missingOutputs(send, 3, -1); len(w) != 0 {
+		t.Errorf("expected no warnings, got %v", w)
+	}
+}
@@ -0,0 +1,119 @@
+// Command slp decodes, composes and validates SLP scripts and transactions.
+//
+// Usage:
+//
+//	slp <command> [flags] [args]
+//
+// Run slp help for the list of commands.
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// command is a subcommand of slp, run returns an error to exit non-zero
+type command struct {
+	name  string
+	short string
+	run   func(args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+// commands are the subcommands in the order help lists them
+var commands []*command
+
+// errSilent exits non-zero after a command already printed its failure
+var errSilent = errors.New("silent failure")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command named by args[0] and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stderr)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+		err := c.run(args[1:], stdin, stdout)
+		switch {
+		case err == nil:
+			return 0
+		case err == flag.ErrHelp:
+			return 0
+		case err == errSilent:
+			return 1
+		}
+		fmt.Fprintf(stderr, "slp %s: %v\n", c.name, err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "slp: unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: slp <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.short)
+	}
+}
+
+// newFlagSet creates the flag set of a command, errors are returned rather
+// than exiting
+func newFlagSet(name, args string, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("slp "+name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintln(output, strings.TrimSpace(fmt.Sprintf("usage: slp %s [flags] %s", name, args)))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// readHex returns the hex decoded input from arg, the file at path or
+// stdin, in that order of preference. A path of - reads stdin.
+func readHex(arg, path string, stdin io.Reader) ([]byte, error) {
+	var text []byte
+	switch {
+	case arg != "":
+		text = []byte(arg)
+	case path != "" && path != "-":
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = b
+	default:
+		b, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+		text = b
+	}
+	text = bytes.TrimSpace(text)
+	if len(text) == 0 {
+		return nil, errors.New("no input")
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(string(text), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("input is not hex: %v", err)
+	}
+	return b, nil
+}
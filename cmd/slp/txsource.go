@@ -0,0 +1,200 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+)
+
+// txSource holds raw transactions loaded from files, keyed by hash
+type txSource struct {
+	txs map[chainhash.Hash]*wire.MsgTx
+
+	// skipped describes the files that held no transactions
+	skipped []string
+}
+
+// loadTxSource loads the transactions of a directory, a .tar, .tar.gz,
+// .tgz or .zip archive, or a single file. Files hold transactions as hex
+// separated by whitespace, or as concatenated raw bytes.
+func loadTxSource(path string) (*txSource, error) {
+	src := &txSource{txs: make(map[chainhash.Hash]*wire.MsgTx)}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			src.add(p, b)
+			return nil
+		})
+		return src, err
+	}
+
+	name := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		err = src.loadZip(path)
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		err = src.loadTar(path, true)
+	case strings.HasSuffix(name, ".tar"):
+		err = src.loadTar(path, false)
+	default:
+		var b []byte
+		if b, err = ioutil.ReadFile(path); err == nil {
+			src.add(path, b)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+func (s *txSource) loadZip(path string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+		s.add(f.Name, b)
+	}
+	return nil
+}
+
+func (s *txSource) loadTar(path string, gzipped bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("%s: %v", hdr.Name, err)
+		}
+		s.add(hdr.Name, b)
+	}
+}
+
+// add adds the transactions of a file, recording it as skipped when it
+// holds none
+func (s *txSource) add(name string, b []byte) {
+	txs, err := parseTxs(b)
+	if err != nil {
+		s.skipped = append(s.skipped, fmt.Sprintf("%s: %v", name, err))
+		return
+	}
+	for _, tx := range txs {
+		s.txs[tx.TxHash()] = tx
+	}
+}
+
+// parseTxs parses whitespace separated hex transactions, falling back to
+// concatenated raw transactions when b is not hex
+func parseTxs(b []byte) ([]*wire.MsgTx, error) {
+	if fields := strings.Fields(string(b)); len(fields) > 0 {
+		var raws [][]byte
+		for _, field := range fields {
+			raw, err := hex.DecodeString(strings.TrimPrefix(field, "0x"))
+			if err != nil {
+				raws = nil
+				break
+			}
+			raws = append(raws, raw)
+		}
+		if raws != nil {
+			var txs []*wire.MsgTx
+			for _, raw := range raws {
+				tx, err := parseRawTxs(raw)
+				if err != nil {
+					return nil, err
+				}
+				txs = append(txs, tx...)
+			}
+			return txs, nil
+		}
+	}
+	return parseRawTxs(b)
+}
+
+// parseRawTxs parses concatenated raw transactions
+func parseRawTxs(b []byte) ([]*wire.MsgTx, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("no transactions")
+	}
+	var txs []*wire.MsgTx
+	r := bytes.NewReader(b)
+	for r.Len() > 0 {
+		tx := wire.NewMsgTx(1)
+		if err := tx.Deserialize(r); err != nil {
+			return nil, fmt.Errorf("invalid transaction: %v", err)
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// get returns the transaction with hash, nil when the source lacks it
+func (s *txSource) get(hash chainhash.Hash) *wire.MsgTx {
+	return s.txs[hash]
+}
+
+// sortHashes orders hashes by their string form
+func sortHashes(hashes []chainhash.Hash) {
+	sort.Slice(hashes, func(i, j int) bool {
+		return hashes[i].String() < hashes[j].String()
+	})
+}
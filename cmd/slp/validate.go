@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+func init() {
+	commands = append(commands, &command{
+		name:  "validate",
+		short: "validate a transaction offline from a folder or archive of raw transactions",
+		run:   runValidate,
+	})
+}
+
+// status is the outcome of validating a transaction
+type status int
+
+const (
+	statusValid status = iota
+	statusInvalid
+
+	// statusUnknown is a transaction whose validity depends on ancestors
+	// missing from the source
+	statusUnknown
+)
+
+func (s status) String() string {
+	switch s {
+	case statusValid:
+		return "valid"
+	case statusInvalid:
+		return "invalid"
+	}
+	return "unknown"
+}
+
+// verdict is the validity of one transaction of the source
+type verdict struct {
+	hash    chainhash.Hash
+	status  status
+	txType  string
+	tokenID string
+	reason  string
+
+	// causes are the inputs the verdict rests on: the token inputs of a
+	// valid transaction, the token and burned inputs of an invalid one and
+	// the unresolved inputs of an unknown one
+	causes []*cause
+
+	outputs []*tokenindex.TokenUtxo
+}
+
+// cause is an input of a transaction, parent is nil when the source lacks
+// the spent transaction
+type cause struct {
+	input    int
+	outPoint wire.OutPoint
+	parent   *verdict
+}
+
+// validator validates transactions by walking their ancestry in a source
+type validator struct {
+	src      *txSource
+	verdicts map[chainhash.Hash]*verdict
+}
+
+func newValidator(src *txSource) *validator {
+	return &validator{src: src, verdicts: make(map[chainhash.Hash]*verdict)}
+}
+
+// relevantInputs returns the inputs that can carry tokens into tx
+func relevantInputs(tx *wire.MsgTx) map[wire.OutPoint]int {
+	inputs := make(map[wire.OutPoint]int)
+	if len(tx.TxOut) == 0 {
+		return inputs
+	}
+	slpMsg, err := v1parser.ParseSLP(tx.TxOut[0].PkScript)
+	if err != nil {
+		return inputs
+	}
+	if _, ok := slpMsg.(*v1parser.SlpGenesis); ok {
+		if slpMsg.TokenType() == v1parser.TokenTypeNft1Child41 && len(tx.TxIn) > 0 {
+			inputs[tx.TxIn[0].PreviousOutPoint] = 0
+		}
+		return inputs
+	}
+	for i, in := range tx.TxIn {
+		inputs[in.PreviousOutPoint] = i
+	}
+	return inputs
+}
+
+// validate returns the verdict of the transaction with hash, nil when the
+// source lacks it
+func (v *validator) validate(hash chainhash.Hash) *verdict {
+	if vd, ok := v.verdicts[hash]; ok {
+		return vd
+	}
+	tx := v.src.get(hash)
+	if tx == nil {
+		return nil
+	}
+	// a transaction cannot spend its own descendants, the placeholder only
+	// stops malformed sources from recursing forever
+	vd := &verdict{hash: hash, status: statusUnknown, reason: "transaction spends itself"}
+	v.verdicts[hash] = vd
+
+	relevant := relevantInputs(tx)
+	unresolved := make(map[int]*cause)
+	burned := make(map[int]*cause)
+	lookup := func(op wire.OutPoint) *tokenindex.TokenUtxo {
+		i, ok := relevant[op]
+		if !ok {
+			return nil
+		}
+		c := &cause{input: i, outPoint: op, parent: v.validate(op.Hash)}
+		switch {
+		case c.parent == nil || c.parent.status == statusUnknown:
+			unresolved[i] = c
+		case c.parent.status == statusInvalid:
+			if c.parent.txType != "" {
+				burned[i] = c
+			}
+		case int(op.Index) < len(c.parent.outputs):
+			return c.parent.outputs[op.Index]
+		}
+		return nil
+	}
+	res := tokenindex.ApplyTx(tx, 0, lookup)
+
+	vd.reason = ""
+	vd.outputs = res.Outputs
+	if res.SlpMsg != nil {
+		vd.txType = txTypeName(res.SlpMsg)
+		vd.tokenID = res.TokenID.String()
+	}
+	switch {
+	case res.Valid:
+		vd.status = statusValid
+		for _, s := range res.Spent {
+			// an nft1 child genesis rests on the group token at input 0
+			i, ok := relevant[s.OutPoint]
+			if ok && (s.Utxo.TokenID == res.TokenID || vd.txType == "GENESIS") {
+				vd.causes = append(vd.causes, &cause{input: i, outPoint: s.OutPoint, parent: v.verdicts[s.OutPoint.Hash]})
+			}
+		}
+	case res.SlpMsg == nil:
+		vd.status = statusInvalid
+		vd.reason = "not an SLP transaction"
+		if _, _, err := goslp.GetTokenOutputs(tx); err != nil && len(tx.TxOut) > 0 && goslp.HasSlpLokadPrefix(tx.TxOut[0].PkScript) {
+			vd.reason = err.Error()
+		}
+	case len(unresolved) > 0:
+		vd.status = statusUnknown
+		vd.reason = res.InvalidReason + " with the ancestors in the source"
+		vd.causes = sortedCauses(unresolved)
+	default:
+		// list the token inputs next to the burned ones to show what the
+		// transaction had to spend
+		for _, s := range res.Spent {
+			if i, ok := relevant[s.OutPoint]; ok && s.Utxo.TokenID == res.TokenID {
+				burned[i] = &cause{input: i, outPoint: s.OutPoint, parent: v.verdicts[s.OutPoint.Hash]}
+			}
+		}
+		vd.status = statusInvalid
+		vd.reason = res.InvalidReason
+		vd.causes = sortedCauses(burned)
+	}
+	return vd
+}
+
+func txTypeName(slpMsg v1parser.ParseResult) string {
+	switch slpMsg.(type) {
+	case *v1parser.SlpGenesis:
+		return "GENESIS"
+	case *v1parser.SlpMint:
+		return "MINT"
+	case *v1parser.SlpSend:
+		return "SEND"
+	}
+	return ""
+}
+
+// sortedCauses returns causes in input order
+func sortedCauses(causes map[int]*cause) []*cause {
+	var sorted []*cause
+	for i := 0; len(sorted) < len(causes); i++ {
+		if c, ok := causes[i]; ok {
+			sorted = append(sorted, c)
+		}
+	}
+	return sorted
+}
+
+// chainEntry is one transaction of the reason chain, Depth 0 is the target
+// and deeper entries are the parents spent by Input of the entry above
+type chainEntry struct {
+	Depth    int    `json:"depth"`
+	Input    int    `json:"input,omitempty"`
+	OutPoint string `json:"outpoint,omitempty"`
+	TxID     string `json:"txid"`
+	Verdict  string `json:"verdict"`
+	TxType   string `json:"txType,omitempty"`
+	TokenID  string `json:"tokenId,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+
+	// Repeated marks a transaction already listed above with its parents
+	Repeated bool `json:"repeated,omitempty"`
+}
+
+// report is the output of the validate command
+type report struct {
+	TxID         string        `json:"txid"`
+	Verdict      string        `json:"verdict"`
+	Reason       string        `json:"reason,omitempty"`
+	Transactions int           `json:"transactions"`
+	Chain        []*chainEntry `json:"chain"`
+	Missing      []string      `json:"missing,omitempty"`
+	Skipped      []string      `json:"skipped,omitempty"`
+}
+
+// newReport flattens the verdict of the target and its causes
+func newReport(src *txSource, vd *verdict, withMissing bool) *report {
+	r := &report{
+		TxID:         vd.hash.String(),
+		Verdict:      vd.status.String(),
+		Reason:       vd.reason,
+		Transactions: len(src.txs),
+		Skipped:      src.skipped,
+	}
+	shown := make(map[chainhash.Hash]bool)
+	var walk func(vd *verdict, depth int, c *cause)
+	walk = func(vd *verdict, depth int, c *cause) {
+		e := &chainEntry{Depth: depth, Verdict: "missing"}
+		if c != nil {
+			e.Input = c.input
+			e.OutPoint = c.outPoint.String()
+			e.TxID = c.outPoint.Hash.String()
+		}
+		r.Chain = append(r.Chain, e)
+		if vd == nil {
+			return
+		}
+		e.TxID = vd.hash.String()
+		e.Verdict = vd.status.String()
+		e.TxType = vd.txType
+		e.TokenID = vd.tokenID
+		e.Reason = vd.reason
+		if shown[vd.hash] {
+			e.Repeated = len(vd.causes) > 0
+			return
+		}
+		shown[vd.hash] = true
+		for _, c := range vd.causes {
+			walk(c.parent, depth+1, c)
+		}
+	}
+	walk(vd, 0, nil)
+
+	if withMissing {
+		missing := make(map[chainhash.Hash]bool)
+		visited := make(map[chainhash.Hash]bool)
+		var collect func(vd *verdict)
+		collect = func(vd *verdict) {
+			if vd.status != statusUnknown || visited[vd.hash] {
+				return
+			}
+			visited[vd.hash] = true
+			for _, c := range vd.causes {
+				if c.parent == nil {
+					missing[c.outPoint.Hash] = true
+				} else {
+					collect(c.parent)
+				}
+			}
+		}
+		collect(vd)
+		var hashes []chainhash.Hash
+		for h := range missing {
+			hashes = append(hashes, h)
+		}
+		sortHashes(hashes)
+		for _, h := range hashes {
+			r.Missing = append(r.Missing, h.String())
+		}
+	}
+	return r
+}
+
+// print writes the report as indented text
+func (r *report) print(out io.Writer, withMissing bool) error {
+	w := &bytes.Buffer{}
+	fmt.Fprintf(w, "txid      %s\n", r.TxID)
+	fmt.Fprintf(w, "verdict   %s\n", r.Verdict)
+	if r.Reason != "" {
+		fmt.Fprintf(w, "reason    %s\n", r.Reason)
+	}
+	fmt.Fprintf(w, "source    %d transactions\n", r.Transactions)
+	fmt.Fprintln(w, "chain")
+	for _, e := range r.Chain {
+		line := strings.Repeat("  ", e.Depth+1)
+		if e.Depth > 0 {
+			line += fmt.Sprintf("input %d spends %s ", e.Input, e.OutPoint)
+		} else {
+			line += e.TxID + " "
+		}
+		line += e.Verdict
+		if e.TxType != "" {
+			line += " " + e.TxType + " " + e.TokenID
+		}
+		if e.Reason != "" {
+			line += ": " + e.Reason
+		}
+		if e.Repeated {
+			line += " (see above)"
+		}
+		fmt.Fprintln(w, line)
+	}
+	if withMissing {
+		fmt.Fprintf(w, "missing   %d transactions\n", len(r.Missing))
+		for _, m := range r.Missing {
+			fmt.Fprintf(w, "  %s\n", m)
+		}
+	}
+	for _, s := range r.Skipped {
+		fmt.Fprintf(w, "skipped   %s\n", s)
+	}
+	_, err := out.Write(w.Bytes())
+	return err
+}
+
+func runValidate(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("validate", "<dir|archive> <txid>", stdout)
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	withMissing := fs.Bool("missing", false, "list the missing ancestors needed to complete the proof")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errSilent
+	}
+	hash, err := chainhash.NewHashFromStr(fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("invalid txid: %v", err)
+	}
+	src, err := loadTxSource(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	vd := newValidator(src).validate(*hash)
+	if vd == nil {
+		return fmt.Errorf("transaction %s is not in %s", hash, fs.Arg(0))
+	}
+	r := newReport(src, vd, *withMissing)
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	} else {
+		err = r.print(stdout, *withMissing)
+	}
+	if err != nil {
+		return err
+	}
+	if vd.status != statusValid {
+		return errSilent
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+)
+
+func testValidateTx(t *testing.T, script []byte, spends ...wire.OutPoint) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	for i := range spends {
+		tx.AddTxIn(wire.NewTxIn(&spends[i], nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, script))
+	for i := 0; i < 3; i++ {
+		tx.AddTxOut(wire.NewTxOut(546, []byte{0x51}))
+	}
+	return tx
+}
+
+func testSendScript(t *testing.T, genesis *wire.MsgTx, amounts ...uint64) []byte {
+	id := genesis.TxHash()
+	for i := 0; i < len(id)/2; i++ {
+		id[i], id[len(id)-1-i] = id[len(id)-1-i], id[i]
+	}
+	script, err := metadatamaker.CreateOpReturnSend(0x01, id[:], amounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+func txHex(t *testing.T, tx *wire.MsgTx) string {
+	return hex.EncodeToString(mustSerialize(t, tx))
+}
+
+func validateReport(t *testing.T, wantCode int, args ...string) *report {
+	out, code := runTest(t, "", append([]string{"validate", "-json"}, args...)...)
+	if code != wantCode {
+		t.Fatalf("expected exit %d, got %d: %s", wantCode, code, out)
+	}
+	r := &report{}
+	if err := json.Unmarshal([]byte(out), r); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	return r
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	funding := wire.OutPoint{Hash: chainhash.Hash{1}, Index: 0}
+	genesisScript, err := metadatamaker.CreateOpReturnGenesis(0x01, []byte("TST"), nil, nil, nil, 0, nil, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := testValidateTx(t, genesisScript, funding)
+	send := testValidateTx(t, testSendScript(t, genesis, 60, 40), wire.OutPoint{Hash: genesis.TxHash(), Index: 1})
+	overspend := testValidateTx(t, testSendScript(t, genesis, 70), wire.OutPoint{Hash: send.TxHash(), Index: 1})
+	missing := wire.OutPoint{Hash: chainhash.Hash{2}, Index: 1}
+	incomplete := testValidateTx(t, testSendScript(t, genesis, 100),
+		wire.OutPoint{Hash: send.TxHash(), Index: 1}, missing)
+
+	// the genesis is stored raw, the others as hex in one file
+	if err := ioutil.WriteFile(filepath.Join(dir, "genesis.bin"), mustSerialize(t, genesis), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hexes := txHex(t, send) + "\n" + txHex(t, overspend) + "\n" + txHex(t, incomplete) + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "txs.hex"), []byte(hexes), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a transaction"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o, _ := runTest(t, "", "validate", "-missing", dir, incomplete.TxHash().String())
+	t.Log(o)
+	o, _ = runTest(t, "", "validate", dir, overspend.TxHash().String())
+	t.Log(o)
+	r := validateReport(t, 0, dir, send.TxHash().String())
+	if r.Verdict != "valid" || r.Transactions != 4 || len(r.Skipped) != 1 {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if len(r.Chain) != 2 || r.Chain[1].TxID != genesis.TxHash().String() || r.Chain[1].TxType != "GENESIS" {
+		t.Fatalf("unexpected chain %+v", r.Chain)
+	}
+
+	r = validateReport(t, 1, dir, overspend.TxHash().String())
+	if r.Verdict != "invalid" || r.Reason != "send outputs exceed valid token inputs" {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if len(r.Chain) != 3 || r.Chain[1].TxID != send.TxHash().String() || r.Chain[2].TxType != "GENESIS" {
+		t.Fatalf("unexpected chain %+v", r.Chain)
+	}
+
+	r = validateReport(t, 1, "-missing", dir, incomplete.TxHash().String())
+	if r.Verdict != "unknown" || len(r.Missing) != 1 || r.Missing[0] != missing.Hash.String() {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if len(r.Chain) != 2 || r.Chain[1].Verdict != "missing" || r.Chain[1].Input != 1 {
+		t.Fatalf("unexpected chain %+v", r.Chain)
+	}
+
+	// the proof completes once the missing ancestor is added
+	other := testValidateTx(t, testSendScript(t, genesis, 0, 40), wire.OutPoint{Hash: send.TxHash(), Index: 2})
+	incomplete.TxIn[1].PreviousOutPoint = wire.OutPoint{Hash: other.TxHash(), Index: 2}
+	archive := filepath.Join(dir, "txs.tar.gz")
+	writeTarGz(t, archive, map[string][]byte{
+		"a.hex": []byte(txHex(t, genesis) + " " + txHex(t, send)),
+		"b.hex": []byte(txHex(t, other) + "\n" + txHex(t, incomplete)),
+	})
+	r = validateReport(t, 0, archive, incomplete.TxHash().String())
+	if r.Verdict != "valid" || r.Transactions != 4 {
+		t.Fatalf("unexpected report %+v", r)
+	}
+
+	out, code := runTest(t, "", "validate", "-missing", dir, incomplete.TxHash().String())
+	if code != 1 || !strings.Contains(out, "is not in") {
+		t.Fatalf("expected missing target error, got %d: %s", code, out)
+	}
+}
+
+func mustSerialize(t *testing.T, tx *wire.MsgTx) []byte {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeTarGz(t *testing.T, path string, files map[string][]byte) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, b := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(b)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,392 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+var (
+	// ErrSlowSubscriber is returned to a subscriber that fell further behind
+	// than the bus retains events
+	ErrSlowSubscriber = errors.New("subscriber fell behind the event stream")
+
+	// ErrCursorTooOld is returned when resuming from a position the bus no
+	// longer retains
+	ErrCursorTooOld = errors.New("cursor is older than the retained events")
+
+	// ErrClosed is returned by Next after the subscription is closed
+	ErrClosed = errors.New("subscription closed")
+)
+
+// DefaultCapacity is the number of events a bus retains by default
+const DefaultCapacity = 4096
+
+// DefaultBlockTimeout is how long publishing waits for a subscriber under
+// BackpressureBlock by default
+const DefaultBlockTimeout = 30 * time.Second
+
+// Backpressure selects what happens when a subscriber has not read an
+// event the bus needs to discard
+type Backpressure int
+
+const (
+	// BackpressureDisconnect ends the subscription with ErrSlowSubscriber
+	BackpressureDisconnect Backpressure = iota
+
+	// BackpressureDrop skips the subscriber ahead, counting the events it
+	// missed in Dropped
+	BackpressureDrop
+
+	// BackpressureBlock makes publishing wait until the subscriber reads
+	// the event, ending the subscription with ErrSlowSubscriber when it
+	// does not within its block timeout
+	BackpressureBlock
+)
+
+// Filter selects events, empty fields match everything. Reorg events pass
+// every field except Types.
+type Filter struct {
+	Types      []EventType
+	TokenIDs   []tokenindex.TokenID
+	TokenTypes []v1parser.TokenType
+
+	// PkScripts matches events creating or spending token outputs with
+	// one of the scripts, use address.Address.PkScript to filter by
+	// address
+	PkScripts [][]byte
+}
+
+// Match returns true when e passes the filter
+func (f *Filter) Match(e Event) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Types) > 0 {
+		found := false
+		for _, t := range f.Types {
+			found = found || t == e.Type()
+		}
+		if !found {
+			return false
+		}
+	}
+	if e.Type() == TypeReorg {
+		return true
+	}
+
+	info := e.Info()
+	if len(f.TokenIDs) > 0 {
+		found := false
+		for _, id := range f.TokenIDs {
+			found = found || id == info.TokenID
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.TokenTypes) > 0 {
+		found := false
+		for _, t := range f.TokenTypes {
+			found = found || t == info.TokenType
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.PkScripts) > 0 {
+		found := false
+		for _, a := range f.PkScripts {
+			for _, b := range info.PkScripts {
+				found = found || bytes.Equal(a, b)
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Bus publishes events to subscribers. It retains the most recent events so
+// subscribers can resume from a block height or a cursor.
+type Bus struct {
+	mtx      sync.Mutex
+	capacity int
+
+	// pubMtx is held while publishing so the events of one call get
+	// consecutive sequences even when publishing waits for subscribers
+	pubMtx sync.Mutex
+
+	// log holds the retained events, first is the sequence of log[0]
+	log   []Event
+	first uint64
+
+	// trimmed is the highest confirmed height of a discarded event
+	trimmed int32
+
+	subs    map[*Subscription]struct{}
+	changed chan struct{}
+}
+
+// NewBus creates a Bus retaining up to capacity events, DefaultCapacity is
+// used when capacity is not positive
+func NewBus(capacity int) *Bus {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Bus{
+		capacity: capacity,
+		trimmed:  -1,
+		subs:     make(map[*Subscription]struct{}),
+		changed:  make(chan struct{}),
+	}
+}
+
+// notify wakes everything waiting on the bus, the caller must hold the lock
+func (b *Bus) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// next returns the sequence the next published event gets
+func (b *Bus) next() uint64 {
+	return b.first + uint64(len(b.log))
+}
+
+// publish appends events to the log, discarding old events as needed
+func (b *Bus) publish(events []Event) {
+	b.pubMtx.Lock()
+	defer b.pubMtx.Unlock()
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for _, e := range events {
+		for len(b.log) >= b.capacity {
+			if b.waitForSubscribers() {
+				continue
+			}
+			if h := b.log[0].Info().Height; h > b.trimmed {
+				b.trimmed = h
+			}
+			b.log[0] = nil
+			b.log = b.log[1:]
+			b.first++
+		}
+		e.Info().Cursor = Cursor{Height: e.Info().Height, Seq: b.next()}
+		b.log = append(b.log, e)
+	}
+	b.notify()
+}
+
+// waitForSubscribers applies the backpressure policy of subscribers that
+// have not read the oldest event. It returns true after waiting, when the
+// state must be checked again. The caller must hold the lock.
+func (b *Bus) waitForSubscribers() bool {
+	for s := range b.subs {
+		if s.err != nil || s.pos > b.first {
+			continue
+		}
+		switch s.policy {
+		case BackpressureBlock:
+			if s.deadline.IsZero() {
+				s.deadline = time.Now().Add(s.timeout)
+			}
+			wait := time.Until(s.deadline)
+			if wait <= 0 {
+				s.err = ErrSlowSubscriber
+				continue
+			}
+			// wake the subscriber for the events of this publish already
+			// appended
+			b.notify()
+			ch := b.changed
+			b.mtx.Unlock()
+			timer := time.NewTimer(wait)
+			select {
+			case <-ch:
+			case <-timer.C:
+			}
+			timer.Stop()
+			b.mtx.Lock()
+			return true
+		case BackpressureDrop:
+			s.pos = b.first + 1
+			s.dropped++
+		default:
+			s.err = ErrSlowSubscriber
+		}
+	}
+	return false
+}
+
+// BlockConnected publishes the events of the transactions of a connected
+// block, as returned by tokenindex.Index.ConnectBlock
+func (b *Bus) BlockConnected(blockHash chainhash.Hash, height int32, results []*tokenindex.TxResult) {
+	var events []Event
+	for _, res := range results {
+		events = append(events, TxEvents(res, blockHash, height)...)
+	}
+	b.publish(events)
+}
+
+// BlockDisconnected publishes a ReorgEvent for a disconnected block
+func (b *Bus) BlockDisconnected(undo *tokenindex.BlockUndo) {
+	b.publish([]Event{&ReorgEvent{EventInfo{BlockHash: undo.Hash, Height: undo.Height}}})
+}
+
+// MempoolTx publishes the events of an unconfirmed transaction. They are
+// published again with a height once the transaction confirms.
+func (b *Bus) MempoolTx(res *tokenindex.TxResult) {
+	b.publish(TxEvents(res, chainhash.Hash{}, -1))
+}
+
+// SubscribeOptions configures a subscription, by default it starts with
+// the next published event
+type SubscribeOptions struct {
+	Filter       *Filter
+	Backpressure Backpressure
+
+	// BlockTimeout is how long publishing waits for the subscriber to read
+	// an event under BackpressureBlock, DefaultBlockTimeout when 0
+	BlockTimeout time.Duration
+
+	// FromHeight starts with the confirmed events at or above the height
+	// on the current chain, when set
+	FromHeight *int32
+
+	// After starts with the event following a cursor previously returned,
+	// when set
+	After *Cursor
+}
+
+// Subscribe starts a subscription
+func (b *Bus) Subscribe(opts SubscribeOptions) (*Subscription, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	s := &Subscription{
+		bus:     b,
+		filter:  opts.Filter,
+		policy:  opts.Backpressure,
+		timeout: opts.BlockTimeout,
+		pos:     b.next(),
+	}
+	if s.timeout <= 0 {
+		s.timeout = DefaultBlockTimeout
+	}
+	switch {
+	case opts.After != nil:
+		pos := opts.After.Seq + 1
+		if pos < b.first {
+			return nil, ErrCursorTooOld
+		}
+		if pos < s.pos {
+			s.pos = pos
+		}
+	case opts.FromHeight != nil:
+		pos, err := b.heightPosition(*opts.FromHeight)
+		if err != nil {
+			return nil, err
+		}
+		s.pos = pos
+	}
+	b.subs[s] = struct{}{}
+	return s, nil
+}
+
+// heightPosition returns the sequence of the first confirmed event at or
+// above height that was not orphaned by a later reorg. The caller must hold
+// the lock.
+func (b *Bus) heightPosition(height int32) (uint64, error) {
+	if b.trimmed >= height {
+		return 0, ErrCursorTooOld
+	}
+	start := 0
+	for i, e := range b.log {
+		if e.Type() == TypeReorg && e.Info().Height <= height {
+			start = i + 1
+		}
+	}
+	for i := start; i < len(b.log); i++ {
+		if b.log[i].Info().Height >= height {
+			return b.first + uint64(i), nil
+		}
+	}
+	return b.next(), nil
+}
+
+// Subscription reads events from a Bus
+type Subscription struct {
+	bus     *Bus
+	filter  *Filter
+	policy  Backpressure
+	pos     uint64
+	dropped uint64
+	err     error
+
+	// timeout bounds how long publishing waits for the subscriber, deadline
+	// is when the current wait ends and is reset whenever it reads
+	timeout  time.Duration
+	deadline time.Time
+}
+
+// Next returns the next event passing the filter, waiting for one to be
+// published
+func (s *Subscription) Next(ctx context.Context) (Event, error) {
+	b := s.bus
+	b.mtx.Lock()
+	for {
+		if s.err != nil {
+			err := s.err
+			b.mtx.Unlock()
+			return nil, err
+		}
+		if s.pos < b.next() {
+			e := b.log[s.pos-b.first]
+			s.pos++
+			s.deadline = time.Time{}
+			b.notify()
+			if s.filter.Match(e) {
+				b.mtx.Unlock()
+				return e, nil
+			}
+			continue
+		}
+
+		ch := b.changed
+		b.mtx.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		b.mtx.Lock()
+	}
+}
+
+// Dropped returns the number of events skipped under BackpressureDrop
+func (s *Subscription) Dropped() uint64 {
+	s.bus.mtx.Lock()
+	defer s.bus.mtx.Unlock()
+	return s.dropped
+}
+
+// Close ends the subscription, pending and later calls to Next return
+// ErrClosed
+func (s *Subscription) Close() {
+	b := s.bus
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if s.err == nil {
+		s.err = ErrClosed
+	}
+	delete(b.subs, s)
+	b.notify()
+}
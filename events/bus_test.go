@@ -0,0 +1,247 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+// testEvent creates a send of token id confirmed at height
+func testEvent(id byte, height int32) Event {
+	return &SendEvent{EventInfo: EventInfo{TokenID: tokenindex.TokenID{id}, Height: height}}
+}
+
+// readAll returns the events available without waiting
+func readAll(t *testing.T, s *Subscription) []Event {
+	var events []Event
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		e, err := s.Next(ctx)
+		cancel()
+		if err == context.DeadlineExceeded {
+			return events
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+}
+
+func TestBusFilter(t *testing.T) {
+	idx := tokenindex.New()
+	bus := NewBus(0)
+	sub, err := bus.Subscribe(SubscribeOptions{Filter: &Filter{Types: []EventType{TypeSend, TypeBurn}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nft, err := bus.Subscribe(SubscribeOptions{Filter: &Filter{TokenTypes: []v1parser.TokenType{v1parser.TokenTypeNft1Group81}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genesis := testGenesis(t, 0x01, []wire.OutPoint{{Index: 1}}, 1000, true)
+	id := testTokenID(genesis)
+	b0 := testBlock(nil, genesis)
+	results, err := idx.ConnectBlock(b0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.BlockConnected(b0.BlockHash(), 0, results)
+
+	send := testSend(t, 0x01, id, []wire.OutPoint{{Hash: genesis.TxHash(), Index: 1}}, 600, 300)
+	b1 := testBlock(b0, send)
+	results, err = idx.ConnectBlock(b1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.BlockConnected(b1.BlockHash(), 1, results)
+
+	events := readAll(t, sub)
+	if types := eventTypes(events); !sameTypes(types, []EventType{TypeSend, TypeBurn}) {
+		t.Fatalf("unexpected filtered events %v", types)
+	}
+	if c := events[1].Info().Cursor; c.Height != 1 || c.Seq != 3 {
+		t.Errorf("unexpected cursor %+v", c)
+	}
+	if events := readAll(t, nft); len(events) != 0 {
+		t.Errorf("expected no NFT events, got %v", eventTypes(events))
+	}
+
+	f := &Filter{PkScripts: [][]byte{testPkScript}, TokenIDs: []tokenindex.TokenID{id}}
+	if !f.Match(events[0]) {
+		t.Error("expected script and token to match")
+	}
+	f.PkScripts = [][]byte{{0x52}}
+	if f.Match(events[0]) {
+		t.Error("expected other script not to match")
+	}
+	if !f.Match(&ReorgEvent{}) {
+		t.Error("expected reorg to pass token and script filters")
+	}
+}
+
+func TestBusResume(t *testing.T) {
+	bus := NewBus(0)
+	for h := int32(0); h < 3; h++ {
+		bus.publish([]Event{testEvent(1, h), testEvent(2, h)})
+	}
+
+	from := int32(1)
+	sub, err := bus.Subscribe(SubscribeOptions{FromHeight: &from, Filter: &Filter{TokenIDs: []tokenindex.TokenID{{2}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := readAll(t, sub)
+	if len(events) != 2 || events[0].Info().Height != 1 || events[1].Info().Height != 2 {
+		t.Fatalf("unexpected resumed events %v", events)
+	}
+
+	sub, err = bus.Subscribe(SubscribeOptions{After: &events[0].Info().Cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events := readAll(t, sub); len(events) != 2 {
+		t.Errorf("expected 2 events after cursor, got %d", len(events))
+	}
+
+	// block 2 is replaced, resuming from height 2 skips the orphaned events
+	bus.BlockDisconnected(&tokenindex.BlockUndo{Height: 2})
+	bus.publish([]Event{testEvent(3, 2)})
+	from = 2
+	sub, err = bus.Subscribe(SubscribeOptions{FromHeight: &from})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events = readAll(t, sub)
+	if len(events) != 1 || events[0].Info().TokenID != (tokenindex.TokenID{3}) {
+		t.Errorf("expected only the replacement block, got %v", events)
+	}
+
+	// resuming below the reorg sees it after the orphaned events
+	from = 1
+	sub, err = bus.Subscribe(SubscribeOptions{FromHeight: &from})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if types := eventTypes(readAll(t, sub)); !sameTypes(types, []EventType{TypeSend, TypeSend, TypeSend, TypeSend, TypeReorg, TypeSend}) {
+		t.Errorf("unexpected events %v", types)
+	}
+}
+
+func TestBusCursorTooOld(t *testing.T) {
+	bus := NewBus(2)
+	for h := int32(0); h < 4; h++ {
+		bus.publish([]Event{testEvent(1, h)})
+	}
+	from := int32(1)
+	if _, err := bus.Subscribe(SubscribeOptions{FromHeight: &from}); err != ErrCursorTooOld {
+		t.Errorf("expected ErrCursorTooOld, got %v", err)
+	}
+	if _, err := bus.Subscribe(SubscribeOptions{After: &Cursor{}}); err != ErrCursorTooOld {
+		t.Errorf("expected ErrCursorTooOld, got %v", err)
+	}
+	from = 2
+	if _, err := bus.Subscribe(SubscribeOptions{FromHeight: &from}); err != nil {
+		t.Errorf("expected retained height to resume, got %v", err)
+	}
+}
+
+func TestBusBackpressure(t *testing.T) {
+	bus := NewBus(2)
+	drop, _ := bus.Subscribe(SubscribeOptions{Backpressure: BackpressureDrop})
+	disconnect, _ := bus.Subscribe(SubscribeOptions{Backpressure: BackpressureDisconnect})
+	for h := int32(0); h < 3; h++ {
+		bus.publish([]Event{testEvent(1, h)})
+	}
+
+	if n := drop.Dropped(); n != 1 {
+		t.Errorf("expected 1 dropped event, got %d", n)
+	}
+	if events := readAll(t, drop); len(events) != 2 || events[0].Info().Height != 1 {
+		t.Errorf("expected the retained events, got %v", events)
+	}
+	if _, err := disconnect.Next(context.Background()); err != ErrSlowSubscriber {
+		t.Errorf("expected ErrSlowSubscriber, got %v", err)
+	}
+
+	block, _ := bus.Subscribe(SubscribeOptions{Backpressure: BackpressureBlock})
+	bus.publish([]Event{testEvent(1, 3), testEvent(1, 4)})
+	done := make(chan struct{})
+	go func() {
+		bus.publish([]Event{testEvent(1, 5)})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected publish to wait for the subscriber")
+	case <-time.After(20 * time.Millisecond):
+	}
+	e, err := block.Next(context.Background())
+	if err != nil || e.Info().Height != 3 {
+		t.Fatalf("unexpected event %v %v", e, err)
+	}
+	<-done
+
+	block.Close()
+	if _, err := block.Next(context.Background()); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestBusBlockTimeout(t *testing.T) {
+	bus := NewBus(1)
+	stalled, _ := bus.Subscribe(SubscribeOptions{Backpressure: BackpressureBlock, BlockTimeout: 20 * time.Millisecond})
+	bus.publish([]Event{testEvent(1, 0)})
+
+	done := make(chan struct{})
+	go func() {
+		bus.publish([]Event{testEvent(1, 1)})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish blocked past the block timeout")
+	}
+	if _, err := stalled.Next(context.Background()); err != ErrSlowSubscriber {
+		t.Errorf("expected ErrSlowSubscriber, got %v", err)
+	}
+}
+
+func TestBusPublishOrder(t *testing.T) {
+	bus := NewBus(2)
+	sub, _ := bus.Subscribe(SubscribeOptions{Backpressure: BackpressureBlock})
+
+	// concurrent batches wait for the subscriber but are not interleaved
+	const batches, size = 4, 3
+	for i := 0; i < batches; i++ {
+		go func(id byte) {
+			batch := make([]Event, size)
+			for j := range batch {
+				batch[j] = testEvent(id, 0)
+			}
+			bus.publish(batch)
+		}(byte(i))
+	}
+	var last Event
+	for i := 0; i < batches*size; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		e, err := sub.Next(ctx)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%size != 0 && e.Info().TokenID != last.Info().TokenID {
+			t.Fatalf("event %d interleaves batch %x with batch %x", i, e.Info().TokenID[0], last.Info().TokenID[0])
+		}
+		if last != nil && e.Info().Cursor.Seq != last.Info().Cursor.Seq+1 {
+			t.Fatalf("expected consecutive sequences, got %d after %d", e.Info().Cursor.Seq, last.Info().Cursor.Seq)
+		}
+		last = e
+	}
+}
@@ -0,0 +1,254 @@
+package events
+
+import (
+	"math/big"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+// EventType identifies the kind of an Event
+type EventType int
+
+const (
+	// TypeGenesis is emitted for a valid GENESIS
+	TypeGenesis EventType = iota
+
+	// TypeMint is emitted for a valid MINT
+	TypeMint
+
+	// TypeSend is emitted for a valid SEND
+	TypeSend
+
+	// TypeBurn is emitted for every token amount burned by a transaction
+	TypeBurn
+
+	// TypeBatonMoved is emitted when a mint baton is created, moved or
+	// destroyed
+	TypeBatonMoved
+
+	// TypeNFTChildCreated is emitted for a valid NFT1 child genesis
+	TypeNFTChildCreated
+
+	// TypeReorg is emitted when a block is disconnected
+	TypeReorg
+)
+
+// String returns the name of the event type
+func (t EventType) String() string {
+	switch t {
+	case TypeGenesis:
+		return "genesis"
+	case TypeMint:
+		return "mint"
+	case TypeSend:
+		return "send"
+	case TypeBurn:
+		return "burn"
+	case TypeBatonMoved:
+		return "baton-moved"
+	case TypeNFTChildCreated:
+		return "nft-child-created"
+	case TypeReorg:
+		return "reorg"
+	}
+	return "unknown"
+}
+
+// Cursor is the position of an event in the stream, Seq increases with
+// every event published by a Bus
+type Cursor struct {
+	Height int32
+	Seq    uint64
+}
+
+// Event is implemented by every event type
+type Event interface {
+	Type() EventType
+	Info() *EventInfo
+}
+
+// EventInfo holds the fields shared by every event
+type EventInfo struct {
+	Cursor Cursor
+
+	TokenID   tokenindex.TokenID
+	TokenType v1parser.TokenType
+
+	TxHash    chainhash.Hash
+	BlockHash chainhash.Hash
+
+	// Height is -1 for unconfirmed transactions
+	Height int32
+
+	// PkScripts are the scripts of the token outputs created and spent
+	PkScripts [][]byte
+}
+
+// Info implements Event
+func (i *EventInfo) Info() *EventInfo {
+	return i
+}
+
+// Confirmed returns true for events of transactions in a block
+func (i *EventInfo) Confirmed() bool {
+	return i.Height >= 0
+}
+
+// GenesisEvent is a new token, Outputs has one entry per transaction
+// output and is nil for outputs without tokens
+type GenesisEvent struct {
+	EventInfo
+	Metadata *tokenindex.TokenMetadata
+	Quantity uint64
+	Outputs  []*tokenindex.TokenUtxo
+}
+
+// Type implements Event
+func (*GenesisEvent) Type() EventType { return TypeGenesis }
+
+// MintEvent is new supply of a token, Outputs has one entry per
+// transaction output and is nil for outputs without tokens
+type MintEvent struct {
+	EventInfo
+	Quantity uint64
+	Outputs  []*tokenindex.TokenUtxo
+}
+
+// Type implements Event
+func (*MintEvent) Type() EventType { return TypeMint }
+
+// SendEvent is a transfer of a token, Outputs has one entry per transaction
+// output and is nil for outputs without tokens
+type SendEvent struct {
+	EventInfo
+	Outputs []*tokenindex.TokenUtxo
+	Amount  *big.Int
+}
+
+// Type implements Event
+func (*SendEvent) Type() EventType { return TypeSend }
+
+// BurnEvent is an amount of a token destroyed
+type BurnEvent struct {
+	EventInfo
+	Category tokenindex.BurnCategory
+	Amount   *big.Int
+}
+
+// Type implements Event
+func (*BurnEvent) Type() EventType { return TypeBurn }
+
+// BatonMovedEvent is a mint baton created, moved or destroyed, From is nil
+// for a genesis and To is nil when the baton is destroyed
+type BatonMovedEvent struct {
+	EventInfo
+	From *wire.OutPoint
+	To   *wire.OutPoint
+}
+
+// Type implements Event
+func (*BatonMovedEvent) Type() EventType { return TypeBatonMoved }
+
+// NFTChildCreatedEvent is a new NFT1 child of the group GroupID
+type NFTChildCreatedEvent struct {
+	EventInfo
+	GroupID tokenindex.TokenID
+}
+
+// Type implements Event
+func (*NFTChildCreatedEvent) Type() EventType { return TypeNFTChildCreated }
+
+// ReorgEvent is a disconnected block, events at or above Height published
+// before it were for the disconnected chain
+type ReorgEvent struct {
+	EventInfo
+}
+
+// Type implements Event
+func (*ReorgEvent) Type() EventType { return TypeReorg }
+
+// TxEvents derives the events of a transaction result, blockHash and height
+// are zero and -1 for unconfirmed transactions
+func TxEvents(res *tokenindex.TxResult, blockHash chainhash.Hash, height int32) []Event {
+	info := func(id tokenindex.TokenID, tokenType v1parser.TokenType) EventInfo {
+		i := EventInfo{
+			TokenID:   id,
+			TokenType: tokenType,
+			TxHash:    res.TxHash,
+			BlockHash: blockHash,
+			Height:    height,
+		}
+		for _, u := range res.Outputs {
+			if u != nil && u.TokenID == id {
+				i.PkScripts = append(i.PkScripts, u.PkScript)
+			}
+		}
+		for _, s := range res.Spent {
+			if s.Utxo.TokenID == id {
+				i.PkScripts = append(i.PkScripts, s.Utxo.PkScript)
+			}
+		}
+		return i
+	}
+
+	var events []Event
+	if res.Valid {
+		base := info(res.TokenID, res.SlpMsg.TokenType())
+		var amount uint64
+		total := new(big.Int)
+		for _, u := range res.Outputs {
+			if u != nil {
+				amount += u.Amount
+				total.Add(total, new(big.Int).SetUint64(u.Amount))
+			}
+		}
+
+		switch res.SlpMsg.(type) {
+		case *v1parser.SlpGenesis:
+			events = append(events, &GenesisEvent{
+				EventInfo: base,
+				Metadata:  tokenindex.NewTokenMetadata(res, height),
+				Quantity:  amount,
+				Outputs:   res.Outputs,
+			})
+			if base.TokenType == v1parser.TokenTypeNft1Child41 && len(res.Spent) > 0 {
+				events = append(events, &NFTChildCreatedEvent{
+					EventInfo: base,
+					GroupID:   res.Spent[0].Utxo.TokenID,
+				})
+			}
+		case *v1parser.SlpMint:
+			events = append(events, &MintEvent{EventInfo: base, Quantity: amount, Outputs: res.Outputs})
+		case *v1parser.SlpSend:
+			events = append(events, &SendEvent{EventInfo: base, Outputs: res.Outputs, Amount: total})
+		}
+	}
+
+	for _, b := range res.Burns() {
+		events = append(events, &BurnEvent{
+			EventInfo: info(b.TokenID, b.TokenType),
+			Category:  b.Category,
+			Amount:    b.Amount,
+		})
+	}
+	for _, m := range res.BatonMoves() {
+		var tokenType v1parser.TokenType
+		if m.From == nil {
+			tokenType = res.SlpMsg.TokenType()
+		}
+		for _, s := range res.Spent {
+			if m.From != nil && s.OutPoint == *m.From {
+				tokenType = s.Utxo.TokenType
+			}
+		}
+		events = append(events, &BatonMovedEvent{
+			EventInfo: info(m.TokenID, tokenType),
+			From:      m.From,
+			To:        m.To,
+		})
+	}
+	return events
+}
@@ -0,0 +1,188 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+var testPkScript = []byte{0x51}
+
+// testTx creates a transaction spending spends with slpMsg at output 0
+// followed by n outputs
+func testTx(slpMsg []byte, spends []wire.OutPoint, n int) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	for i := range spends {
+		tx.AddTxIn(wire.NewTxIn(&spends[i], nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, slpMsg))
+	for i := 0; i < n; i++ {
+		tx.AddTxOut(wire.NewTxOut(546, testPkScript))
+	}
+	return tx
+}
+
+// testBlock creates a block extending prev, which may be nil
+func testBlock(prev *wire.MsgBlock, txs ...*wire.MsgTx) *wire.MsgBlock {
+	var prevHash chainhash.Hash
+	var nonce uint32
+	if prev != nil {
+		prevHash = prev.BlockHash()
+		nonce = prev.Header.Nonce + 1
+	}
+	block := wire.NewMsgBlock(wire.NewBlockHeader(1, &prevHash, &chainhash.Hash{}, 0, nonce))
+	for _, tx := range txs {
+		block.AddTransaction(tx)
+	}
+	return block
+}
+
+func testGenesis(t *testing.T, tokenType int, spends []wire.OutPoint, qty uint64, baton bool) *wire.MsgTx {
+	var batonVout *metadatamaker.MintBatonVout
+	if baton {
+		batonVout = metadatamaker.NewMintBatonVout(2)
+	}
+	slpMsg, err := metadatamaker.CreateOpReturnGenesis(tokenType, []byte("T"), []byte("test"), nil, nil, 0, batonVout, qty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testTx(slpMsg, spends, 2)
+}
+
+func testSend(t *testing.T, tokenType int, id tokenindex.TokenID, spends []wire.OutPoint, amounts ...uint64) *wire.MsgTx {
+	slpMsg, err := metadatamaker.CreateOpReturnSend(tokenType, id[:], amounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testTx(slpMsg, spends, len(amounts))
+}
+
+func testMint(t *testing.T, id tokenindex.TokenID, baton wire.OutPoint, qty uint64) *wire.MsgTx {
+	slpMsg, err := metadatamaker.CreateOpReturnMint(0x01, id[:], metadatamaker.NewMintBatonVout(2), qty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testTx(slpMsg, []wire.OutPoint{baton}, 2)
+}
+
+func testTokenID(tx *wire.MsgTx) tokenindex.TokenID {
+	hash := tx.TxHash()
+	var id tokenindex.TokenID
+	for i := range hash {
+		id[i] = hash[len(hash)-1-i]
+	}
+	return id
+}
+
+func eventTypes(events []Event) []EventType {
+	var types []EventType
+	for _, e := range events {
+		types = append(types, e.Type())
+	}
+	return types
+}
+
+func sameTypes(a, b []EventType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTxEvents(t *testing.T) {
+	idx := tokenindex.New()
+	genesis := testGenesis(t, 0x01, []wire.OutPoint{{Index: 1}}, 1000, true)
+	id := testTokenID(genesis)
+	b0 := testBlock(nil, genesis)
+	results, err := idx.ConnectBlock(b0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := TxEvents(results[0], b0.BlockHash(), 0)
+	if types := eventTypes(events); !sameTypes(types, []EventType{TypeGenesis, TypeBatonMoved}) {
+		t.Fatalf("unexpected genesis events %v", types)
+	}
+	g := events[0].(*GenesisEvent)
+	if g.TokenID != id || g.Quantity != 1000 || g.Metadata == nil || string(g.Metadata.Ticker) != "T" {
+		t.Errorf("unexpected genesis event %+v", g)
+	}
+	if len(g.Outputs) != 3 || g.Outputs[1].Amount != 1000 || !g.Outputs[2].IsMintBaton {
+		t.Errorf("unexpected genesis outputs %+v", g.Outputs)
+	}
+	if m := events[1].(*BatonMovedEvent); m.From != nil || m.To == nil || m.TokenType != v1parser.TokenTypeFungible01 {
+		t.Errorf("unexpected baton event %+v", m)
+	}
+
+	// the send burns the 100 tokens it does not assign
+	gHash := genesis.TxHash()
+	send := testSend(t, 0x01, id, []wire.OutPoint{{Hash: gHash, Index: 1}}, 600, 300)
+	mint := testMint(t, id, wire.OutPoint{Hash: gHash, Index: 2}, 50)
+	b1 := testBlock(b0, send, mint)
+	results, err = idx.ConnectBlock(b1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		events := TxEvents(res, b1.BlockHash(), 1)
+		switch res.TxHash {
+		case send.TxHash():
+			if types := eventTypes(events); !sameTypes(types, []EventType{TypeSend, TypeBurn}) {
+				t.Fatalf("unexpected send events %v", types)
+			}
+			if s := events[0].(*SendEvent); s.Amount.Uint64() != 900 || len(s.PkScripts) != 3 {
+				t.Errorf("unexpected send event %+v", s)
+			}
+			if b := events[1].(*BurnEvent); b.Category != tokenindex.BurnSendExcess || b.Amount.Uint64() != 100 {
+				t.Errorf("unexpected burn event %+v", b)
+			}
+		case mint.TxHash():
+			if types := eventTypes(events); !sameTypes(types, []EventType{TypeMint, TypeBatonMoved}) {
+				t.Fatalf("unexpected mint events %v", types)
+			}
+			m := events[1].(*BatonMovedEvent)
+			if m.From == nil || *m.From != (wire.OutPoint{Hash: gHash, Index: 2}) || m.To == nil || m.To.Hash != mint.TxHash() {
+				t.Errorf("unexpected baton move %+v", m)
+			}
+			if !m.Confirmed() || m.BlockHash != b1.BlockHash() {
+				t.Error("expected confirmed event")
+			}
+		}
+	}
+}
+
+func TestTxEventsNFTChild(t *testing.T) {
+	idx := tokenindex.New()
+	group := testGenesis(t, 0x81, []wire.OutPoint{{Index: 2}}, 10, false)
+	groupID := testTokenID(group)
+	child := testGenesis(t, 0x41, []wire.OutPoint{{Hash: group.TxHash(), Index: 1}}, 1, false)
+	if _, err := idx.ConnectBlock(testBlock(nil, group), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	mp := tokenindex.NewMempool(idx.Lookup)
+	res, err := mp.AddTx(child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := TxEvents(res, chainhash.Hash{}, -1)
+	if types := eventTypes(events); !sameTypes(types, []EventType{TypeGenesis, TypeNFTChildCreated, TypeBurn}) {
+		t.Fatalf("unexpected child genesis events %v", types)
+	}
+	c := events[1].(*NFTChildCreatedEvent)
+	if c.GroupID != groupID || c.TokenID != testTokenID(child) || c.Confirmed() {
+		t.Errorf("unexpected child event %+v", c)
+	}
+	if b := events[2].(*BurnEvent); b.TokenID != groupID || b.Amount.Uint64() != 10 {
+		t.Errorf("expected group input burned, got %+v", b)
+	}
+}
@@ -4,5 +4,10 @@ go 1.15
 
 require (
 	github.com/dvyukov/go-fuzz v0.0.0-20210103155950-6a8e9d1f2415 // indirect
-	github.com/gcash/bchd v0.17.1
+	github.com/gcash/bchd v0.18.1
+	github.com/gcash/bchutil v0.0.0-20210113190856-6ea28dff4000
+	github.com/gorilla/websocket v1.4.2
+	github.com/syndtr/goleveldb v1.0.1-0.20190923125748-758128399b1d
+	google.golang.org/grpc v1.38.0
+	gopkg.in/yaml.v2 v2.4.0
 )
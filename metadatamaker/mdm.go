@@ -12,6 +12,11 @@ type MintBatonVout struct {
 	vout int
 }
 
+// NewMintBatonVout creates a MintBatonVout for the given output index
+func NewMintBatonVout(vout int) *MintBatonVout {
+	return &MintBatonVout{vout: vout}
+}
+
 // CreateOpReturnGenesis creates serialized Genesis op_return message
 func CreateOpReturnGenesis(
 	versionType int,
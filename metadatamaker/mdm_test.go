@@ -98,3 +98,17 @@ func TestCreateOpReturnSend(t *testing.T) {
 		t.Error(err.Error())
 	}
 }
+
+func TestNewMintBatonVout(t *testing.T) {
+	slpMsg, err := CreateOpReturnMint(1, make([]byte, 32), NewMintBatonVout(3), 10)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	res, err := v1parser.ParseSLP(slpMsg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.(*v1parser.SlpMint).MintBatonVout != 3 {
+		t.Error("incorrect mint baton vout")
+	}
+}
@@ -0,0 +1,55 @@
+package goslp
+
+import (
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+// TokenOutput describes the tokens carried by a single transaction output
+type TokenOutput struct {
+	TokenID     []byte
+	TokenType   v1parser.TokenType
+	Amount      uint64
+	IsMintBaton bool
+}
+
+// GetTokenOutputs classifies each output of tx using the SLP message in
+// output 0. The returned slice has one entry per output, nil for outputs
+// without tokens. SLP validity of the transaction is not checked, a nil
+// ParseResult is returned for non-SLP transactions.
+func GetTokenOutputs(tx *wire.MsgTx) ([]*TokenOutput, v1parser.ParseResult, error) {
+	outputs := make([]*TokenOutput, len(tx.TxOut))
+	if len(tx.TxOut) == 0 {
+		return outputs, nil, nil
+	}
+
+	slpMsg, err := v1parser.ParseSLP(tx.TxOut[0].PkScript)
+	if err != nil {
+		return outputs, nil, nil
+	}
+
+	tokenID, err := GetSlpTokenID(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for vout := 1; vout < len(tx.TxOut); vout++ {
+		amt, isBaton := slpMsg.GetVoutValue(vout)
+		if amt == nil && !isBaton {
+			continue
+		}
+		out := &TokenOutput{
+			TokenID:     tokenID,
+			TokenType:   slpMsg.TokenType(),
+			IsMintBaton: isBaton,
+		}
+		if amt != nil {
+			if amt.Sign() == 0 {
+				continue
+			}
+			out.Amount = amt.Uint64()
+		}
+		outputs[vout] = out
+	}
+	return outputs, slpMsg, nil
+}
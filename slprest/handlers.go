@@ -0,0 +1,613 @@
+package slprest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp"
+	"github.com/simpleledgerinc/goslp/address"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+	"github.com/simpleledgerinc/goslp/txsource"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+var routes []*route
+
+func init() {
+	routes = []*route{
+		{
+			pattern:  "/v1/tokens/{tokenId}",
+			summary:  "Token metadata and supply",
+			response: &Token{},
+			handle:   (*Server).token,
+		},
+		{
+			pattern:  "/v1/tokens/{tokenId}/utxos",
+			summary:  "Confirmed unspent outputs of a token ordered by outpoint",
+			paged:    true,
+			response: &UtxoPage{},
+			handle:   (*Server).tokenUtxos,
+		},
+		{
+			pattern: "/v1/tokens/{tokenId}/holders",
+			summary: "Holders of a token ordered by descending balance",
+			query: []*queryParam{
+				{name: "height", typ: "integer", description: "block height of the snapshot, the tip when unset"},
+			},
+			paged:    true,
+			response: &HolderPage{},
+			handle:   (*Server).holders,
+		},
+		{
+			pattern:  "/v1/addresses/{address}/balances",
+			summary:  "Token balances of an address",
+			response: &AddressBalances{},
+			handle:   (*Server).balances,
+		},
+		{
+			pattern:  "/v1/addresses/{address}/utxos",
+			summary:  "Unspent token outputs of an address with unconfirmed transactions applied",
+			paged:    true,
+			response: &UtxoPage{},
+			handle:   (*Server).addressUtxos,
+		},
+		{
+			pattern:  "/v1/transactions/{txid}",
+			summary:  "Transaction with its parsed SLP message and token inputs and outputs",
+			response: &Transaction{},
+			handle:   (*Server).transaction,
+		},
+		{
+			pattern:  "/v1/openapi.json",
+			summary:  "This document",
+			response: map[string]interface{}{},
+			handle: func(s *Server, r *request) (interface{}, error) {
+				return OpenAPI(), nil
+			},
+		},
+	}
+}
+
+// Token is the genesis metadata and supply of a token
+type Token struct {
+	TokenID       string `json:"tokenId"`
+	TokenType     int    `json:"tokenType"`
+	Ticker        string `json:"ticker"`
+	Name          string `json:"name"`
+	DocumentURI   string `json:"documentUri"`
+	DocumentHash  string `json:"documentHash,omitempty"`
+	Decimals      int    `json:"decimals"`
+	GenesisTxID   string `json:"genesisTxid"`
+	GenesisHeight int32  `json:"genesisHeight"`
+	GroupID       string `json:"groupId,omitempty"`
+
+	GenesisQuantity string `json:"genesisQuantity"`
+	Minted          string `json:"minted"`
+	Burned          string `json:"burned"`
+	Circulating     string `json:"circulating"`
+	Outputs         int    `json:"outputs"`
+	Addresses       int    `json:"addresses"`
+	Baton           string `json:"baton,omitempty"`
+}
+
+// Utxo is an unspent token output
+type Utxo struct {
+	OutPoint    string `json:"outpoint"`
+	TokenID     string `json:"tokenId"`
+	TokenType   int    `json:"tokenType"`
+	Amount      string `json:"amount"`
+	IsMintBaton bool   `json:"isMintBaton"`
+	Value       int64  `json:"value"`
+	Address     string `json:"address,omitempty"`
+
+	// Height is -1 for outputs of unconfirmed transactions
+	Height       int32 `json:"height"`
+	ZeroConfRisk bool  `json:"zeroConfRisk,omitempty"`
+}
+
+// UtxoPage is a page of unspent outputs
+type UtxoPage struct {
+	Utxos []*Utxo `json:"utxos"`
+	Next  string  `json:"next,omitempty"`
+}
+
+// Holder is the balance of one output script
+type Holder struct {
+	Address  string `json:"address,omitempty"`
+	PkScript string `json:"pkScript"`
+	Balance  string `json:"balance"`
+	Outputs  int    `json:"outputs"`
+}
+
+// HolderPage is a page of the holders of a token at a block
+type HolderPage struct {
+	TokenID   string    `json:"tokenId"`
+	Height    int32     `json:"height"`
+	BlockHash string    `json:"blockHash"`
+	Holders   []*Holder `json:"holders"`
+	Next      string    `json:"next,omitempty"`
+}
+
+// Balance is the amount of one token held by an address
+type Balance struct {
+	TokenID   string `json:"tokenId"`
+	TokenType int    `json:"tokenType"`
+	Ticker    string `json:"ticker"`
+	Decimals  int    `json:"decimals"`
+
+	// Confirmed counts confirmed outputs only, Unconfirmed applies the
+	// unconfirmed transactions
+	Confirmed   string `json:"confirmed"`
+	Unconfirmed string `json:"unconfirmed"`
+
+	Outputs    int `json:"outputs"`
+	MintBatons int `json:"mintBatons"`
+}
+
+// AddressBalances are the token balances of an address ordered by token id
+type AddressBalances struct {
+	Address  string     `json:"address"`
+	Balances []*Balance `json:"balances"`
+}
+
+// Transaction is a transaction with its SLP information
+type Transaction struct {
+	TxID string `json:"txid"`
+
+	// Height is -1 for unconfirmed transactions
+	Height        int32  `json:"height"`
+	BlockHash     string `json:"blockHash,omitempty"`
+	Confirmations int32  `json:"confirmations"`
+
+	// Slp is nil for transactions without an SLP OP_RETURN
+	Slp     *SlpInfo  `json:"slp,omitempty"`
+	Inputs  []*Input  `json:"inputs"`
+	Outputs []*Output `json:"outputs"`
+}
+
+// SlpInfo is the parsed SLP message of a transaction
+type SlpInfo struct {
+	Valid      bool   `json:"valid"`
+	ParseError string `json:"parseError,omitempty"`
+	TxType     string `json:"txType,omitempty"`
+	TokenType  int    `json:"tokenType,omitempty"`
+	TokenID    string `json:"tokenId,omitempty"`
+
+	// Ticker, Name, DocumentURI, DocumentHash and Decimals are set for
+	// GENESIS transactions
+	Ticker       string `json:"ticker,omitempty"`
+	Name         string `json:"name,omitempty"`
+	DocumentURI  string `json:"documentUri,omitempty"`
+	DocumentHash string `json:"documentHash,omitempty"`
+	Decimals     int    `json:"decimals,omitempty"`
+
+	// Amounts are the SEND amounts or the GENESIS and MINT quantity
+	Amounts       []string `json:"amounts,omitempty"`
+	MintBatonVout int      `json:"mintBatonVout,omitempty"`
+}
+
+// TokenAmount is the token carried by an input or output
+type TokenAmount struct {
+	TokenID     string `json:"tokenId"`
+	Amount      string `json:"amount"`
+	IsMintBaton bool   `json:"isMintBaton,omitempty"`
+}
+
+// Input is a transaction input, Token is set when it spends tokens of a
+// valid transaction
+type Input struct {
+	OutPoint string       `json:"outpoint"`
+	Token    *TokenAmount `json:"token,omitempty"`
+}
+
+// Output is a transaction output, Token is set for token outputs of a
+// valid transaction
+type Output struct {
+	Vout     int          `json:"vout"`
+	Value    int64        `json:"value"`
+	PkScript string       `json:"pkScript"`
+	Address  string       `json:"address,omitempty"`
+	Token    *TokenAmount `json:"token,omitempty"`
+}
+
+// tokenID parses the tokenId path parameter
+func (r *request) tokenID() (tokenindex.TokenID, error) {
+	b, err := hex.DecodeString(r.vars["tokenId"])
+	if err == nil {
+		var id tokenindex.TokenID
+		if id, err = tokenindex.NewTokenID(b); err == nil {
+			return id, nil
+		}
+	}
+	return tokenindex.TokenID{}, errorf(http.StatusBadRequest, "invalid token id %q", r.vars["tokenId"])
+}
+
+// address parses the address path parameter, any address form is accepted
+func (s *Server) address(r *request) (*address.Address, error) {
+	addr, err := address.Decode(r.vars["address"], s.cfg.Params)
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid address %q: %v", r.vars["address"], err)
+	}
+	return addr, nil
+}
+
+// addressOf returns the simpleledger address paid by pkScript, empty when
+// it pays no address
+func (s *Server) addressOf(pkScript []byte) string {
+	addr, err := address.FromPkScript(pkScript, s.cfg.Params)
+	if err != nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// bigString returns the decimal form of n, 0 when n is nil
+func bigString(n *big.Int) string {
+	if n == nil {
+		return "0"
+	}
+	return n.String()
+}
+
+func (s *Server) token(r *request) (interface{}, error) {
+	id, err := r.tokenID()
+	if err != nil {
+		return nil, err
+	}
+	meta := s.cfg.Index.Metadata(id)
+	if meta == nil {
+		return nil, errorf(http.StatusNotFound, "token %s not found", id)
+	}
+	t := &Token{
+		TokenID:         id.String(),
+		TokenType:       int(meta.TokenType),
+		Ticker:          string(meta.Ticker),
+		Name:            string(meta.Name),
+		DocumentURI:     string(meta.DocumentURI),
+		DocumentHash:    hex.EncodeToString(meta.DocumentHash),
+		Decimals:        meta.Decimals,
+		GenesisTxID:     meta.GenesisTx.String(),
+		GenesisHeight:   meta.GenesisHeight,
+		GenesisQuantity: "0",
+		Minted:          "0",
+		Burned:          "0",
+		Circulating:     "0",
+	}
+	if meta.GroupID != nil {
+		t.GroupID = meta.GroupID.String()
+	}
+	if stats := s.cfg.Index.TokenStats(id); stats != nil {
+		t.GenesisQuantity = strconv.FormatUint(stats.GenesisQuantity, 10)
+		t.Minted = bigString(stats.Minted)
+		t.Burned = bigString(stats.Burned)
+		t.Circulating = bigString(stats.Circulating)
+		t.Outputs = stats.Outputs
+		t.Addresses = stats.Addresses
+		if stats.Baton != nil {
+			t.Baton = stats.Baton.String()
+		}
+	}
+	return t, nil
+}
+
+// utxo marshals a token output, height is -1 for unconfirmed outputs
+func (s *Server) utxo(op wire.OutPoint, u *tokenindex.TokenUtxo, unconfirmed, risk bool) *Utxo {
+	height := u.Height
+	if unconfirmed {
+		height = -1
+	}
+	return &Utxo{
+		OutPoint:     op.String(),
+		TokenID:      u.TokenID.String(),
+		TokenType:    int(u.TokenType),
+		Amount:       strconv.FormatUint(u.Amount, 10),
+		IsMintBaton:  u.IsMintBaton,
+		Value:        u.Value,
+		Address:      s.addressOf(u.PkScript),
+		Height:       height,
+		ZeroConfRisk: risk,
+	}
+}
+
+// lessOutPoint orders outpoints by txid bytes then index like
+// Index.TokenUtxos
+func lessOutPoint(a, b wire.OutPoint) bool {
+	if c := bytes.Compare(a.Hash[:], b.Hash[:]); c != 0 {
+		return c < 0
+	}
+	return a.Index < b.Index
+}
+
+// utxoPage pages utxos ordered by outpoint
+func (s *Server) utxoPage(r *request, utxos []*tokenindex.MempoolUtxo) (*UtxoPage, error) {
+	parts, err := r.cursor(2)
+	if err != nil {
+		return nil, err
+	}
+	var after func(i int) bool
+	if parts != nil {
+		hash, err := chainhash.NewHashFromStr(parts[0])
+		vout, verr := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil || verr != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid cursor")
+		}
+		last := wire.OutPoint{Hash: *hash, Index: uint32(vout)}
+		after = func(i int) bool {
+			return lessOutPoint(last, utxos[i].OutPoint)
+		}
+	}
+	start, end, next, err := r.page(len(utxos), after, func(i int) string {
+		op := utxos[i].OutPoint
+		return encodeCursor(op.Hash.String(), strconv.FormatUint(uint64(op.Index), 10))
+	})
+	if err != nil {
+		return nil, err
+	}
+	page := &UtxoPage{Utxos: make([]*Utxo, 0, end-start), Next: next}
+	for _, u := range utxos[start:end] {
+		page.Utxos = append(page.Utxos, s.utxo(u.OutPoint, u.Utxo, u.Unconfirmed, u.ZeroConfRisk))
+	}
+	return page, nil
+}
+
+func (s *Server) tokenUtxos(r *request) (interface{}, error) {
+	id, err := r.tokenID()
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.Index.Metadata(id) == nil {
+		return nil, errorf(http.StatusNotFound, "token %s not found", id)
+	}
+	var utxos []*tokenindex.MempoolUtxo
+	for _, u := range s.cfg.Index.TokenUtxos(id) {
+		utxos = append(utxos, &tokenindex.MempoolUtxo{OutPoint: u.OutPoint, Utxo: u.Utxo})
+	}
+	return s.utxoPage(r, utxos)
+}
+
+// scriptUtxos returns the token outputs of pkScript ordered by outpoint
+// with unconfirmed transactions applied
+func (s *Server) scriptUtxos(pkScript []byte) []*tokenindex.MempoolUtxo {
+	var utxos []*tokenindex.MempoolUtxo
+	for _, u := range s.cfg.Index.ScriptUtxos(pkScript) {
+		if s.cfg.Mempool != nil && s.cfg.Mempool.Utxo(u.OutPoint) == nil {
+			// spent by an unconfirmed transaction
+			continue
+		}
+		utxos = append(utxos, &tokenindex.MempoolUtxo{OutPoint: u.OutPoint, Utxo: u.Utxo})
+	}
+	if s.cfg.Mempool != nil {
+		utxos = append(utxos, s.cfg.Mempool.ScriptUtxos(pkScript)...)
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		return lessOutPoint(utxos[i].OutPoint, utxos[j].OutPoint)
+	})
+	return utxos
+}
+
+func (s *Server) addressUtxos(r *request) (interface{}, error) {
+	addr, err := s.address(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.utxoPage(r, s.scriptUtxos(addr.PkScript()))
+}
+
+func (s *Server) balances(r *request) (interface{}, error) {
+	addr, err := s.address(r)
+	if err != nil {
+		return nil, err
+	}
+	pkScript := addr.PkScript()
+	byToken := make(map[tokenindex.TokenID]*Balance)
+	confirmed := make(map[tokenindex.TokenID]*big.Int)
+	unconfirmed := make(map[tokenindex.TokenID]*big.Int)
+	balance := func(u *tokenindex.TokenUtxo) *Balance {
+		b, ok := byToken[u.TokenID]
+		if !ok {
+			b = &Balance{TokenID: u.TokenID.String(), TokenType: int(u.TokenType)}
+			if meta := s.cfg.Index.Metadata(u.TokenID); meta != nil {
+				b.Ticker = string(meta.Ticker)
+				b.Decimals = meta.Decimals
+			}
+			byToken[u.TokenID] = b
+			confirmed[u.TokenID] = new(big.Int)
+			unconfirmed[u.TokenID] = new(big.Int)
+		}
+		return b
+	}
+	for _, u := range s.cfg.Index.ScriptUtxos(pkScript) {
+		balance(u.Utxo)
+		confirmed[u.Utxo.TokenID].Add(confirmed[u.Utxo.TokenID], new(big.Int).SetUint64(u.Utxo.Amount))
+	}
+	for _, u := range s.scriptUtxos(pkScript) {
+		b := balance(u.Utxo)
+		unconfirmed[u.Utxo.TokenID].Add(unconfirmed[u.Utxo.TokenID], new(big.Int).SetUint64(u.Utxo.Amount))
+		if u.Utxo.IsMintBaton {
+			b.MintBatons++
+		} else {
+			b.Outputs++
+		}
+	}
+
+	resp := &AddressBalances{Address: addr.String(), Balances: make([]*Balance, 0, len(byToken))}
+	for id, b := range byToken {
+		b.Confirmed = confirmed[id].String()
+		b.Unconfirmed = unconfirmed[id].String()
+		resp.Balances = append(resp.Balances, b)
+	}
+	sort.Slice(resp.Balances, func(i, j int) bool {
+		return resp.Balances[i].TokenID < resp.Balances[j].TokenID
+	})
+	return resp, nil
+}
+
+func (s *Server) holders(r *request) (interface{}, error) {
+	id, err := r.tokenID()
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.Index.Metadata(id) == nil {
+		return nil, errorf(http.StatusNotFound, "token %s not found", id)
+	}
+	_, height := s.cfg.Index.Tip()
+	if v := r.URL.Query().Get("height"); v != "" {
+		h, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid height %q", v)
+		}
+		height = int32(h)
+	}
+	snap, err := s.cfg.Index.Holders(id, height, &tokenindex.HolderOptions{Params: s.cfg.Params})
+	if err == tokenindex.ErrUnknownBlock || err == tokenindex.ErrRewindTooDeep {
+		return nil, errorf(http.StatusNotFound, "no holders at height %d: %v", height, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := r.cursor(2)
+	if err != nil {
+		return nil, err
+	}
+	var after func(i int) bool
+	if parts != nil {
+		balance, err := strconv.ParseUint(parts[0], 10, 64)
+		script, serr := hex.DecodeString(parts[1])
+		if err != nil || serr != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid cursor")
+		}
+		after = func(i int) bool {
+			h := snap.Holders[i]
+			return h.Balance < balance || (h.Balance == balance && bytes.Compare(h.PkScript, script) > 0)
+		}
+	}
+	start, end, next, err := r.page(len(snap.Holders), after, func(i int) string {
+		h := snap.Holders[i]
+		return encodeCursor(strconv.FormatUint(h.Balance, 10), hex.EncodeToString(h.PkScript))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	page := &HolderPage{
+		TokenID:   id.String(),
+		Height:    snap.Height,
+		BlockHash: snap.Hash.String(),
+		Holders:   make([]*Holder, 0, end-start),
+		Next:      next,
+	}
+	for _, h := range snap.Holders[start:end] {
+		page.Holders = append(page.Holders, &Holder{
+			Address:  h.Address,
+			PkScript: hex.EncodeToString(h.PkScript),
+			Balance:  strconv.FormatUint(h.Balance, 10),
+			Outputs:  len(h.Outputs),
+		})
+	}
+	return page, nil
+}
+
+func tokenAmount(out *goslp.TokenOutput) *TokenAmount {
+	id, _ := tokenindex.NewTokenID(out.TokenID)
+	return &TokenAmount{
+		TokenID:     id.String(),
+		Amount:      strconv.FormatUint(out.Amount, 10),
+		IsMintBaton: out.IsMintBaton,
+	}
+}
+
+func (s *Server) transaction(r *request) (interface{}, error) {
+	hash, err := chainhash.NewHashFromStr(r.vars["txid"])
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid txid %q", r.vars["txid"])
+	}
+	info, ok := s.txs.Tx(*hash)
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "transaction %s not found", hash)
+	}
+
+	resp := &Transaction{TxID: hash.String(), Height: -1, Slp: slpInfo(info)}
+	if info.Header != nil {
+		resp.Height = info.Height
+		resp.BlockHash = info.Header.BlockHash().String()
+		if _, tip := s.cfg.Index.Tip(); tip >= info.Height {
+			resp.Confirmations = tip - info.Height + 1
+		}
+	}
+
+	parents := make(map[chainhash.Hash][]*goslp.TokenOutput)
+	for _, in := range info.Tx.TxIn {
+		op := in.PreviousOutPoint
+		input := &Input{OutPoint: op.String()}
+		outputs, ok := parents[op.Hash]
+		if !ok {
+			if parent, found := s.txs.Tx(op.Hash); found {
+				outputs = parent.TokenOutputs()
+			}
+			parents[op.Hash] = outputs
+		}
+		if int(op.Index) < len(outputs) && outputs[op.Index] != nil {
+			input.Token = tokenAmount(outputs[op.Index])
+		}
+		resp.Inputs = append(resp.Inputs, input)
+	}
+
+	outputs := info.TokenOutputs()
+	for i, out := range info.Tx.TxOut {
+		output := &Output{
+			Vout:     i,
+			Value:    out.Value,
+			PkScript: hex.EncodeToString(out.PkScript),
+			Address:  s.addressOf(out.PkScript),
+		}
+		if i < len(outputs) && outputs[i] != nil {
+			output.Token = tokenAmount(outputs[i])
+		}
+		resp.Outputs = append(resp.Outputs, output)
+	}
+	return resp, nil
+}
+
+// slpInfo parses the SLP message of a transaction, nil when it has none
+func slpInfo(info *txsource.Info) *SlpInfo {
+	if len(info.Tx.TxOut) == 0 || !goslp.HasSlpLokadPrefix(info.Tx.TxOut[0].PkScript) {
+		return nil
+	}
+	slpMsg, err := v1parser.ParseSLP(info.Tx.TxOut[0].PkScript)
+	if err != nil {
+		return &SlpInfo{ParseError: err.Error()}
+	}
+	res := &SlpInfo{Valid: info.Valid, TokenType: int(slpMsg.TokenType())}
+	if id, err := goslp.GetSlpTokenID(info.Tx); err == nil {
+		tokenID, _ := tokenindex.NewTokenID(id)
+		res.TokenID = tokenID.String()
+	}
+	switch msg := slpMsg.(type) {
+	case *v1parser.SlpGenesis:
+		res.TxType = "GENESIS"
+		res.Ticker = string(msg.Ticker)
+		res.Name = string(msg.Name)
+		res.DocumentURI = string(msg.DocumentURI)
+		res.DocumentHash = hex.EncodeToString(msg.DocumentHash)
+		res.Decimals = msg.Decimals
+		res.Amounts = []string{strconv.FormatUint(msg.Qty, 10)}
+		res.MintBatonVout = msg.MintBatonVout
+	case *v1parser.SlpMint:
+		res.TxType = "MINT"
+		res.Amounts = []string{strconv.FormatUint(msg.Qty, 10)}
+		res.MintBatonVout = msg.MintBatonVout
+	case *v1parser.SlpSend:
+		res.TxType = "SEND"
+		for _, amount := range msg.Amounts {
+			res.Amounts = append(res.Amounts, strconv.FormatUint(amount, 10))
+		}
+	}
+	return res
+}
@@ -0,0 +1,149 @@
+package slprest
+
+import (
+	"reflect"
+	"strings"
+)
+
+// OpenAPI returns the OpenAPI 3 document of the API, generated from the
+// routes and the types of their responses
+func OpenAPI() map[string]interface{} {
+	schemas := map[string]interface{}{
+		"Error": structSchema(reflect.TypeOf(errorBody{}), nil),
+	}
+	paths := make(map[string]interface{})
+	for _, rt := range routes {
+		var params []interface{}
+		for _, seg := range strings.Split(rt.pattern, "/") {
+			if strings.HasPrefix(seg, "{") {
+				params = append(params, map[string]interface{}{
+					"name":     strings.Trim(seg, "{}"),
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]interface{}{"type": "string"},
+				})
+			}
+		}
+		query := rt.query
+		if rt.paged {
+			query = append(query[:len(query):len(query)],
+				&queryParam{name: "limit", typ: "integer", description: "page size, at most 1000"},
+				&queryParam{name: "cursor", typ: "string", description: "next cursor of the previous page"},
+			)
+		}
+		for _, q := range query {
+			params = append(params, map[string]interface{}{
+				"name":        q.name,
+				"in":          "query",
+				"description": q.description,
+				"schema":      map[string]interface{}{"type": q.typ},
+			})
+		}
+
+		errResp := map[string]interface{}{
+			"description": "error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+				},
+			},
+		}
+		op := map[string]interface{}{
+			"summary": rt.summary,
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "OK, the ETag header identifies the body",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{
+							"schema": schemaOf(reflect.TypeOf(rt.response), schemas),
+						},
+					},
+				},
+				"304":     map[string]interface{}{"description": "the If-None-Match header lists the current ETag"},
+				"default": errResp,
+			},
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		paths[rt.pattern] = map[string]interface{}{"get": op}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "goslp token API",
+			"version":     "1",
+			"description": "Token amounts are decimal strings in base units.",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// schemaOf returns the schema of t, named struct types are added to
+// schemas and referenced when schemas is not nil
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object"}
+	case reflect.Struct:
+	default:
+		return map[string]interface{}{}
+	}
+
+	if schemas != nil && t.Name() != "" {
+		if _, ok := schemas[t.Name()]; !ok {
+			// reserve the name first so recursive types terminate
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return structSchema(t, schemas)
+}
+
+// structSchema returns the object schema of the exported fields of t
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	props := make(map[string]interface{})
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.PkgPath != "" || tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop := schemaOf(f.Type, schemas)
+		if strings.Contains(opts, ",string") {
+			prop = map[string]interface{}{"type": "string"}
+		}
+		props[name] = prop
+		if !strings.Contains(opts, ",omitempty") {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": props}
+	if required != nil {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,251 @@
+// Package slprest serves token metadata, balances, UTXOs, parsed
+// transactions and holder lists from a token index as a JSON HTTP API.
+// Token amounts are encoded as strings so clients never lose precision
+// above 2^53, list endpoints are paged with opaque cursors and every GET
+// response carries an ETag.
+package slprest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+	"github.com/simpleledgerinc/goslp/txsource"
+)
+
+const (
+	// DefaultLimit is the page size when a request sets no limit
+	DefaultLimit = 100
+
+	// MaxLimit is the largest page size a request may ask for
+	MaxLimit = 1000
+)
+
+// Config holds the sources a Server answers from
+type Config struct {
+	Index *tokenindex.Index
+
+	// Mempool adds unconfirmed transactions to balances, UTXOs and
+	// transactions, it may be nil
+	Mempool *tokenindex.Mempool
+
+	// Txs resolves confirmed transactions, transaction lookups return 404
+	// when it is nil
+	Txs txsource.Source
+
+	// Params encodes and decodes addresses, MainNetParams when nil
+	Params *chaincfg.Params
+}
+
+// Server is an http.Handler serving the API described by OpenAPI
+type Server struct {
+	cfg Config
+	txs *txsource.Lookup
+}
+
+// NewServer creates a Server
+func NewServer(cfg Config) *Server {
+	if cfg.Params == nil {
+		cfg.Params = &chaincfg.MainNetParams
+	}
+	return &Server{
+		cfg: cfg,
+		txs: &txsource.Lookup{Index: cfg.Index, Mempool: cfg.Mempool, Txs: cfg.Txs},
+	}
+}
+
+// apiError is an error returned to the client with its status code
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+func errorf(status int, format string, args ...interface{}) error {
+	return &apiError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// errorBody is the body of every error response
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// ServeHTTP routes a request to its handler and writes the JSON response
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, r, http.StatusMethodNotAllowed, &errorBody{Error: "method not allowed"})
+		return
+	}
+	rt, vars := match(r.URL.Path)
+	if rt == nil {
+		writeJSON(w, r, http.StatusNotFound, &errorBody{Error: "not found"})
+		return
+	}
+	resp, err := rt.handle(s, &request{Request: r, vars: vars})
+	if err != nil {
+		code := http.StatusInternalServerError
+		if e, ok := err.(*apiError); ok {
+			code = e.status
+		}
+		writeJSON(w, r, code, &errorBody{Error: err.Error()})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// writeJSON writes v with an ETag of its encoding, answering 304 when the
+// client already holds it
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		code = http.StatusInternalServerError
+		b, _ = json.Marshal(&errorBody{Error: err.Error()})
+	}
+	b = append(b, '\n')
+
+	h := w.Header()
+	h.Set("Content-Type", "application/json")
+	if code == http.StatusOK {
+		sum := sha256.Sum256(b)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		h.Set("ETag", etag)
+		h.Set("Cache-Control", "no-cache")
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	h.Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(code)
+	if r.Method != http.MethodHead {
+		w.Write(b)
+	}
+}
+
+// etagMatch reports whether an If-None-Match header lists etag, weak
+// validators match their strong form
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// request is an HTTP request with the path parameters of its route
+type request struct {
+	*http.Request
+	vars map[string]string
+}
+
+// limit returns the page size asked for
+func (r *request) limit() (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return DefaultLimit, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > MaxLimit {
+		return 0, errorf(http.StatusBadRequest, "limit must be between 1 and %d", MaxLimit)
+	}
+	return n, nil
+}
+
+// page returns the bounds of the page of n ordered items following the
+// cursor, after reports whether item i is past it and is nil without a
+// cursor. next is the cursor of the last item when more items follow.
+func (r *request) page(n int, after func(i int) bool, cursorOf func(i int) string) (start, end int, next string, err error) {
+	limit, err := r.limit()
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if after != nil {
+		start = sort.Search(n, after)
+	}
+	end = start + limit
+	if end >= n {
+		return start, n, "", nil
+	}
+	return start, end, cursorOf(end - 1), nil
+}
+
+// cursor returns the parts of the cursor parameter, nil when the request
+// has none. Cursors are opaque to clients, which only pass them back.
+func (r *request) cursor(parts int) ([]string, error) {
+	v := r.URL.Query().Get("cursor")
+	if v == "" {
+		return nil, nil
+	}
+	b, err := hex.DecodeString(v)
+	if err == nil {
+		if fields := strings.Split(string(b), ":"); len(fields) == parts {
+			return fields, nil
+		}
+	}
+	return nil, errorf(http.StatusBadRequest, "invalid cursor %q", v)
+}
+
+// encodeCursor joins the parts of a cursor
+func encodeCursor(parts ...string) string {
+	return hex.EncodeToString([]byte(strings.Join(parts, ":")))
+}
+
+// route is an endpoint of the API, OpenAPI describes it from these fields
+type route struct {
+	pattern string
+	summary string
+
+	// query lists the query parameters besides the paging ones
+	query []*queryParam
+	paged bool
+
+	// response is a value of the response type
+	response interface{}
+
+	handle func(s *Server, r *request) (interface{}, error)
+}
+
+// queryParam is an optional query parameter of a route
+type queryParam struct {
+	name        string
+	typ         string
+	description string
+}
+
+// match returns the route serving path and the values of its path
+// parameters
+func match(path string) (*route, map[string]string) {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	for _, rt := range routes {
+		pat := strings.Split(strings.Trim(rt.pattern, "/"), "/")
+		if len(pat) != len(segs) {
+			continue
+		}
+		vars := make(map[string]string)
+		for i, p := range pat {
+			if strings.HasPrefix(p, "{") {
+				vars[strings.Trim(p, "{}")] = segs[i]
+			} else if p != segs[i] {
+				vars = nil
+				break
+			}
+		}
+		if vars != nil {
+			return rt, vars
+		}
+	}
+	return nil, nil
+}
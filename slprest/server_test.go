@@ -0,0 +1,347 @@
+package slprest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/address"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+	"github.com/simpleledgerinc/goslp/txsource"
+)
+
+func testAddress(t *testing.T, b byte) *address.Address {
+	addr, err := address.NewAddressPubKeyHash(bytes.Repeat([]byte{b}, 20), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
+
+// testTx creates a transaction spending spends with slpMsg at output 0
+// followed by one output per receiver
+func testTx(slpMsg []byte, spends []wire.OutPoint, receivers ...*address.Address) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	for i := range spends {
+		tx.AddTxIn(wire.NewTxIn(&spends[i], nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, slpMsg))
+	for _, addr := range receivers {
+		tx.AddTxOut(wire.NewTxOut(546, addr.PkScript()))
+	}
+	return tx
+}
+
+func testTokenID(tx *wire.MsgTx) tokenindex.TokenID {
+	hash := tx.TxHash()
+	var id tokenindex.TokenID
+	for i := range hash {
+		id[i] = hash[len(hash)-1-i]
+	}
+	return id
+}
+
+// testServer holds a server over a token sent from alice to bob in a
+// second block, and an unconfirmed send back from alice to both
+type testServer struct {
+	*httptest.Server
+	alice, bob             *address.Address
+	genesis, send, pending *wire.MsgTx
+}
+
+func newTestServer(t *testing.T) *testServer {
+	ts := &testServer{alice: testAddress(t, 1), bob: testAddress(t, 2)}
+	idx := tokenindex.New()
+	txs := txsource.NewStore()
+
+	genesisMsg, err := metadatamaker.CreateOpReturnGenesis(0x01, []byte("TST"), []byte("test"), nil, nil, 2, metadatamaker.NewMintBatonVout(2), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.genesis = testTx(genesisMsg, []wire.OutPoint{{Index: 1}}, ts.alice, ts.alice)
+	id := testTokenID(ts.genesis)
+	sendMsg, err := metadatamaker.CreateOpReturnSend(0x01, id[:], []uint64{600, 400})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.send = testTx(sendMsg, []wire.OutPoint{{Hash: ts.genesis.TxHash(), Index: 1}}, ts.alice, ts.bob)
+
+	b0 := wire.NewMsgBlock(wire.NewBlockHeader(1, &chainhash.Hash{}, &chainhash.Hash{}, 0, 0))
+	b0.AddTransaction(ts.genesis)
+	b1 := wire.NewMsgBlock(wire.NewBlockHeader(1, &chainhash.Hash{}, &chainhash.Hash{}, 0, 1))
+	b1.Header.PrevBlock = b0.BlockHash()
+	b1.AddTransaction(ts.send)
+	for height, b := range []*wire.MsgBlock{b0, b1} {
+		results, err := idx.ConnectBlock(b, int32(height))
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs.BlockConnected(b, int32(height), results)
+	}
+
+	mempool := tokenindex.NewMempool(idx.Lookup)
+	pendingMsg, err := metadatamaker.CreateOpReturnSend(0x01, id[:], []uint64{350, 250})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.pending = testTx(pendingMsg, []wire.OutPoint{{Hash: ts.send.TxHash(), Index: 1}}, ts.alice, ts.bob)
+	if _, err := mempool.AddTx(ts.pending); err != nil {
+		t.Fatal(err)
+	}
+
+	ts.Server = httptest.NewServer(NewServer(Config{Index: idx, Mempool: mempool, Txs: txs}))
+	return ts
+}
+
+// get requests path and decodes the JSON body into v, returning the
+// response
+func (ts *testServer) get(t *testing.T, path string, wantCode int, v interface{}) *http.Response {
+	resp, err := http.Get(ts.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != wantCode {
+		t.Fatalf("GET %s: expected %d, got %d", path, wantCode, resp.StatusCode)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+	}
+	return resp
+}
+
+func TestToken(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	id := testTokenID(ts.genesis)
+
+	var raw map[string]interface{}
+	ts.get(t, "/v1/tokens/"+id.String(), http.StatusOK, &raw)
+	if raw["circulating"] != "1000" || raw["genesisQuantity"] != "1000" || raw["ticker"] != "TST" {
+		t.Fatalf("expected amounts as strings, got %v", raw)
+	}
+	if raw["baton"] != ts.genesis.TxHash().String()+":2" {
+		t.Fatalf("unexpected baton %v", raw["baton"])
+	}
+
+	ts.get(t, "/v1/tokens/"+tokenindex.TokenID{}.String(), http.StatusNotFound, nil)
+	var e errorBody
+	ts.get(t, "/v1/tokens/xyz", http.StatusBadRequest, &e)
+	if e.Error == "" {
+		t.Fatal("expected an error message")
+	}
+	ts.get(t, "/v1/nothing", http.StatusNotFound, nil)
+
+	resp, err := http.Post(ts.URL+"/v1/tokens/"+id.String(), "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", resp.StatusCode)
+	}
+}
+
+func TestETag(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	path := "/v1/tokens/" + testTokenID(ts.genesis).String()
+
+	etag := ts.get(t, path, http.StatusOK, nil).Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag")
+	}
+	if again := ts.get(t, path, http.StatusOK, nil).Header.Get("ETag"); again != etag {
+		t.Fatalf("expected a stable ETag, got %s and %s", etag, again)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", resp.StatusCode)
+	}
+}
+
+func TestUtxoPaging(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	path := "/v1/tokens/" + testTokenID(ts.genesis).String() + "/utxos"
+
+	var all UtxoPage
+	ts.get(t, path, http.StatusOK, &all)
+	if len(all.Utxos) != 3 || all.Next != "" {
+		t.Fatalf("expected 3 confirmed utxos on one page, got %+v", all)
+	}
+
+	var paged []*Utxo
+	cursor := ""
+	for i := 0; ; i++ {
+		if i > 3 {
+			t.Fatal("paging does not end")
+		}
+		var page UtxoPage
+		ts.get(t, path+"?limit=2&cursor="+url.QueryEscape(cursor), http.StatusOK, &page)
+		paged = append(paged, page.Utxos...)
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+	if len(paged) != 3 {
+		t.Fatalf("expected 3 utxos over all pages, got %d", len(paged))
+	}
+	for i := range paged {
+		if paged[i].OutPoint != all.Utxos[i].OutPoint {
+			t.Fatalf("pages differ from the full list at %d", i)
+		}
+	}
+
+	ts.get(t, path+"?limit=0", http.StatusBadRequest, nil)
+	ts.get(t, path+"?cursor=zz", http.StatusBadRequest, nil)
+}
+
+func TestHolders(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	path := "/v1/tokens/" + testTokenID(ts.genesis).String() + "/holders"
+
+	var page HolderPage
+	ts.get(t, path+"?limit=1", http.StatusOK, &page)
+	if page.Height != 1 || len(page.Holders) != 1 || page.Holders[0].Balance != "600" || page.Next == "" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	if page.Holders[0].Address != ts.alice.String() {
+		t.Fatalf("expected alice first, got %s", page.Holders[0].Address)
+	}
+	var next HolderPage
+	ts.get(t, path+"?limit=1&cursor="+page.Next, http.StatusOK, &next)
+	if len(next.Holders) != 1 || next.Holders[0].Balance != "400" || next.Next != "" {
+		t.Fatalf("unexpected second page %+v", next)
+	}
+
+	ts.get(t, path+"?height=0", http.StatusOK, &page)
+	if len(page.Holders) != 1 || page.Holders[0].Balance != "1000" {
+		t.Fatalf("unexpected holders at the genesis block %+v", page)
+	}
+	ts.get(t, path+"?height=5", http.StatusNotFound, nil)
+}
+
+func TestAddress(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	var balances AddressBalances
+	ts.get(t, "/v1/addresses/"+ts.bob.CashAddress()+"/balances", http.StatusOK, &balances)
+	if balances.Address != ts.bob.String() || len(balances.Balances) != 1 {
+		t.Fatalf("unexpected balances %+v", balances)
+	}
+	if b := balances.Balances[0]; b.Confirmed != "400" || b.Unconfirmed != "650" || b.Outputs != 2 || b.Ticker != "TST" {
+		t.Fatalf("unexpected bob balance %+v", b)
+	}
+	ts.get(t, "/v1/addresses/"+ts.alice.String()+"/balances", http.StatusOK, &balances)
+	if b := balances.Balances[0]; b.Confirmed != "600" || b.Unconfirmed != "350" || b.MintBatons != 1 {
+		t.Fatalf("unexpected alice balance %+v", b)
+	}
+
+	var page UtxoPage
+	ts.get(t, "/v1/addresses/"+ts.alice.String()+"/utxos", http.StatusOK, &page)
+	if len(page.Utxos) != 2 {
+		t.Fatalf("expected the baton and the unconfirmed change, got %+v", page.Utxos)
+	}
+	for _, u := range page.Utxos {
+		if u.OutPoint == ts.send.TxHash().String()+":1" {
+			t.Fatal("expected the output spent by the unconfirmed send to be left out")
+		}
+		if (u.Height == -1) != (u.OutPoint == ts.pending.TxHash().String()+":1") {
+			t.Fatalf("unexpected height of %+v", u)
+		}
+	}
+
+	ts.get(t, "/v1/addresses/nonsense/balances", http.StatusBadRequest, nil)
+}
+
+func TestTransaction(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	id := testTokenID(ts.genesis)
+
+	var tx Transaction
+	ts.get(t, "/v1/transactions/"+ts.send.TxHash().String(), http.StatusOK, &tx)
+	if tx.Height != 1 || tx.Confirmations != 1 || tx.Slp == nil || !tx.Slp.Valid || tx.Slp.TxType != "SEND" {
+		t.Fatalf("unexpected transaction %+v", tx)
+	}
+	if tx.Slp.TokenID != id.String() || len(tx.Slp.Amounts) != 2 || tx.Slp.Amounts[1] != "400" {
+		t.Fatalf("unexpected slp info %+v", tx.Slp)
+	}
+	if in := tx.Inputs[0]; in.Token == nil || in.Token.Amount != "1000" {
+		t.Fatalf("unexpected input %+v", in)
+	}
+	if out := tx.Outputs[2]; out.Token == nil || out.Token.Amount != "400" || out.Address != ts.bob.String() {
+		t.Fatalf("unexpected output %+v", out)
+	}
+	if tx.Outputs[0].Token != nil {
+		t.Fatal("expected no token on the OP_RETURN output")
+	}
+
+	ts.get(t, "/v1/transactions/"+ts.genesis.TxHash().String(), http.StatusOK, &tx)
+	if tx.Slp.TxType != "GENESIS" || tx.Slp.Ticker != "TST" || tx.Slp.Decimals != 2 || tx.Slp.MintBatonVout != 2 {
+		t.Fatalf("unexpected genesis %+v", tx.Slp)
+	}
+
+	var pending Transaction
+	ts.get(t, "/v1/transactions/"+ts.pending.TxHash().String(), http.StatusOK, &pending)
+	if tx := pending; tx.Height != -1 || tx.Confirmations != 0 || tx.BlockHash != "" || !tx.Slp.Valid {
+		t.Fatalf("unexpected unconfirmed transaction %+v", tx)
+	}
+
+	ts.get(t, "/v1/transactions/"+chainhash.Hash{}.String(), http.StatusNotFound, nil)
+}
+
+func TestOpenAPI(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	var doc struct {
+		OpenAPI    string                 `json:"openapi"`
+		Paths      map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]interface{} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	ts.get(t, "/v1/openapi.json", http.StatusOK, &doc)
+	if doc.OpenAPI == "" || len(doc.Paths) != len(routes) {
+		t.Fatalf("expected every route in the document, got %v", doc.Paths)
+	}
+	for _, rt := range routes {
+		if _, ok := doc.Paths[rt.pattern]; !ok {
+			t.Errorf("route %s is missing", rt.pattern)
+		}
+	}
+	token, ok := doc.Components.Schemas["Token"]
+	if !ok || token.Properties["circulating"]["type"] != "string" {
+		t.Fatalf("expected amounts typed as strings, got %v", token)
+	}
+	page := doc.Components.Schemas["UtxoPage"]
+	if ref := page.Properties["utxos"]["items"]; ref == nil {
+		t.Fatalf("expected utxo items, got %v", page)
+	}
+}
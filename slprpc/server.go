@@ -0,0 +1,577 @@
+// Package slprpc serves the SLP calls of the bchd gRPC API from a token
+// index, so clients written for bchd can run against goslp without a node.
+package slprpc
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/gcash/bchd/bchrpc/pb"
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/txscript"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp"
+	"github.com/simpleledgerinc/goslp/address"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+	"github.com/simpleledgerinc/goslp/txsource"
+	"github.com/simpleledgerinc/goslp/v1parser"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Config holds the sources a Server answers from
+type Config struct {
+	Index *tokenindex.Index
+
+	// Mempool resolves unconfirmed transactions, it may be nil
+	Mempool *tokenindex.Mempool
+
+	// Txs resolves confirmed transactions, usually a txsource.Store
+	Txs txsource.Source
+
+	// Params encodes addresses, MainNetParams when nil
+	Params *chaincfg.Params
+}
+
+// Server implements the SLP calls of bchd's bchrpc service: GetSlpParsedScript,
+// GetSlpTokenMetadata, GetSlpTrustedValidation and GetTransaction. The other
+// calls return codes.Unimplemented.
+type Server struct {
+	pb.UnimplementedBchrpcServer
+	cfg Config
+	txs *txsource.Lookup
+}
+
+// NewServer creates a Server
+func NewServer(cfg Config) *Server {
+	if cfg.Params == nil {
+		cfg.Params = &chaincfg.MainNetParams
+	}
+	return &Server{
+		cfg: cfg,
+		txs: &txsource.Lookup{Index: cfg.Index, Mempool: cfg.Mempool, Txs: cfg.Txs},
+	}
+}
+
+// Register registers the server on gs
+func (s *Server) Register(gs *grpc.Server) {
+	pb.RegisterBchrpcServer(gs, s)
+}
+
+// tokenType maps a token type to its pb enum
+func tokenType(t v1parser.TokenType) pb.SlpTokenType {
+	switch t {
+	case v1parser.TokenTypeFungible01:
+		return pb.SlpTokenType_V1_FUNGIBLE
+	case v1parser.TokenTypeNft1Group81:
+		return pb.SlpTokenType_V1_NFT1_GROUP
+	case v1parser.TokenTypeNft1Child41:
+		return pb.SlpTokenType_V1_NFT1_CHILD
+	}
+	return pb.SlpTokenType_VERSION_NOT_SET
+}
+
+// slpAction returns the action of a parsed message
+func slpAction(slpMsg v1parser.ParseResult) pb.SlpAction {
+	switch slpMsg.TokenType() {
+	case v1parser.TokenTypeFungible01:
+		switch slpMsg.(type) {
+		case *v1parser.SlpGenesis:
+			return pb.SlpAction_SLP_V1_GENESIS
+		case *v1parser.SlpMint:
+			return pb.SlpAction_SLP_V1_MINT
+		case *v1parser.SlpSend:
+			return pb.SlpAction_SLP_V1_SEND
+		}
+	case v1parser.TokenTypeNft1Group81:
+		switch slpMsg.(type) {
+		case *v1parser.SlpGenesis:
+			return pb.SlpAction_SLP_V1_NFT1_GROUP_GENESIS
+		case *v1parser.SlpMint:
+			return pb.SlpAction_SLP_V1_NFT1_GROUP_MINT
+		case *v1parser.SlpSend:
+			return pb.SlpAction_SLP_V1_NFT1_GROUP_SEND
+		}
+	case v1parser.TokenTypeNft1Child41:
+		switch slpMsg.(type) {
+		case *v1parser.SlpGenesis:
+			return pb.SlpAction_SLP_V1_NFT1_UNIQUE_CHILD_GENESIS
+		case *v1parser.SlpSend:
+			return pb.SlpAction_SLP_V1_NFT1_UNIQUE_CHILD_SEND
+		}
+	}
+	return pb.SlpAction_SLP_UNSUPPORTED_VERSION
+}
+
+// parseError returns the action and message of a failed parse
+func parseError(err error) (pb.SlpAction, string) {
+	if err == v1parser.ErrUnsupportedSlpVersion {
+		return pb.SlpAction_SLP_UNSUPPORTED_VERSION, err.Error()
+	}
+	return pb.SlpAction_SLP_PARSE_ERROR, err.Error()
+}
+
+// groupID returns the NFT1 group of a child token, nil when unknown
+func (s *Server) groupID(tokenID []byte) []byte {
+	id, err := tokenindex.NewTokenID(tokenID)
+	if err != nil {
+		return nil
+	}
+	meta := s.cfg.Index.Metadata(id)
+	if meta == nil || meta.GroupID == nil {
+		return nil
+	}
+	return append([]byte{}, meta.GroupID[:]...)
+}
+
+// GetSlpParsedScript parses an SLP OP_RETURN script
+func (s *Server) GetSlpParsedScript(ctx context.Context, req *pb.GetSlpParsedScriptRequest) (*pb.GetSlpParsedScriptResponse, error) {
+	resp := &pb.GetSlpParsedScriptResponse{}
+	slpMsg, err := v1parser.ParseSLP(req.GetSlpOpreturnScript())
+	if err != nil {
+		resp.SlpAction, resp.ParsingError = parseError(err)
+		return resp, nil
+	}
+	resp.TokenType = tokenType(slpMsg.TokenType())
+	resp.SlpAction = slpAction(slpMsg)
+
+	switch msg := slpMsg.(type) {
+	case *v1parser.SlpGenesis:
+		if msg.TokenType() == v1parser.TokenTypeNft1Child41 {
+			resp.SlpMetadata = &pb.GetSlpParsedScriptResponse_V1Nft1ChildGenesis{
+				V1Nft1ChildGenesis: childGenesisMetadata(msg),
+			}
+		} else {
+			resp.SlpMetadata = &pb.GetSlpParsedScriptResponse_V1Genesis{V1Genesis: genesisMetadata(msg)}
+		}
+	case *v1parser.SlpMint:
+		resp.TokenId = msg.TokenID()
+		resp.SlpMetadata = &pb.GetSlpParsedScriptResponse_V1Mint{V1Mint: mintMetadata(msg)}
+	case *v1parser.SlpSend:
+		resp.TokenId = msg.TokenID()
+		if msg.TokenType() == v1parser.TokenTypeNft1Child41 {
+			resp.SlpMetadata = &pb.GetSlpParsedScriptResponse_V1Nft1ChildSend{
+				V1Nft1ChildSend: &pb.SlpV1Nft1ChildSendMetadata{GroupTokenId: s.groupID(msg.TokenID())},
+			}
+		} else {
+			resp.SlpMetadata = &pb.GetSlpParsedScriptResponse_V1Send{
+				V1Send: &pb.SlpV1SendMetadata{Amounts: msg.Amounts},
+			}
+		}
+	}
+	return resp, nil
+}
+
+func genesisMetadata(msg *v1parser.SlpGenesis) *pb.SlpV1GenesisMetadata {
+	return &pb.SlpV1GenesisMetadata{
+		Name:          msg.Name,
+		Ticker:        msg.Ticker,
+		DocumentUrl:   msg.DocumentURI,
+		DocumentHash:  msg.DocumentHash,
+		Decimals:      uint32(msg.Decimals),
+		MintBatonVout: uint32(msg.MintBatonVout),
+		MintAmount:    msg.Qty,
+	}
+}
+
+func childGenesisMetadata(msg *v1parser.SlpGenesis) *pb.SlpV1Nft1ChildGenesisMetadata {
+	return &pb.SlpV1Nft1ChildGenesisMetadata{
+		Name:         msg.Name,
+		Ticker:       msg.Ticker,
+		DocumentUrl:  msg.DocumentURI,
+		DocumentHash: msg.DocumentHash,
+		Decimals:     uint32(msg.Decimals),
+	}
+}
+
+func mintMetadata(msg *v1parser.SlpMint) *pb.SlpV1MintMetadata {
+	return &pb.SlpV1MintMetadata{
+		MintBatonVout: uint32(msg.MintBatonVout),
+		MintAmount:    msg.Qty,
+	}
+}
+
+// GetSlpTokenMetadata returns the genesis metadata and current mint baton
+// of tokens
+func (s *Server) GetSlpTokenMetadata(ctx context.Context, req *pb.GetSlpTokenMetadataRequest) (*pb.GetSlpTokenMetadataResponse, error) {
+	resp := &pb.GetSlpTokenMetadataResponse{TokenMetadata: make([]*pb.SlpTokenMetadata, 0, len(req.GetTokenIds()))}
+	for _, b := range req.GetTokenIds() {
+		id, err := tokenindex.NewTokenID(b)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid token id %x: %v", b, err)
+		}
+		tm := s.tokenMetadata(id)
+		if tm == nil {
+			return nil, status.Errorf(codes.Aborted, "token ID %s does not exist", id)
+		}
+		resp.TokenMetadata = append(resp.TokenMetadata, tm)
+	}
+	return resp, nil
+}
+
+// tokenMetadata marshals the metadata of a token, nil when it is unknown
+func (s *Server) tokenMetadata(id tokenindex.TokenID) *pb.SlpTokenMetadata {
+	meta := s.cfg.Index.Metadata(id)
+	if meta == nil {
+		return nil
+	}
+
+	var batonHash []byte
+	var batonVout uint32
+	if stats := s.cfg.Index.TokenStats(id); stats != nil && stats.Baton != nil {
+		batonHash = stats.Baton.Hash.CloneBytes()
+		batonVout = stats.Baton.Index
+	}
+
+	tm := &pb.SlpTokenMetadata{
+		TokenId:   append([]byte{}, id[:]...),
+		TokenType: tokenType(meta.TokenType),
+	}
+	switch meta.TokenType {
+	case v1parser.TokenTypeFungible01:
+		tm.TypeMetadata = &pb.SlpTokenMetadata_V1Fungible_{
+			V1Fungible: &pb.SlpTokenMetadata_V1Fungible{
+				TokenTicker:       string(meta.Ticker),
+				TokenName:         string(meta.Name),
+				TokenDocumentUrl:  string(meta.DocumentURI),
+				TokenDocumentHash: meta.DocumentHash,
+				Decimals:          uint32(meta.Decimals),
+				MintBatonHash:     batonHash,
+				MintBatonVout:     batonVout,
+			},
+		}
+	case v1parser.TokenTypeNft1Group81:
+		tm.TypeMetadata = &pb.SlpTokenMetadata_V1Nft1Group{
+			V1Nft1Group: &pb.SlpTokenMetadata_V1NFT1Group{
+				TokenTicker:       string(meta.Ticker),
+				TokenName:         string(meta.Name),
+				TokenDocumentUrl:  string(meta.DocumentURI),
+				TokenDocumentHash: meta.DocumentHash,
+				Decimals:          uint32(meta.Decimals),
+				MintBatonHash:     batonHash,
+				MintBatonVout:     batonVout,
+			},
+		}
+	case v1parser.TokenTypeNft1Child41:
+		child := &pb.SlpTokenMetadata_V1NFT1Child{
+			TokenTicker:       string(meta.Ticker),
+			TokenName:         string(meta.Name),
+			TokenDocumentUrl:  string(meta.DocumentURI),
+			TokenDocumentHash: meta.DocumentHash,
+		}
+		if meta.GroupID != nil {
+			child.GroupId = append([]byte{}, meta.GroupID[:]...)
+		}
+		tm.TypeMetadata = &pb.SlpTokenMetadata_V1Nft1Child{V1Nft1Child: child}
+	}
+	return tm
+}
+
+// GetSlpTrustedValidation returns the token amount or baton of outputs of
+// valid SLP transactions. Graph search counts are not supported.
+func (s *Server) GetSlpTrustedValidation(ctx context.Context, req *pb.GetSlpTrustedValidationRequest) (*pb.GetSlpTrustedValidationResponse, error) {
+	if req.GetIncludeGraphsearchCount() {
+		return nil, status.Error(codes.Unimplemented, "graph search is not supported")
+	}
+	resp := &pb.GetSlpTrustedValidationResponse{}
+	for _, q := range req.GetQueries() {
+		hash, err := chainhash.NewHash(q.GetPrevOutHash())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid txn hash for txo %x: %v", q.GetPrevOutHash(), err)
+		}
+		vout := q.GetPrevOutVout()
+		info, ok := s.txs.Tx(*hash)
+		if !ok || !info.Valid {
+			return nil, status.Errorf(codes.Aborted, "txid is missing from slp validity set for txo: %v:%d", hash, vout)
+		}
+		if vout == 0 || vout > v1parser.MaxSendOutputs {
+			return nil, status.Errorf(codes.Aborted, "slp output index cannot be 0 or > %d txo: %v:%d", v1parser.MaxSendOutputs, hash, vout)
+		}
+
+		outputs, slpMsg, err := goslp.GetTokenOutputs(info.Tx)
+		if err != nil || slpMsg == nil {
+			return nil, status.Errorf(codes.Internal, "could not parse slp message of %v", hash)
+		}
+		result := &pb.GetSlpTrustedValidationResponse_ValidityResult{
+			PrevOutHash:    q.GetPrevOutHash(),
+			PrevOutVout:    vout,
+			SlpAction:      slpAction(slpMsg),
+			TokenType:      tokenType(slpMsg.TokenType()),
+			SlpTxnOpreturn: info.Tx.TxOut[0].PkScript,
+		}
+		if result.TokenId, err = goslp.GetSlpTokenID(info.Tx); err != nil {
+			return nil, status.Errorf(codes.Internal, "could not get token id of %v: %v", hash, err)
+		}
+
+		amount, baton := slpMsg.GetVoutValue(int(vout))
+		switch {
+		case int(vout) >= len(outputs):
+			return nil, status.Error(codes.Aborted, "vout is not a valid slp output")
+		case baton:
+			result.ValidityResultType = &pb.GetSlpTrustedValidationResponse_ValidityResult_V1MintBaton{V1MintBaton: true}
+		case amount != nil:
+			result.ValidityResultType = &pb.GetSlpTrustedValidationResponse_ValidityResult_V1TokenAmount{V1TokenAmount: amount.Uint64()}
+		default:
+			return nil, status.Error(codes.Aborted, "vout is not a valid slp output")
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
+// slpToken returns the tokens of the output at op, nil when it carries none
+func (s *Server) slpToken(op wire.OutPoint) *pb.SlpToken {
+	info, ok := s.txs.Tx(op.Hash)
+	if !ok || !info.Valid {
+		return nil
+	}
+	outputs, slpMsg, err := goslp.GetTokenOutputs(info.Tx)
+	if err != nil || slpMsg == nil || int(op.Index) >= len(outputs) || outputs[op.Index] == nil {
+		return nil
+	}
+	out := outputs[op.Index]
+	token := &pb.SlpToken{
+		TokenId:     out.TokenID,
+		Amount:      out.Amount,
+		IsMintBaton: out.IsMintBaton,
+		SlpAction:   slpAction(slpMsg),
+		TokenType:   tokenType(out.TokenType),
+		Address:     s.slpAddress(info.Tx.TxOut[op.Index].PkScript),
+	}
+	if id, err := tokenindex.NewTokenID(out.TokenID); err == nil {
+		if meta := s.cfg.Index.Metadata(id); meta != nil {
+			token.Decimals = uint32(meta.Decimals)
+		}
+	}
+	return token
+}
+
+// slpAddress returns the simpleledger address of a script without prefix,
+// empty when it pays no address
+func (s *Server) slpAddress(pkScript []byte) string {
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, s.cfg.Params)
+	if err != nil || len(addrs) != 1 {
+		return ""
+	}
+	addr, err := address.FromBchAddress(addrs[0], s.cfg.Params)
+	if err != nil {
+		return ""
+	}
+	str := addr.String()
+	return str[strings.IndexByte(str, ':')+1:]
+}
+
+// GetTransaction returns a transaction with the SLP information of the
+// transaction, its inputs and outputs
+func (s *Server) GetTransaction(ctx context.Context, req *pb.GetTransactionRequest) (*pb.GetTransactionResponse, error) {
+	hash, err := chainhash.NewHash(req.GetHash())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid transaction hash %v", err)
+	}
+	info, ok := s.txs.Tx(*hash)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "transaction not found")
+	}
+
+	tx := s.marshalTransaction(info)
+	resp := &pb.GetTransactionResponse{Transaction: tx}
+	if req.GetIncludeTokenMetadata() && tx.SlpTransactionInfo.ValidityJudgement == pb.SlpTransactionInfo_VALID {
+		id, err := tokenindex.NewTokenID(tx.SlpTransactionInfo.TokenId)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "invalid token id %x: %v", tx.SlpTransactionInfo.TokenId, err)
+		}
+		if resp.TokenMetadata = s.tokenMetadata(id); resp.TokenMetadata == nil {
+			return nil, status.Errorf(codes.Internal, "token metadata for %s is missing", id)
+		}
+	}
+	return resp, nil
+}
+
+// marshalTransaction describes a transaction the way bchd does, reading
+// the previous outputs of the inputs from the mempool and the confirmed
+// transactions
+func (s *Server) marshalTransaction(info *txsource.Info) *pb.Transaction {
+	msgTx := info.Tx
+	txHash := msgTx.TxHash()
+	resp := &pb.Transaction{
+		Hash:               txHash.CloneBytes(),
+		Version:            msgTx.Version,
+		LockTime:           msgTx.LockTime,
+		Size:               int32(msgTx.SerializeSize()),
+		SlpTransactionInfo: s.slpInfo(info),
+	}
+	if info.Header != nil {
+		blockHash := info.Header.BlockHash()
+		resp.BlockHash = blockHash.CloneBytes()
+		resp.BlockHeight = info.Height
+		resp.Timestamp = info.Header.Timestamp.Unix()
+		if _, tipHeight := s.cfg.Index.Tip(); tipHeight >= info.Height {
+			resp.Confirmations = tipHeight - info.Height + 1
+		}
+	}
+
+	slpInfo := resp.SlpTransactionInfo
+	slpMsg, _ := v1parser.ParseSLP(firstScript(msgTx))
+	inputAmount := new(big.Int)
+	burns := make(map[pb.SlpTransactionInfo_BurnFlags]bool)
+	for i, txIn := range msgTx.TxIn {
+		op := txIn.PreviousOutPoint
+		in := &pb.Transaction_Input{
+			Index:           uint32(i),
+			Outpoint:        &pb.Transaction_Input_Outpoint{Hash: op.Hash.CloneBytes(), Index: op.Index},
+			SignatureScript: txIn.SignatureScript,
+			Sequence:        txIn.Sequence,
+			SlpToken:        s.slpToken(op),
+		}
+		if prev, ok := s.txs.Tx(op.Hash); ok && int(op.Index) < len(prev.Tx.TxOut) {
+			prevOut := prev.Tx.TxOut[op.Index]
+			in.Value = prevOut.Value
+			in.PreviousScript = prevOut.PkScript
+			in.Address = s.cashAddress(prevOut.PkScript)
+		}
+		resp.Inputs = append(resp.Inputs, in)
+
+		token := in.SlpToken
+		if token == nil || (token.Amount == 0 && !token.IsMintBaton) {
+			continue
+		}
+		switch {
+		case slpMsg == nil:
+			burns[pb.SlpTransactionInfo_BURNED_INPUTS_BAD_OPRETURN] = true
+		case string(token.TokenId) != string(slpInfo.TokenId) || token.TokenType != tokenType(slpMsg.TokenType()):
+			if slpInfo.ValidityJudgement == pb.SlpTransactionInfo_VALID {
+				burns[pb.SlpTransactionInfo_BURNED_INPUTS_OTHER_TOKEN] = true
+			}
+		case !token.IsMintBaton:
+			inputAmount.Add(inputAmount, new(big.Int).SetUint64(token.Amount))
+		}
+	}
+
+	for i, txOut := range msgTx.TxOut {
+		out := &pb.Transaction_Output{
+			Index:        uint32(i),
+			Value:        txOut.Value,
+			PubkeyScript: txOut.PkScript,
+			Address:      s.cashAddress(txOut.PkScript),
+		}
+		if i > 0 {
+			out.SlpToken = s.slpToken(wire.OutPoint{Hash: txHash, Index: uint32(i)})
+		}
+		if class := txscript.GetScriptClass(txOut.PkScript); class == txscript.NullDataTy {
+			out.ScriptClass = "datacarrier"
+		} else {
+			out.ScriptClass = class.String()
+		}
+		if disasm, err := txscript.DisasmString(txOut.PkScript); err == nil {
+			out.DisassembledScript = disasm
+		}
+		resp.Outputs = append(resp.Outputs, out)
+	}
+
+	for flag := range outputBurns(msgTx, slpMsg, slpInfo.ValidityJudgement == pb.SlpTransactionInfo_VALID, inputAmount) {
+		burns[flag] = true
+	}
+	for flag := range burns {
+		slpInfo.BurnFlags = append(slpInfo.BurnFlags, flag)
+	}
+	sort.Slice(slpInfo.BurnFlags, func(i, j int) bool {
+		return slpInfo.BurnFlags[i] < slpInfo.BurnFlags[j]
+	})
+	return resp
+}
+
+// outputBurns returns the burns caused by the outputs of tx given the
+// token amount of its inputs
+func outputBurns(tx *wire.MsgTx, slpMsg v1parser.ParseResult, valid bool, inputAmount *big.Int) map[pb.SlpTransactionInfo_BurnFlags]bool {
+	burns := make(map[pb.SlpTransactionInfo_BurnFlags]bool)
+	lastVout := len(tx.TxOut) - 1
+	switch msg := slpMsg.(type) {
+	case *v1parser.SlpSend:
+		if len(msg.Amounts) > lastVout {
+			burns[pb.SlpTransactionInfo_BURNED_OUTPUTS_MISSING_BCH_VOUT] = true
+		}
+		outputAmount, err := msg.TotalSlpMsgOutputValue()
+		if err != nil {
+			break
+		}
+		if valid && inputAmount.Cmp(outputAmount) > 0 {
+			burns[pb.SlpTransactionInfo_BURNED_INPUTS_GREATER_THAN_OUTPUTS] = true
+		}
+		if !valid && inputAmount.Cmp(outputAmount) < 0 {
+			burns[pb.SlpTransactionInfo_BURNED_INPUTS_OUTPUTS_TOO_HIGH] = true
+		}
+	case *v1parser.SlpGenesis:
+		if valid && msg.MintBatonVout > lastVout {
+			burns[pb.SlpTransactionInfo_BURNED_OUTPUTS_MISSING_BCH_VOUT] = true
+		}
+	case *v1parser.SlpMint:
+		if valid && msg.MintBatonVout > lastVout {
+			burns[pb.SlpTransactionInfo_BURNED_OUTPUTS_MISSING_BCH_VOUT] = true
+		}
+	}
+	return burns
+}
+
+// slpInfo returns the SLP information of a transaction without burn flags
+func (s *Server) slpInfo(info *txsource.Info) *pb.SlpTransactionInfo {
+	slpInfo := &pb.SlpTransactionInfo{ValidityJudgement: pb.SlpTransactionInfo_UNKNOWN_OR_INVALID}
+	script := firstScript(info.Tx)
+	if !goslp.HasSlpLokadPrefix(script) {
+		slpInfo.SlpAction = pb.SlpAction_NON_SLP
+		return slpInfo
+	}
+	slpMsg, err := v1parser.ParseSLP(script)
+	if err != nil {
+		slpInfo.SlpAction, slpInfo.ParseError = parseError(err)
+		return slpInfo
+	}
+	slpInfo.SlpAction = slpAction(slpMsg)
+	slpInfo.TokenId, _ = goslp.GetSlpTokenID(info.Tx)
+	if info.Valid {
+		slpInfo.ValidityJudgement = pb.SlpTransactionInfo_VALID
+	}
+
+	switch msg := slpMsg.(type) {
+	case *v1parser.SlpGenesis:
+		if msg.TokenType() == v1parser.TokenTypeNft1Child41 {
+			meta := childGenesisMetadata(msg)
+			meta.GroupTokenId = s.groupID(slpInfo.TokenId)
+			slpInfo.TxMetadata = &pb.SlpTransactionInfo_V1Nft1ChildGenesis{V1Nft1ChildGenesis: meta}
+		} else {
+			slpInfo.TxMetadata = &pb.SlpTransactionInfo_V1Genesis{V1Genesis: genesisMetadata(msg)}
+		}
+	case *v1parser.SlpMint:
+		slpInfo.TxMetadata = &pb.SlpTransactionInfo_V1Mint{V1Mint: mintMetadata(msg)}
+	case *v1parser.SlpSend:
+		if msg.TokenType() == v1parser.TokenTypeNft1Child41 {
+			slpInfo.TxMetadata = &pb.SlpTransactionInfo_V1Nft1ChildSend{
+				V1Nft1ChildSend: &pb.SlpV1Nft1ChildSendMetadata{GroupTokenId: s.groupID(slpInfo.TokenId)},
+			}
+		} else {
+			slpInfo.TxMetadata = &pb.SlpTransactionInfo_V1Send{V1Send: &pb.SlpV1SendMetadata{Amounts: msg.Amounts}}
+		}
+	}
+	return slpInfo
+}
+
+// cashAddress returns the cash address of a script without prefix, empty
+// when it pays no address
+func (s *Server) cashAddress(pkScript []byte) string {
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, s.cfg.Params)
+	if err != nil || len(addrs) == 0 {
+		return ""
+	}
+	return addrs[0].String()
+}
+
+// firstScript returns the script of output 0, nil when tx has no outputs
+func firstScript(tx *wire.MsgTx) []byte {
+	if len(tx.TxOut) == 0 {
+		return nil
+	}
+	return tx.TxOut[0].PkScript
+}
@@ -0,0 +1,300 @@
+package slprpc
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/gcash/bchd/bchrpc/pb"
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+	"github.com/simpleledgerinc/goslp/txsource"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testPkScript pays to a p2pkh address
+var testPkScript = append(append([]byte{0x76, 0xa9, 0x14}, bytes.Repeat([]byte{0x01}, 20)...), 0x88, 0xac)
+
+func testTx(slpMsg []byte, spends []wire.OutPoint, n int) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	for i := range spends {
+		tx.AddTxIn(wire.NewTxIn(&spends[i], nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, slpMsg))
+	for i := 0; i < n; i++ {
+		tx.AddTxOut(wire.NewTxOut(546, testPkScript))
+	}
+	return tx
+}
+
+func testBlock(prev *wire.MsgBlock, txs ...*wire.MsgTx) *wire.MsgBlock {
+	var prevHash chainhash.Hash
+	var nonce uint32
+	if prev != nil {
+		prevHash = prev.BlockHash()
+		nonce = prev.Header.Nonce + 1
+	}
+	block := wire.NewMsgBlock(wire.NewBlockHeader(1, &prevHash, &chainhash.Hash{}, 0, nonce))
+	for _, tx := range txs {
+		block.AddTransaction(tx)
+	}
+	return block
+}
+
+func testTokenID(tx *wire.MsgTx) tokenindex.TokenID {
+	hash := tx.TxHash()
+	var id tokenindex.TokenID
+	for i := range hash {
+		id[i] = hash[len(hash)-1-i]
+	}
+	return id
+}
+
+// testChain holds the transactions connected by newTestServer
+type testChain struct {
+	genesis, send, group, child, pending *wire.MsgTx
+}
+
+// newTestServer indexes a fungible token with a send, an NFT1 group with a
+// child and an unconfirmed send, and serves them over an in-memory listener
+func newTestServer(t *testing.T) (pb.BchrpcClient, *testChain, func()) {
+	idx := tokenindex.New()
+	txs := txsource.NewStore()
+
+	genesisMsg, err := metadatamaker.CreateOpReturnGenesis(0x01, []byte("TST"), []byte("test"), []byte("https://example.com"), nil, 2, metadatamaker.NewMintBatonVout(2), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testChain{genesis: testTx(genesisMsg, []wire.OutPoint{{Index: 1}}, 2)}
+	id := testTokenID(c.genesis)
+	sendMsg, err := metadatamaker.CreateOpReturnSend(0x01, id[:], []uint64{600, 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.send = testTx(sendMsg, []wire.OutPoint{{Hash: c.genesis.TxHash(), Index: 1}}, 2)
+
+	groupMsg, err := metadatamaker.CreateOpReturnGenesis(0x81, []byte("GRP"), []byte("group"), nil, nil, 0, nil, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.group = testTx(groupMsg, []wire.OutPoint{{Index: 2}}, 1)
+	childMsg, err := metadatamaker.CreateOpReturnGenesis(0x41, []byte("C"), []byte("child"), nil, nil, 0, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.child = testTx(childMsg, []wire.OutPoint{{Hash: c.group.TxHash(), Index: 1}}, 1)
+
+	b0 := testBlock(nil, c.genesis, c.group)
+	b1 := testBlock(b0, c.send, c.child)
+	for height, b := range []*wire.MsgBlock{b0, b1} {
+		results, err := idx.ConnectBlock(b, int32(height))
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs.BlockConnected(b, int32(height), results)
+	}
+
+	mempool := tokenindex.NewMempool(idx.Lookup)
+	pendingMsg, err := metadatamaker.CreateOpReturnSend(0x01, id[:], []uint64{600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.pending = testTx(pendingMsg, []wire.OutPoint{{Hash: c.send.TxHash(), Index: 1}}, 1)
+	if _, err := mempool.AddTx(c.pending); err != nil {
+		t.Fatal(err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	NewServer(Config{Index: idx, Mempool: mempool, Txs: txs}).Register(gs)
+	go gs.Serve(lis)
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pb.NewBchrpcClient(conn), c, func() {
+		conn.Close()
+		gs.Stop()
+	}
+}
+
+func TestGetSlpParsedScript(t *testing.T) {
+	client, c, done := newTestServer(t)
+	defer done()
+	ctx := context.Background()
+
+	resp, err := client.GetSlpParsedScript(ctx, &pb.GetSlpParsedScriptRequest{SlpOpreturnScript: c.send.TxOut[0].PkScript})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := testTokenID(c.genesis)
+	if resp.SlpAction != pb.SlpAction_SLP_V1_SEND || resp.TokenType != pb.SlpTokenType_V1_FUNGIBLE || !bytes.Equal(resp.TokenId, id[:]) {
+		t.Fatalf("unexpected response %v", resp)
+	}
+	if amounts := resp.GetV1Send().GetAmounts(); len(amounts) != 2 || amounts[0] != 600 {
+		t.Fatalf("unexpected amounts %v", amounts)
+	}
+
+	resp, err = client.GetSlpParsedScript(ctx, &pb.GetSlpParsedScriptRequest{SlpOpreturnScript: c.child.TxOut[0].PkScript})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.SlpAction != pb.SlpAction_SLP_V1_NFT1_UNIQUE_CHILD_GENESIS || string(resp.GetV1Nft1ChildGenesis().GetName()) != "child" {
+		t.Fatalf("unexpected response %v", resp)
+	}
+
+	resp, err = client.GetSlpParsedScript(ctx, &pb.GetSlpParsedScriptRequest{SlpOpreturnScript: []byte{0x6a, 0x04, 0x53, 0x4c, 0x50, 0x00}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.SlpAction != pb.SlpAction_SLP_PARSE_ERROR || resp.ParsingError == "" {
+		t.Fatalf("expected a parse error, got %v", resp)
+	}
+}
+
+func TestGetSlpTokenMetadata(t *testing.T) {
+	client, c, done := newTestServer(t)
+	defer done()
+	ctx := context.Background()
+
+	id, groupID, childID := testTokenID(c.genesis), testTokenID(c.group), testTokenID(c.child)
+	resp, err := client.GetSlpTokenMetadata(ctx, &pb.GetSlpTokenMetadataRequest{TokenIds: [][]byte{id[:], childID[:]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.TokenMetadata) != 2 {
+		t.Fatalf("expected 2 tokens, got %v", resp.TokenMetadata)
+	}
+	fungible := resp.TokenMetadata[0].GetV1Fungible()
+	genesisHash := c.genesis.TxHash()
+	if string(fungible.GetTokenTicker()) != "TST" || fungible.GetDecimals() != 2 ||
+		!bytes.Equal(fungible.GetMintBatonHash(), genesisHash[:]) || fungible.GetMintBatonVout() != 2 {
+		t.Fatalf("unexpected fungible metadata %v", fungible)
+	}
+	child := resp.TokenMetadata[1]
+	if child.TokenType != pb.SlpTokenType_V1_NFT1_CHILD || !bytes.Equal(child.GetV1Nft1Child().GetGroupId(), groupID[:]) {
+		t.Fatalf("unexpected child metadata %v", child)
+	}
+
+	_, err = client.GetSlpTokenMetadata(ctx, &pb.GetSlpTokenMetadataRequest{TokenIds: [][]byte{make([]byte, 32)}})
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("expected Aborted for an unknown token, got %v", err)
+	}
+}
+
+func TestGetSlpTrustedValidation(t *testing.T) {
+	client, c, done := newTestServer(t)
+	defer done()
+	ctx := context.Background()
+
+	query := func(tx *wire.MsgTx, vout uint32) *pb.GetSlpTrustedValidationRequest_Query {
+		hash := tx.TxHash()
+		return &pb.GetSlpTrustedValidationRequest_Query{PrevOutHash: hash[:], PrevOutVout: vout}
+	}
+	resp, err := client.GetSlpTrustedValidation(ctx, &pb.GetSlpTrustedValidationRequest{
+		Queries: []*pb.GetSlpTrustedValidationRequest_Query{query(c.send, 1), query(c.genesis, 2), query(c.pending, 1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("expected 3 results, got %v", resp.Results)
+	}
+	id := testTokenID(c.genesis)
+	if r := resp.Results[0]; r.GetV1TokenAmount() != 600 || r.SlpAction != pb.SlpAction_SLP_V1_SEND || !bytes.Equal(r.TokenId, id[:]) {
+		t.Fatalf("unexpected send result %v", r)
+	}
+	if r := resp.Results[1]; !r.GetV1MintBaton() || r.SlpAction != pb.SlpAction_SLP_V1_GENESIS || !bytes.Equal(r.TokenId, id[:]) {
+		t.Fatalf("unexpected genesis result %v", r)
+	}
+	if r := resp.Results[2]; r.GetV1TokenAmount() != 600 {
+		t.Fatalf("unexpected mempool result %v", r)
+	}
+
+	for _, q := range []*pb.GetSlpTrustedValidationRequest_Query{
+		query(c.send, 0),
+		query(c.send, 3),
+		{PrevOutHash: make([]byte, 32), PrevOutVout: 1},
+	} {
+		_, err := client.GetSlpTrustedValidation(ctx, &pb.GetSlpTrustedValidationRequest{Queries: []*pb.GetSlpTrustedValidationRequest_Query{q}})
+		if status.Code(err) != codes.Aborted {
+			t.Errorf("expected Aborted for %x:%d, got %v", q.PrevOutHash, q.PrevOutVout, err)
+		}
+	}
+	_, err = client.GetSlpTrustedValidation(ctx, &pb.GetSlpTrustedValidationRequest{
+		Queries:                 []*pb.GetSlpTrustedValidationRequest_Query{query(c.send, 1)},
+		IncludeGraphsearchCount: true,
+	})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected Unimplemented for graph search counts, got %v", err)
+	}
+}
+
+func TestGetTransaction(t *testing.T) {
+	client, c, done := newTestServer(t)
+	defer done()
+	ctx := context.Background()
+
+	hash := c.send.TxHash()
+	resp, err := client.GetTransaction(ctx, &pb.GetTransactionRequest{Hash: hash[:], IncludeTokenMetadata: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := resp.Transaction
+	if tx.BlockHeight != 1 || tx.Confirmations != 1 || len(tx.Inputs) != 1 || len(tx.Outputs) != 3 {
+		t.Fatalf("unexpected transaction %v", tx)
+	}
+	in := tx.Inputs[0]
+	if in.Value != 546 || in.Address == "" || in.SlpToken.GetAmount() != 1000 || in.SlpToken.GetDecimals() != 2 {
+		t.Fatalf("unexpected input %v", in)
+	}
+	if tx.Outputs[0].ScriptClass != "datacarrier" || tx.Outputs[0].SlpToken != nil {
+		t.Fatalf("unexpected op_return output %v", tx.Outputs[0])
+	}
+	if out := tx.Outputs[2]; out.SlpToken.GetAmount() != 300 || out.SlpToken.GetAddress() == "" || out.ScriptClass != "pubkeyhash" {
+		t.Fatalf("unexpected token output %v", out)
+	}
+	info := tx.SlpTransactionInfo
+	if info.ValidityJudgement != pb.SlpTransactionInfo_VALID || info.SlpAction != pb.SlpAction_SLP_V1_SEND {
+		t.Fatalf("unexpected slp info %v", info)
+	}
+	if len(info.BurnFlags) != 1 || info.BurnFlags[0] != pb.SlpTransactionInfo_BURNED_INPUTS_GREATER_THAN_OUTPUTS {
+		t.Fatalf("expected the 100 unsent tokens to burn, got %v", info.BurnFlags)
+	}
+	if string(resp.TokenMetadata.GetV1Fungible().GetTokenName()) != "test" {
+		t.Fatalf("unexpected token metadata %v", resp.TokenMetadata)
+	}
+
+	hash = c.pending.TxHash()
+	resp, err = client.GetTransaction(ctx, &pb.GetTransactionRequest{Hash: hash[:]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx := resp.Transaction; tx.Confirmations != 0 || tx.BlockHash != nil || tx.Inputs[0].SlpToken.GetAmount() != 600 ||
+		tx.SlpTransactionInfo.ValidityJudgement != pb.SlpTransactionInfo_VALID || len(tx.SlpTransactionInfo.BurnFlags) != 0 {
+		t.Fatalf("unexpected mempool transaction %v", tx)
+	}
+
+	hash = c.child.TxHash()
+	resp, err = client.GetTransaction(ctx, &pb.GetTransactionRequest{Hash: hash[:]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupID := testTokenID(c.group)
+	if g := resp.Transaction.SlpTransactionInfo.GetV1Nft1ChildGenesis().GetGroupTokenId(); !bytes.Equal(g, groupID[:]) {
+		t.Fatalf("expected group %x, got %x", groupID[:], g)
+	}
+
+	_, err = client.GetTransaction(ctx, &pb.GetTransactionRequest{Hash: make([]byte, 32)})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+}
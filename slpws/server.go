@@ -0,0 +1,359 @@
+// Package slpws streams decoded SLP transactions to WebSocket clients from
+// an events.Bus. Clients subscribe by address, token id or transaction type
+// in the query string and resume after a reconnect from the cursor of the
+// last message they processed.
+package slpws
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gorilla/websocket"
+	"github.com/simpleledgerinc/goslp/address"
+	"github.com/simpleledgerinc/goslp/events"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+const (
+	// writeWait is the time allowed to write a message
+	writeWait = 10 * time.Second
+
+	// pingInterval is how often the connection is checked, a client that
+	// does not answer before the next ping is disconnected
+	pingInterval = 30 * time.Second
+)
+
+// Config holds the event source and connection settings of a Server
+type Config struct {
+	Bus *events.Bus
+
+	// Params decodes the addresses of subscriptions and encodes those of
+	// outputs, MainNetParams when nil
+	Params *chaincfg.Params
+
+	// Backpressure is applied to clients reading slower than events are
+	// published, by default they are sent an error and disconnected so
+	// they can resume from their last cursor
+	Backpressure events.Backpressure
+
+	// CheckOrigin accepts the Origin of a connection request, nil accepts
+	// only the host of the request
+	CheckOrigin func(r *http.Request) bool
+}
+
+// Server is an http.Handler upgrading requests to WebSocket subscriptions.
+// The query string selects the transactions streamed:
+//
+//	address     repeatable, an address in any form receiving or spending tokens
+//	tokenId     repeatable, a token id
+//	type        repeatable, GENESIS, MINT or SEND
+//	after       resume after the cursor of a message
+//	fromHeight  start with the confirmed transactions at or above a height
+//
+// Reorg messages are sent to every subscription.
+type Server struct {
+	cfg      Config
+	upgrader websocket.Upgrader
+}
+
+// NewServer creates a Server
+func NewServer(cfg Config) *Server {
+	if cfg.Params == nil {
+		cfg.Params = &chaincfg.MainNetParams
+	}
+	return &Server{
+		cfg:      cfg,
+		upgrader: websocket.Upgrader{CheckOrigin: cfg.CheckOrigin},
+	}
+}
+
+// Message is a frame sent to subscribers, Type is "tx", "reorg" or "error"
+// and selects the field set
+type Message struct {
+	Type string `json:"type"`
+
+	// Cursor is passed as the after parameter to resume after the message
+	Cursor string `json:"cursor,omitempty"`
+
+	Tx    *Tx    `json:"tx,omitempty"`
+	Reorg *Reorg `json:"reorg,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Tx is a valid SLP transaction. Unconfirmed transactions are sent again
+// with their block once they confirm.
+type Tx struct {
+	TxID      string `json:"txid"`
+	TxType    string `json:"txType"`
+	TokenID   string `json:"tokenId"`
+	TokenType int    `json:"tokenType"`
+
+	// Height is -1 for unconfirmed transactions
+	Height    int32  `json:"height"`
+	BlockHash string `json:"blockHash,omitempty"`
+
+	// Amount is the total of the token outputs in base units
+	Amount  string    `json:"amount"`
+	Outputs []*Output `json:"outputs"`
+
+	// Ticker, Name, DocumentURI and Decimals are set for GENESIS
+	// transactions, GroupID for NFT1 children
+	Ticker      string `json:"ticker,omitempty"`
+	Name        string `json:"name,omitempty"`
+	DocumentURI string `json:"documentUri,omitempty"`
+	Decimals    int    `json:"decimals,omitempty"`
+	GroupID     string `json:"groupId,omitempty"`
+}
+
+// Output is a token output of a transaction
+type Output struct {
+	Vout        int    `json:"vout"`
+	Amount      string `json:"amount"`
+	IsMintBaton bool   `json:"isMintBaton,omitempty"`
+	Address     string `json:"address,omitempty"`
+}
+
+// Reorg is a disconnected block, transactions at or above Height sent
+// before it are no longer confirmed
+type Reorg struct {
+	BlockHash string `json:"blockHash"`
+	Height    int32  `json:"height"`
+}
+
+// txTypes maps the type parameter to event types
+var txTypes = map[string]events.EventType{
+	"GENESIS": events.TypeGenesis,
+	"MINT":    events.TypeMint,
+	"SEND":    events.TypeSend,
+}
+
+// formatCursor encodes the cursor of an event
+func formatCursor(c events.Cursor) string {
+	return fmt.Sprintf("%d:%d", c.Height, c.Seq)
+}
+
+// parseCursor decodes a cursor written by formatCursor
+func parseCursor(s string) (*events.Cursor, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) == 2 {
+		height, herr := strconv.ParseInt(parts[0], 10, 32)
+		seq, serr := strconv.ParseUint(parts[1], 10, 64)
+		if herr == nil && serr == nil {
+			return &events.Cursor{Height: int32(height), Seq: seq}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid cursor %q", s)
+}
+
+// subscribeOptions parses the subscription of a request
+func (s *Server) subscribeOptions(query url.Values) (events.SubscribeOptions, error) {
+	opts := events.SubscribeOptions{Filter: &events.Filter{}, Backpressure: s.cfg.Backpressure}
+	f := opts.Filter
+	for _, a := range query["address"] {
+		addr, err := address.Decode(a, s.cfg.Params)
+		if err != nil {
+			return opts, fmt.Errorf("invalid address %q: %v", a, err)
+		}
+		f.PkScripts = append(f.PkScripts, addr.PkScript())
+	}
+	for _, v := range query["tokenId"] {
+		id, err := tokenindex.TokenIDFromString(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid token id %q", v)
+		}
+		f.TokenIDs = append(f.TokenIDs, id)
+	}
+	for _, v := range query["type"] {
+		t, ok := txTypes[strings.ToUpper(v)]
+		if !ok {
+			return opts, fmt.Errorf("invalid type %q, expected GENESIS, MINT or SEND", v)
+		}
+		f.Types = append(f.Types, t)
+	}
+	if len(f.Types) == 0 {
+		f.Types = []events.EventType{events.TypeGenesis, events.TypeMint, events.TypeSend}
+	}
+	f.Types = append(f.Types, events.TypeReorg)
+
+	if v := query.Get("after"); v != "" {
+		c, err := parseCursor(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.After = c
+	} else if v := query.Get("fromHeight"); v != "" {
+		h, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return opts, fmt.Errorf("invalid fromHeight %q", v)
+		}
+		height := int32(h)
+		opts.FromHeight = &height
+	}
+	return opts, nil
+}
+
+// ServeHTTP upgrades the request and streams the subscribed transactions
+// until the client disconnects
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// subscribing before the handshake delivers every event published once
+	// the client is connected
+	opts, err := s.subscribeOptions(r.URL.Query())
+	var sub *events.Subscription
+	if err == nil {
+		sub, err = s.cfg.Bus.Subscribe(opts)
+	}
+	if sub != nil {
+		defer sub.Close()
+	}
+	conn, uerr := s.upgrader.Upgrade(w, r, nil)
+	if uerr != nil {
+		// Upgrade replied with an HTTP error
+		return
+	}
+	defer conn.Close()
+	if err != nil {
+		// errors are sent as messages so browser clients can read them
+		closeWithError(conn, websocket.ClosePolicyViolation, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the reader answers control frames and ends the stream when the
+	// client goes away, clients are not expected to send messages
+	go func() {
+		defer cancel()
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(2 * pingInterval))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * pingInterval))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	type next struct {
+		e   events.Event
+		err error
+	}
+	nexts := make(chan next)
+	go func() {
+		for {
+			e, err := sub.Next(ctx)
+			select {
+			case nexts <- next{e, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case n := <-nexts:
+			if n.err != nil {
+				if n.err != context.Canceled {
+					closeWithError(conn, websocket.CloseTryAgainLater, n.err)
+				}
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteJSON(s.message(n.e)); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// closeWithError sends err as a message then closes the connection with
+// code
+func closeWithError(conn *websocket.Conn, code int, err error) {
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if conn.WriteJSON(&Message{Type: "error", Error: err.Error()}) != nil {
+		return
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(writeWait))
+}
+
+// message converts an event of the subscription to a Message
+func (s *Server) message(e events.Event) *Message {
+	info := e.Info()
+	m := &Message{Type: "tx", Cursor: formatCursor(info.Cursor)}
+	tx := &Tx{
+		TxID:      info.TxHash.String(),
+		TokenID:   info.TokenID.String(),
+		TokenType: int(info.TokenType),
+		Height:    info.Height,
+	}
+	if info.Confirmed() {
+		tx.BlockHash = info.BlockHash.String()
+	}
+
+	var outputs []*tokenindex.TokenUtxo
+	switch e := e.(type) {
+	case *events.GenesisEvent:
+		tx.TxType = "GENESIS"
+		outputs = e.Outputs
+		if meta := e.Metadata; meta != nil {
+			tx.Ticker = string(meta.Ticker)
+			tx.Name = string(meta.Name)
+			tx.DocumentURI = string(meta.DocumentURI)
+			tx.Decimals = meta.Decimals
+			if meta.GroupID != nil && info.TokenType == v1parser.TokenTypeNft1Child41 {
+				tx.GroupID = meta.GroupID.String()
+			}
+		}
+	case *events.MintEvent:
+		tx.TxType = "MINT"
+		outputs = e.Outputs
+	case *events.SendEvent:
+		tx.TxType = "SEND"
+		outputs = e.Outputs
+	case *events.ReorgEvent:
+		return &Message{
+			Type:   "reorg",
+			Cursor: m.Cursor,
+			Reorg:  &Reorg{BlockHash: info.BlockHash.String(), Height: info.Height},
+		}
+	}
+
+	total := new(big.Int)
+	tx.Outputs = make([]*Output, 0, len(outputs))
+	for i, u := range outputs {
+		if u == nil {
+			continue
+		}
+		total.Add(total, new(big.Int).SetUint64(u.Amount))
+		out := &Output{Vout: i, Amount: strconv.FormatUint(u.Amount, 10), IsMintBaton: u.IsMintBaton}
+		if addr, err := address.FromPkScript(u.PkScript, s.cfg.Params); err == nil {
+			out.Address = addr.String()
+		}
+		tx.Outputs = append(tx.Outputs, out)
+	}
+	tx.Amount = total.String()
+	m.Tx = tx
+	return m
+}
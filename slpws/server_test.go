@@ -0,0 +1,184 @@
+package slpws
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/wire"
+	"github.com/gorilla/websocket"
+	"github.com/simpleledgerinc/goslp/address"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+)
+
+func testAddress(t *testing.T, b byte) *address.Address {
+	addr, err := address.NewAddressPubKeyHash(bytes.Repeat([]byte{b}, 20), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
+
+// testTx creates a transaction spending spends with slpMsg at output 0
+// followed by one output per receiver
+func testTx(slpMsg []byte, spends []wire.OutPoint, receivers ...*address.Address) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	for i := range spends {
+		tx.AddTxIn(wire.NewTxIn(&spends[i], nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, slpMsg))
+	for _, addr := range receivers {
+		tx.AddTxOut(wire.NewTxOut(546, addr.PkScript()))
+	}
+	return tx
+}
+
+func testTokenID(tx *wire.MsgTx) tokenindex.TokenID {
+	hash := tx.TxHash()
+	var id tokenindex.TokenID
+	for i := range hash {
+		id[i] = hash[len(hash)-1-i]
+	}
+	return id
+}
+
+func dial(t *testing.T, srv *httptest.Server, query url.Values) *websocket.Conn {
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/?" + query.Encode()
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) *Message {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	m := &Message{}
+	if err := conn.ReadJSON(m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSubscribe(t *testing.T) {
+	sim := NewSimulator(nil)
+	srv := httptest.NewServer(NewServer(Config{Bus: sim.Bus}))
+	defer srv.Close()
+	alice, bob := testAddress(t, 1), testAddress(t, 2)
+
+	genesisMsg, err := metadatamaker.CreateOpReturnGenesis(0x01, []byte("TST"), []byte("test"), nil, nil, 2, metadatamaker.NewMintBatonVout(2), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := testTx(genesisMsg, []wire.OutPoint{{Index: 1}}, alice, alice)
+	id := testTokenID(genesis)
+	sendMsg, err := metadatamaker.CreateOpReturnSend(0x01, id[:], []uint64{600, 400})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := testTx(sendMsg, []wire.OutPoint{{Hash: genesis.TxHash(), Index: 1}}, alice, bob)
+
+	// bob only hears about the send, first unconfirmed then confirmed
+	conn := dial(t, srv, url.Values{"address": {bob.CashAddress()}})
+	defer conn.Close()
+	if _, err := sim.Mine(genesis); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.Broadcast(send); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.Mine(); err != nil {
+		t.Fatal(err)
+	}
+
+	unconfirmed := readMessage(t, conn)
+	if unconfirmed.Type != "tx" || unconfirmed.Tx.TxID != send.TxHash().String() || unconfirmed.Tx.Height != -1 {
+		t.Fatalf("unexpected first message %+v", unconfirmed)
+	}
+	tx := unconfirmed.Tx
+	if tx.TxType != "SEND" || tx.TokenID != id.String() || tx.Amount != "1000" || len(tx.Outputs) != 2 {
+		t.Fatalf("unexpected transaction %+v", tx)
+	}
+	if out := tx.Outputs[1]; out.Vout != 2 || out.Amount != "400" || out.Address != bob.String() {
+		t.Fatalf("unexpected output %+v", out)
+	}
+	confirmed := readMessage(t, conn)
+	if confirmed.Tx == nil || confirmed.Tx.Height != 1 || confirmed.Tx.BlockHash == "" {
+		t.Fatalf("expected the confirmed send, got %+v", confirmed)
+	}
+
+	// a reconnecting client resumes after the last message it processed
+	resumed := dial(t, srv, url.Values{"address": {bob.String()}, "after": {unconfirmed.Cursor}})
+	defer resumed.Close()
+	if m := readMessage(t, resumed); m.Cursor != confirmed.Cursor || m.Tx.Height != 1 {
+		t.Fatalf("expected the confirmed send after resuming, got %+v", m)
+	}
+
+	// a reorg is sent to every subscriber and the send returns to the
+	// mempool
+	if err := sim.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if m := readMessage(t, conn); m.Type != "reorg" || m.Reorg.Height != 1 {
+		t.Fatalf("expected a reorg, got %+v", m)
+	}
+	if m := readMessage(t, conn); m.Tx == nil || m.Tx.TxID != send.TxHash().String() || m.Tx.Height != -1 {
+		t.Fatalf("expected the send back in the mempool, got %+v", m)
+	}
+}
+
+func TestSubscribeFilters(t *testing.T) {
+	sim := NewSimulator(nil)
+	srv := httptest.NewServer(NewServer(Config{Bus: sim.Bus}))
+	defer srv.Close()
+	alice := testAddress(t, 1)
+
+	genesisMsg, err := metadatamaker.CreateOpReturnGenesis(0x01, []byte("TST"), []byte("test"), []byte("https://example.com"), nil, 2, metadatamaker.NewMintBatonVout(2), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := testTx(genesisMsg, []wire.OutPoint{{Index: 1}}, alice, alice)
+	id := testTokenID(genesis)
+	mintMsg, err := metadatamaker.CreateOpReturnMint(0x01, id[:], metadatamaker.NewMintBatonVout(2), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mint := testTx(mintMsg, []wire.OutPoint{{Hash: genesis.TxHash(), Index: 2}}, alice, alice)
+	if _, err := sim.Mine(genesis); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.Mine(mint); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := dial(t, srv, url.Values{"type": {"mint"}, "tokenId": {id.String()}, "fromHeight": {"0"}})
+	defer conn.Close()
+	m := readMessage(t, conn)
+	if m.Tx == nil || m.Tx.TxType != "MINT" || m.Tx.Amount != "50" || len(m.Tx.Outputs) != 2 || !m.Tx.Outputs[1].IsMintBaton {
+		t.Fatalf("expected the mint, got %+v", m.Tx)
+	}
+
+	genesisConn := dial(t, srv, url.Values{"type": {"GENESIS"}, "fromHeight": {"0"}})
+	defer genesisConn.Close()
+	m = readMessage(t, genesisConn)
+	if m.Tx == nil || m.Tx.Ticker != "TST" || m.Tx.DocumentURI != "https://example.com" || m.Tx.Decimals != 2 {
+		t.Fatalf("expected the genesis, got %+v", m.Tx)
+	}
+
+	for _, q := range []url.Values{
+		{"type": {"BURN"}},
+		{"address": {"nonsense"}},
+		{"after": {"12"}},
+	} {
+		bad := dial(t, srv, q)
+		if m := readMessage(t, bad); m.Type != "error" || m.Error == "" {
+			t.Errorf("expected an error for %v, got %+v", q, m)
+		}
+		bad.Close()
+	}
+}
@@ -0,0 +1,119 @@
+package slpws
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/events"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+)
+
+// Simulator is an in-process chain feeding a token index, mempool and
+// event bus the way a node would, so subscribers can be tested without one.
+// Transactions are broadcast to the mempool and mined in the order given.
+type Simulator struct {
+	Index   *tokenindex.Index
+	Mempool *tokenindex.Mempool
+	Bus     *events.Bus
+
+	mtx     sync.Mutex
+	blocks  []*wire.MsgBlock
+	pending []*wire.MsgTx
+}
+
+// NewSimulator creates a simulator with an empty chain publishing to bus,
+// a new Bus when nil
+func NewSimulator(bus *events.Bus) *Simulator {
+	if bus == nil {
+		bus = events.NewBus(0)
+	}
+	idx := tokenindex.New()
+	return &Simulator{
+		Index:   idx,
+		Mempool: tokenindex.NewMempool(idx.Lookup),
+		Bus:     bus,
+	}
+}
+
+// Broadcast adds tx to the mempool and publishes its events
+func (s *Simulator) Broadcast(tx *wire.MsgTx) (*tokenindex.TxResult, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	res, err := s.Mempool.AddTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	s.pending = append(s.pending, tx)
+	s.Bus.MempoolTx(res)
+	return res, nil
+}
+
+// Mine connects a block holding the broadcast transactions followed by
+// txs, which skip the mempool
+func (s *Simulator) Mine(txs ...*wire.MsgTx) (*wire.MsgBlock, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var prev chainhash.Hash
+	height := int32(len(s.blocks))
+	if height > 0 {
+		prev = s.blocks[height-1].BlockHash()
+	}
+	header := wire.NewBlockHeader(1, &prev, &chainhash.Hash{}, 0, uint32(height))
+	header.Timestamp = time.Unix(1600000000+int64(height)*600, 0)
+	block := wire.NewMsgBlock(header)
+	for _, tx := range append(s.pending, txs...) {
+		block.AddTransaction(tx)
+	}
+
+	results, err := s.Index.ConnectBlock(block, height)
+	if err != nil {
+		return nil, err
+	}
+	s.blocks = append(s.blocks, block)
+	s.pending = nil
+	s.Mempool.BlockConnected(block)
+	s.Bus.BlockConnected(block.BlockHash(), height, results)
+	return block, nil
+}
+
+// Disconnect disconnects the tip block, returning its transactions to the
+// mempool where their events are published again as unconfirmed
+func (s *Simulator) Disconnect() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	undo, err := s.Index.DisconnectBlock()
+	if err != nil {
+		return err
+	}
+	block := s.blocks[len(s.blocks)-1]
+	s.blocks = s.blocks[:len(s.blocks)-1]
+	s.Bus.BlockDisconnected(undo)
+
+	s.Mempool.BlockDisconnected(block)
+	readded := make([]*wire.MsgTx, 0, len(block.Transactions)+len(s.pending))
+	for _, tx := range block.Transactions {
+		if e := s.Mempool.Entry(tx.TxHash()); e != nil {
+			readded = append(readded, tx)
+			s.Bus.MempoolTx(e.Result)
+		}
+	}
+	// broadcast transactions conflicting with the block were evicted
+	for _, tx := range s.pending {
+		if s.Mempool.Entry(tx.TxHash()) != nil {
+			readded = append(readded, tx)
+		}
+	}
+	s.pending = readded
+	return nil
+}
+
+// Height returns the height of the tip, -1 before the first block
+func (s *Simulator) Height() int32 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return int32(len(s.blocks)) - 1
+}
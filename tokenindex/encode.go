@@ -0,0 +1,415 @@
+package tokenindex
+
+import (
+	"encoding/binary"
+	"io"
+	"math/big"
+	"sort"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+// maxFieldSize bounds variable length fields when decoding
+const maxFieldSize = 1 << 20
+
+// encoder writes the binary encoding shared by stores and snapshots, the
+// first error is kept and later writes are skipped
+type encoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *encoder) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) uint64(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (e *encoder) int64(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.write(b[:binary.PutVarint(b[:], v)])
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.write([]byte{1})
+	} else {
+		e.write([]byte{0})
+	}
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint64(uint64(len(b)))
+	e.write(b)
+}
+
+func (e *encoder) bigInt(v *big.Int) {
+	e.bool(v.Sign() < 0)
+	e.bytes(v.Bytes())
+}
+
+func (e *encoder) outPoint(op wire.OutPoint) {
+	e.write(op.Hash[:])
+	e.uint64(uint64(op.Index))
+}
+
+// decoder reads what encoder writes, the first error is kept and later
+// reads return zero values
+type decoder struct {
+	r   io.ByteReader
+	err error
+}
+
+func newDecoder(r io.Reader) *decoder {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = &byteReader{r: r}
+	}
+	return &decoder{r: br}
+}
+
+// byteReader adds io.ByteReader to readers without it
+type byteReader struct {
+	r io.Reader
+	b [1]byte
+}
+
+func (b *byteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(b.r, b.b[:])
+	return b.b[0], err
+}
+
+func (d *decoder) read(b []byte) {
+	for i := range b {
+		if d.err != nil {
+			return
+		}
+		b[i], d.err = d.r.ReadByte()
+	}
+}
+
+func (d *decoder) uint64() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	d.err = err
+	return v
+}
+
+func (d *decoder) int64() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	d.err = err
+	return v
+}
+
+func (d *decoder) bool() bool {
+	var b [1]byte
+	d.read(b[:])
+	return b[0] != 0
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uint64()
+	if d.err != nil {
+		return nil
+	}
+	if n > maxFieldSize {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := make([]byte, n)
+	d.read(b)
+	return b
+}
+
+func (d *decoder) bigInt() *big.Int {
+	neg := d.bool()
+	v := new(big.Int).SetBytes(d.bytes())
+	if neg {
+		v.Neg(v)
+	}
+	return v
+}
+
+func (d *decoder) hash() chainhash.Hash {
+	var h chainhash.Hash
+	d.read(h[:])
+	return h
+}
+
+func (d *decoder) tokenID() TokenID {
+	var id TokenID
+	d.read(id[:])
+	return id
+}
+
+func (d *decoder) outPoint() wire.OutPoint {
+	h := d.hash()
+	return wire.OutPoint{Hash: h, Index: uint32(d.uint64())}
+}
+
+func (e *encoder) tokenUtxo(u *TokenUtxo) {
+	e.write(u.TokenID[:])
+	e.uint64(uint64(u.TokenType))
+	e.uint64(u.Amount)
+	e.bool(u.IsMintBaton)
+	e.int64(u.Value)
+	e.bytes(u.PkScript)
+	e.int64(int64(u.Height))
+}
+
+func (d *decoder) tokenUtxo(u *TokenUtxo) {
+	u.TokenID = d.tokenID()
+	u.TokenType = v1parser.TokenType(d.uint64())
+	u.Amount = d.uint64()
+	u.IsMintBaton = d.bool()
+	u.Value = d.int64()
+	u.PkScript = d.bytes()
+	u.Height = int32(d.int64())
+}
+
+// Serialize writes the binary encoding of u to w
+func (u *TokenUtxo) Serialize(w io.Writer) error {
+	e := &encoder{w: w}
+	e.tokenUtxo(u)
+	return e.err
+}
+
+// Deserialize reads the binary encoding written by Serialize
+func (u *TokenUtxo) Deserialize(r io.Reader) error {
+	d := newDecoder(r)
+	d.tokenUtxo(u)
+	return d.err
+}
+
+// Serialize writes the binary encoding of m to w
+func (m *TokenMetadata) Serialize(w io.Writer) error {
+	e := &encoder{w: w}
+	e.write(m.TokenID[:])
+	e.uint64(uint64(m.TokenType))
+	e.bytes(m.Ticker)
+	e.bytes(m.Name)
+	e.bytes(m.DocumentURI)
+	e.bytes(m.DocumentHash)
+	e.int64(int64(m.Decimals))
+	e.write(m.GenesisTx[:])
+	e.int64(int64(m.GenesisHeight))
+	e.bool(m.GroupID != nil)
+	if m.GroupID != nil {
+		e.write(m.GroupID[:])
+	}
+	return e.err
+}
+
+// Deserialize reads the binary encoding written by Serialize
+func (m *TokenMetadata) Deserialize(r io.Reader) error {
+	d := newDecoder(r)
+	m.TokenID = d.tokenID()
+	m.TokenType = v1parser.TokenType(d.uint64())
+	m.Ticker = d.bytes()
+	m.Name = d.bytes()
+	m.DocumentURI = d.bytes()
+	m.DocumentHash = d.bytes()
+	m.Decimals = int(d.int64())
+	m.GenesisTx = d.hash()
+	m.GenesisHeight = int32(d.int64())
+	m.GroupID = nil
+	if d.bool() {
+		groupID := d.tokenID()
+		m.GroupID = &groupID
+	}
+	return d.err
+}
+
+// burns writes burns ordered by category
+func (e *encoder) burns(burns map[BurnCategory]*big.Int) {
+	categories := make([]int, 0, len(burns))
+	for c := range burns {
+		categories = append(categories, int(c))
+	}
+	sort.Ints(categories)
+	e.uint64(uint64(len(categories)))
+	for _, c := range categories {
+		e.uint64(uint64(c))
+		e.bigInt(burns[BurnCategory(c)])
+	}
+}
+
+func (d *decoder) burns() map[BurnCategory]*big.Int {
+	n := d.uint64()
+	burns := make(map[BurnCategory]*big.Int)
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		c := BurnCategory(d.uint64())
+		burns[c] = d.bigInt()
+	}
+	return burns
+}
+
+// Serialize writes the binary encoding of s to w
+func (s *TokenStats) Serialize(w io.Writer) error {
+	e := &encoder{w: w}
+	e.write(s.TokenID[:])
+	e.uint64(uint64(s.TokenType))
+	e.uint64(s.GenesisQuantity)
+	e.bigInt(s.Minted)
+	e.bigInt(s.Burned)
+	e.burns(s.Burns)
+	e.bigInt(s.Circulating)
+	e.int64(int64(s.Outputs))
+	e.int64(int64(s.Addresses))
+	e.bool(s.Baton != nil)
+	if s.Baton != nil {
+		e.outPoint(*s.Baton)
+	}
+	return e.err
+}
+
+// Deserialize reads the binary encoding written by Serialize
+func (s *TokenStats) Deserialize(r io.Reader) error {
+	d := newDecoder(r)
+	s.TokenID = d.tokenID()
+	s.TokenType = v1parser.TokenType(d.uint64())
+	s.GenesisQuantity = d.uint64()
+	s.Minted = d.bigInt()
+	s.Burned = d.bigInt()
+	s.Burns = d.burns()
+	s.Circulating = d.bigInt()
+	s.Outputs = int(d.int64())
+	s.Addresses = int(d.int64())
+	s.Baton = nil
+	if d.bool() {
+		op := d.outPoint()
+		s.Baton = &op
+	}
+	return d.err
+}
+
+// Serialize writes the binary encoding of u to w
+func (u *BlockUndo) Serialize(w io.Writer) error {
+	e := &encoder{w: w}
+	e.write(u.Hash[:])
+	e.write(u.PrevHash[:])
+	e.int64(int64(u.Height))
+
+	e.uint64(uint64(len(u.Spent)))
+	for _, s := range u.Spent {
+		e.outPoint(s.OutPoint)
+		e.tokenUtxo(s.Utxo)
+	}
+	e.uint64(uint64(len(u.Created)))
+	for _, op := range u.Created {
+		e.outPoint(op)
+	}
+	e.uint64(uint64(len(u.SlpTxs)))
+	for _, h := range u.SlpTxs {
+		e.write(h[:])
+	}
+
+	e.uint64(uint64(len(u.BatonMoves)))
+	for _, m := range u.BatonMoves {
+		e.write(m.TokenID[:])
+		e.bool(m.From != nil)
+		if m.From != nil {
+			e.outPoint(*m.From)
+		}
+		e.bool(m.To != nil)
+		if m.To != nil {
+			e.outPoint(*m.To)
+		}
+	}
+
+	e.uint64(uint64(len(u.Deltas)))
+	for _, d := range u.Deltas {
+		e.write(d.TokenID[:])
+		e.uint64(uint64(d.TokenType))
+		e.bool(d.IsGenesis)
+		e.uint64(d.Genesis)
+		e.bigInt(d.Minted)
+		e.bigInt(d.Burned)
+		e.burns(d.Burns)
+		e.int64(int64(d.Outputs))
+
+		scripts := make([]string, 0, len(d.Holders))
+		for script := range d.Holders {
+			scripts = append(scripts, script)
+		}
+		sort.Strings(scripts)
+		e.uint64(uint64(len(scripts)))
+		for _, script := range scripts {
+			e.bytes([]byte(script))
+			e.int64(int64(d.Holders[script]))
+		}
+	}
+	return e.err
+}
+
+// Deserialize reads the binary encoding written by Serialize
+func (u *BlockUndo) Deserialize(r io.Reader) error {
+	d := newDecoder(r)
+	u.Hash = d.hash()
+	u.PrevHash = d.hash()
+	u.Height = int32(d.int64())
+
+	u.Spent = nil
+	n := d.uint64()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		s := &SpentToken{OutPoint: d.outPoint(), Utxo: new(TokenUtxo)}
+		d.tokenUtxo(s.Utxo)
+		u.Spent = append(u.Spent, s)
+	}
+	u.Created = nil
+	n = d.uint64()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		u.Created = append(u.Created, d.outPoint())
+	}
+	u.SlpTxs = nil
+	n = d.uint64()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		u.SlpTxs = append(u.SlpTxs, d.hash())
+	}
+
+	u.BatonMoves = nil
+	n = d.uint64()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		m := &BatonMove{TokenID: d.tokenID()}
+		if d.bool() {
+			op := d.outPoint()
+			m.From = &op
+		}
+		if d.bool() {
+			op := d.outPoint()
+			m.To = &op
+		}
+		u.BatonMoves = append(u.BatonMoves, m)
+	}
+
+	u.Deltas = nil
+	n = d.uint64()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		delta := newTokenDelta(d.tokenID(), v1parser.TokenType(d.uint64()))
+		delta.IsGenesis = d.bool()
+		delta.Genesis = d.uint64()
+		delta.Minted = d.bigInt()
+		delta.Burned = d.bigInt()
+		delta.Burns = d.burns()
+		delta.Outputs = int(d.int64())
+		scripts := d.uint64()
+		for j := uint64(0); j < scripts && d.err == nil; j++ {
+			script := string(d.bytes())
+			delta.Holders[script] = int(d.int64())
+		}
+		u.Deltas = append(u.Deltas, delta)
+	}
+	return d.err
+}
@@ -0,0 +1,311 @@
+package tokenindex
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+// HistoryType is the kind of token movement recorded in a HistoryEntry
+type HistoryType int
+
+const (
+	// HistoryGenesis is a valid GENESIS of the token
+	HistoryGenesis HistoryType = iota
+
+	// HistoryMint is a valid MINT of the token
+	HistoryMint
+
+	// HistorySend is a valid SEND of the token
+	HistorySend
+
+	// HistoryBurn is a transaction spending the token without carrying it
+	// forward, such as an invalid or non-SLP transaction
+	HistoryBurn
+)
+
+// String returns the name of the history type
+func (t HistoryType) String() string {
+	switch t {
+	case HistoryGenesis:
+		return "GENESIS"
+	case HistoryMint:
+		return "MINT"
+	case HistorySend:
+		return "SEND"
+	case HistoryBurn:
+		return "BURN"
+	}
+	return "unknown"
+}
+
+// Direction is whether a script received or sent tokens in a transaction
+type Direction int
+
+const (
+	// DirectionIn is a transaction only creating outputs for the script
+	DirectionIn Direction = iota
+
+	// DirectionOut is a transaction only spending outputs of the script
+	DirectionOut
+
+	// DirectionSelf is a transaction both spending and creating outputs of
+	// the script
+	DirectionSelf
+)
+
+// String returns the name of the direction
+func (d Direction) String() string {
+	switch d {
+	case DirectionIn:
+		return "in"
+	case DirectionOut:
+		return "out"
+	case DirectionSelf:
+		return "self"
+	}
+	return "unknown"
+}
+
+// HistoryEntry is the movement of one token for one script in a
+// transaction
+type HistoryEntry struct {
+	TxHash    chainhash.Hash
+	TokenID   TokenID
+	TokenType v1parser.TokenType
+	Type      HistoryType
+	Direction Direction
+
+	// Received and Sent are the amounts of the created and spent outputs
+	// of the script, Delta is their difference
+	Received *big.Int
+	Sent     *big.Int
+	Delta    *big.Int
+
+	// Height and Position locate the transaction in its block, Height is
+	// -1 for unconfirmed transactions
+	Height      int32
+	Position    int
+	Unconfirmed bool
+}
+
+// HistoryCursor is the position of an entry in the history of a script
+type HistoryCursor struct {
+	Height   int32
+	Position int
+	TokenID  TokenID
+}
+
+// Cursor returns the position of e
+func (e *HistoryEntry) Cursor() HistoryCursor {
+	return HistoryCursor{Height: e.Height, Position: e.Position, TokenID: e.TokenID}
+}
+
+// less orders cursors by height, position then token id
+func (c HistoryCursor) less(o HistoryCursor) bool {
+	if c.Height != o.Height {
+		return c.Height < o.Height
+	}
+	if c.Position != o.Position {
+		return c.Position < o.Position
+	}
+	return bytes.Compare(c.TokenID[:], o.TokenID[:]) < 0
+}
+
+// historyEntries returns the entries of res by script, in token id order
+// for each script
+func historyEntries(res *TxResult, height int32, position int) map[string][]*HistoryEntry {
+	type key struct {
+		script  string
+		tokenID TokenID
+	}
+	entries := make(map[key]*HistoryEntry)
+	var keys []key
+	get := func(u *TokenUtxo) *HistoryEntry {
+		k := key{string(u.PkScript), u.TokenID}
+		e, ok := entries[k]
+		if !ok {
+			e = &HistoryEntry{
+				TxHash:      res.TxHash,
+				TokenID:     u.TokenID,
+				TokenType:   u.TokenType,
+				Type:        HistoryBurn,
+				Received:    new(big.Int),
+				Sent:        new(big.Int),
+				Height:      height,
+				Position:    position,
+				Unconfirmed: height < 0,
+			}
+			if res.Valid && u.TokenID == res.TokenID {
+				switch res.SlpMsg.(type) {
+				case *v1parser.SlpGenesis:
+					e.Type = HistoryGenesis
+				case *v1parser.SlpMint:
+					e.Type = HistoryMint
+				case *v1parser.SlpSend:
+					e.Type = HistorySend
+				}
+			}
+			entries[k] = e
+			keys = append(keys, k)
+		}
+		return e
+	}
+
+	spent := make(map[key]bool)
+	for _, s := range res.Spent {
+		e := get(s.Utxo)
+		e.Sent.Add(e.Sent, new(big.Int).SetUint64(s.Utxo.Amount))
+		spent[key{string(s.Utxo.PkScript), s.Utxo.TokenID}] = true
+	}
+	received := make(map[key]bool)
+	for _, u := range res.Outputs {
+		if u == nil {
+			continue
+		}
+		e := get(u)
+		e.Received.Add(e.Received, new(big.Int).SetUint64(u.Amount))
+		received[key{string(u.PkScript), u.TokenID}] = true
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i].tokenID[:], keys[j].tokenID[:]) < 0
+	})
+	byScript := make(map[string][]*HistoryEntry)
+	for _, k := range keys {
+		e := entries[k]
+		e.Delta = new(big.Int).Sub(e.Received, e.Sent)
+		switch {
+		case spent[k] && received[k]:
+			e.Direction = DirectionSelf
+		case spent[k]:
+			e.Direction = DirectionOut
+		}
+		byScript[k.script] = append(byScript[k.script], e)
+	}
+	return byScript
+}
+
+// History records the token movements of every output script as blocks are
+// connected and disconnected. It is kept in memory only and is not written
+// to the Store, so after a restart it must be rebuilt by rescanning the
+// blocks of interest through BlockConnected.
+type History struct {
+	mtx     sync.RWMutex
+	mempool *Mempool
+
+	// scripts holds the entries of every script in chain order, heights
+	// holds the scripts touched by every block
+	scripts map[string][]*HistoryEntry
+	heights map[int32][]string
+}
+
+// NewHistory creates an empty History, unconfirmed entries are read from
+// mempool when it is not nil
+func NewHistory(mempool *Mempool) *History {
+	return &History{
+		mempool: mempool,
+		scripts: make(map[string][]*HistoryEntry),
+		heights: make(map[int32][]string),
+	}
+}
+
+// BlockConnected records the results of a block returned by
+// Index.ConnectBlock
+func (h *History) BlockConnected(block *wire.MsgBlock, height int32, results []*TxResult) {
+	positions := make(map[chainhash.Hash]int, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		positions[tx.TxHash()] = i
+	}
+
+	// entries are appended in position order to keep each script sorted
+	sorted := append([]*TxResult{}, results...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return positions[sorted[i].TxHash] < positions[sorted[j].TxHash]
+	})
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	touched := make(map[string]bool)
+	for _, res := range sorted {
+		for script, entries := range historyEntries(res, height, positions[res.TxHash]) {
+			h.scripts[script] = append(h.scripts[script], entries...)
+			if !touched[script] {
+				touched[script] = true
+				h.heights[height] = append(h.heights[height], script)
+			}
+		}
+	}
+}
+
+// BlockDisconnected removes the entries of a block disconnected by
+// Index.DisconnectBlock or Index.Rewind
+func (h *History) BlockDisconnected(undo *BlockUndo) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	for _, script := range h.heights[undo.Height] {
+		entries := h.scripts[script]
+		n := len(entries)
+		for n > 0 && entries[n-1].Height >= undo.Height {
+			n--
+		}
+		if n == 0 {
+			delete(h.scripts, script)
+		} else {
+			h.scripts[script] = entries[:n]
+		}
+	}
+	delete(h.heights, undo.Height)
+}
+
+// Entries returns up to limit entries of pkScript newest first, starting
+// before after when it is not nil. The first page starts with the
+// unconfirmed entries, which are not counted in limit. next is the after of
+// the following page and nil on the last page.
+func (h *History) Entries(pkScript []byte, after *HistoryCursor, limit int) (entries []*HistoryEntry, next *HistoryCursor) {
+	if after == nil && h.mempool != nil {
+		entries = h.unconfirmed(pkScript)
+	}
+
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	confirmed := h.scripts[string(pkScript)]
+	end := len(confirmed)
+	if after != nil {
+		end = sort.Search(len(confirmed), func(i int) bool {
+			return !confirmed[i].Cursor().less(*after)
+		})
+	}
+	start := 0
+	if limit > 0 && end > limit {
+		start = end - limit
+	}
+	for i := end - 1; i >= start; i-- {
+		entries = append(entries, confirmed[i])
+	}
+	if start > 0 {
+		c := confirmed[start].Cursor()
+		next = &c
+	}
+	return entries, next
+}
+
+// unconfirmed returns the mempool entries of pkScript ordered by tx hash
+func (h *History) unconfirmed(pkScript []byte) []*HistoryEntry {
+	h.mempool.mtx.RLock()
+	defer h.mempool.mtx.RUnlock()
+
+	var entries []*HistoryEntry
+	for _, e := range h.mempool.scripts[string(pkScript)] {
+		entries = append(entries, e.history[string(pkScript)]...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].TxHash[:], entries[j].TxHash[:]) < 0
+	})
+	return entries
+}
@@ -0,0 +1,97 @@
+package tokenindex
+
+import (
+	"testing"
+
+	"github.com/gcash/bchd/wire"
+)
+
+func TestHistory(t *testing.T) {
+	idx := New()
+	mp := NewMempool(idx.Lookup)
+	h := NewHistory(mp)
+
+	genesis := testGenesis(t, 0x01, 1000, true)
+	id := testTokenID(genesis)
+	gHash := genesis.TxHash()
+	b0 := testBlock(nil, genesis)
+	send := testSend(t, 0x01, id, []wire.OutPoint{{Hash: gHash, Index: 1}}, 600, 300)
+	send.TxOut[2].PkScript = []byte{0x52}
+	mint := testMint(t, id, wire.OutPoint{Hash: gHash, Index: 2}, 50)
+	b1 := testBlock(b0, send, mint)
+	burn := testTx([]byte{0x51}, []wire.OutPoint{{Hash: send.TxHash(), Index: 2}}, 1)
+	b2 := testBlock(b1, burn)
+	for i, block := range []*wire.MsgBlock{b0, b1, b2} {
+		results, err := idx.ConnectBlock(block, int32(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.BlockConnected(block, int32(i), results)
+	}
+
+	var all []*HistoryEntry
+	var after *HistoryCursor
+	for page := 0; ; page++ {
+		entries, next := h.Entries(testPkScript, after, 2)
+		all = append(all, entries...)
+		if next == nil {
+			break
+		}
+		if page > 2 {
+			t.Fatal("paging does not end")
+		}
+		after = next
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(all))
+	}
+	for i, want := range []struct {
+		tx        *wire.MsgTx
+		typ       HistoryType
+		direction Direction
+		delta     int64
+	}{
+		{mint, HistoryMint, DirectionSelf, 50},
+		{send, HistorySend, DirectionSelf, -400},
+		{genesis, HistoryGenesis, DirectionIn, 1000},
+	} {
+		e := all[i]
+		if e.TxHash != want.tx.TxHash() || e.Type != want.typ || e.Direction != want.direction || e.Delta.Int64() != want.delta {
+			t.Errorf("entry %d: got %v %v %v, want %v %v %v", i, e.Type, e.Direction, e.Delta, want.typ, want.direction, want.delta)
+		}
+	}
+	if all[0].Height != 1 || all[0].Position != 1 {
+		t.Errorf("unexpected mint position %d:%d", all[0].Height, all[0].Position)
+	}
+
+	entries, _ := h.Entries([]byte{0x52}, nil, 0)
+	if len(entries) != 2 || entries[0].Type != HistoryBurn || entries[0].Direction != DirectionOut || entries[0].Delta.Int64() != -300 {
+		t.Fatalf("unexpected burn history %+v", entries)
+	}
+
+	// unconfirmed entries lead the first page only
+	pending := testSend(t, 0x01, id, []wire.OutPoint{{Hash: mint.TxHash(), Index: 1}}, 50)
+	if _, err := mp.AddTx(pending); err != nil {
+		t.Fatal(err)
+	}
+	entries, next := h.Entries(testPkScript, nil, 1)
+	if len(entries) != 2 || !entries[0].Unconfirmed || entries[0].TxHash != pending.TxHash() || entries[1].Unconfirmed {
+		t.Fatalf("expected unconfirmed entry first, got %+v", entries)
+	}
+	if entries, _ := h.Entries(testPkScript, next, 1); len(entries) != 1 || entries[0].Unconfirmed {
+		t.Errorf("expected no unconfirmed entries on later pages, got %+v", entries)
+	}
+	mp.RemoveTx(pending.TxHash())
+	if entries, _ := h.Entries(testPkScript, nil, 1); len(entries) != 1 || entries[0].Unconfirmed {
+		t.Errorf("expected removed unconfirmed entry gone, got %+v", entries)
+	}
+
+	undo, err := idx.DisconnectBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.BlockDisconnected(undo)
+	if entries, _ := h.Entries([]byte{0x52}, nil, 0); len(entries) != 1 || entries[0].Type != HistorySend {
+		t.Errorf("expected burn entry removed, got %+v", entries)
+	}
+}
@@ -0,0 +1,208 @@
+package tokenindex
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/address"
+)
+
+// HolderOptions filters a holder snapshot, the zero value keeps every
+// holder
+type HolderOptions struct {
+	// ExcludeBatonHolders leaves out scripts holding a mint baton of the
+	// token, usually the issuer
+	ExcludeBatonHolders bool
+
+	// ExcludePkScripts leaves out known scripts such as exchange addresses
+	ExcludePkScripts [][]byte
+
+	// MinBalance leaves out holders with a smaller balance
+	MinBalance uint64
+
+	// Params encodes the holder addresses, they are left empty when nil
+	Params *chaincfg.Params
+}
+
+// Holder is the balance of one output script
+type Holder struct {
+	PkScript []byte
+
+	// Address is the slp address of PkScript, empty when it has none
+	Address string
+
+	Balance uint64
+	Outputs []*OutPointUtxo
+}
+
+// key identifies the holder in Balances
+func (h *Holder) key() string {
+	if h.Address != "" {
+		return h.Address
+	}
+	return hex.EncodeToString(h.PkScript)
+}
+
+// HolderSnapshot is the rich list of a token at a block
+type HolderSnapshot struct {
+	TokenID TokenID
+	Hash    chainhash.Hash
+	Height  int32
+
+	// Holders are ordered by descending balance then script
+	Holders []*Holder
+}
+
+// Holders returns the holders of a token at the connected block at height,
+// reverting later blocks with their undo data without changing the index
+func (idx *Index) Holders(tokenID TokenID, height int32, opts *HolderOptions) (*HolderSnapshot, error) {
+	if opts == nil {
+		opts = &HolderOptions{}
+	}
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	tip, tipHeight := idx.tip()
+	if height > tipHeight {
+		return nil, ErrUnknownBlock
+	}
+	if height < idx.baseHeight {
+		return nil, ErrRewindTooDeep
+	}
+	snap := &HolderSnapshot{TokenID: tokenID, Hash: tip, Height: height}
+
+	utxos := make(map[wire.OutPoint]*TokenUtxo, len(idx.tokens[tokenID]))
+	for op, u := range idx.tokens[tokenID] {
+		utxos[op] = u
+	}
+	for i := len(idx.undo) - 1; i >= 0 && idx.undo[i].Height > height; i-- {
+		undo := idx.undo[i]
+		for _, s := range undo.Spent {
+			if s.Utxo.TokenID == tokenID {
+				utxos[s.OutPoint] = s.Utxo
+			}
+		}
+		for _, op := range undo.Created {
+			delete(utxos, op)
+		}
+		snap.Hash = undo.PrevHash
+	}
+
+	excluded := make(map[string]bool)
+	for _, script := range opts.ExcludePkScripts {
+		excluded[string(script)] = true
+	}
+	holders := make(map[string]*Holder)
+	for op, u := range utxos {
+		if u.IsMintBaton && opts.ExcludeBatonHolders {
+			excluded[string(u.PkScript)] = true
+		}
+		h, ok := holders[string(u.PkScript)]
+		if !ok {
+			h = &Holder{PkScript: u.PkScript}
+			if opts.Params != nil {
+				if addr, err := address.FromPkScript(u.PkScript, opts.Params); err == nil {
+					h.Address = addr.String()
+				}
+			}
+			holders[string(u.PkScript)] = h
+		}
+		if h.Balance+u.Amount < h.Balance {
+			return nil, errors.New("holder balance overflows uint64")
+		}
+		h.Balance += u.Amount
+		h.Outputs = append(h.Outputs, &OutPointUtxo{OutPoint: op, Utxo: u})
+	}
+
+	for script, h := range holders {
+		if excluded[script] || h.Balance == 0 || h.Balance < opts.MinBalance {
+			continue
+		}
+		sortOutPoints(h.Outputs)
+		snap.Holders = append(snap.Holders, h)
+	}
+	sort.Slice(snap.Holders, func(i, j int) bool {
+		a, b := snap.Holders[i], snap.Holders[j]
+		if a.Balance != b.Balance {
+			return a.Balance > b.Balance
+		}
+		return bytes.Compare(a.PkScript, b.PkScript) < 0
+	})
+	return snap, nil
+}
+
+// Balances returns the balances keyed by address, or by hex script for
+// holders without one, as airdrop.Plan expects
+func (s *HolderSnapshot) Balances() map[string]uint64 {
+	balances := make(map[string]uint64, len(s.Holders))
+	for _, h := range s.Holders {
+		balances[h.key()] += h.Balance
+	}
+	return balances
+}
+
+// WriteCSV writes one row per holder with the address, script, balance in
+// base units and number of outputs
+func (s *HolderSnapshot) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"address", "pk_script", "balance", "outputs"}); err != nil {
+		return err
+	}
+	for _, h := range s.Holders {
+		row := []string{
+			h.Address,
+			hex.EncodeToString(h.PkScript),
+			strconv.FormatUint(h.Balance, 10),
+			strconv.Itoa(len(h.Outputs)),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type jsonHolder struct {
+	Address  string   `json:"address,omitempty"`
+	PkScript string   `json:"pkScript"`
+	Balance  uint64   `json:"balance"`
+	Outputs  []string `json:"outputs"`
+}
+
+// WriteJSON writes the snapshot as a JSON object with the holders and
+// their outpoints
+func (s *HolderSnapshot) WriteJSON(w io.Writer) error {
+	out := struct {
+		TokenID string        `json:"tokenId"`
+		Hash    string        `json:"hash"`
+		Height  int32         `json:"height"`
+		Holders []*jsonHolder `json:"holders"`
+	}{
+		TokenID: s.TokenID.String(),
+		Hash:    s.Hash.String(),
+		Height:  s.Height,
+		Holders: make([]*jsonHolder, 0, len(s.Holders)),
+	}
+	for _, h := range s.Holders {
+		jh := &jsonHolder{
+			Address:  h.Address,
+			PkScript: hex.EncodeToString(h.PkScript),
+			Balance:  h.Balance,
+		}
+		for _, o := range h.Outputs {
+			jh.Outputs = append(jh.Outputs, o.OutPoint.String())
+		}
+		out.Holders = append(out.Holders, jh)
+	}
+	return json.NewEncoder(w).Encode(&out)
+}
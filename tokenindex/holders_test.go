@@ -0,0 +1,74 @@
+package tokenindex
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHolders(t *testing.T) {
+	idx := New()
+	id, blocks := testChain(t, idx)
+
+	snap, err := idx.Holders(id, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Hash != blocks[1].BlockHash() || len(snap.Holders) != 2 {
+		t.Fatalf("unexpected snapshot %+v", snap)
+	}
+	// the minted output adds to the send output of the same script
+	if h := snap.Holders[0]; h.Balance != 650 || len(h.Outputs) != 3 || h.PkScript[0] != 0x51 {
+		t.Errorf("unexpected largest holder %+v", h)
+	}
+	if h := snap.Holders[1]; h.Balance != 300 || h.PkScript[0] != 0x52 {
+		t.Errorf("unexpected second holder %+v", h)
+	}
+	if b := snap.Balances(); b["51"] != 650 || b["52"] != 300 {
+		t.Errorf("unexpected balances %v", b)
+	}
+
+	// the burn at height 2 removes the second holder
+	if snap, _ := idx.Holders(id, 2, nil); len(snap.Holders) != 1 {
+		t.Errorf("expected one holder at the tip, got %d", len(snap.Holders))
+	}
+	if snap, _ := idx.Holders(id, 0, nil); len(snap.Holders) != 1 || snap.Holders[0].Balance != 1000 {
+		t.Errorf("expected genesis holder at height 0, got %+v", snap.Holders)
+	}
+
+	for _, tc := range []struct {
+		opts   *HolderOptions
+		script byte
+	}{
+		{&HolderOptions{ExcludeBatonHolders: true}, 0x52},
+		{&HolderOptions{ExcludePkScripts: [][]byte{{0x52}}}, 0x51},
+		{&HolderOptions{MinBalance: 400}, 0x51},
+	} {
+		snap, err := idx.Holders(id, 1, tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snap.Holders) != 1 || snap.Holders[0].PkScript[0] != tc.script {
+			t.Errorf("unexpected holders with %+v: %+v", tc.opts, snap.Holders)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := snap.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := "address,pk_script,balance,outputs\n,51,650,3\n,52,300,1\n"; buf.String() != want {
+		t.Errorf("unexpected csv %q", buf.String())
+	}
+	buf.Reset()
+	if err := snap.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"balance":650`) {
+		t.Errorf("unexpected json %s", buf.String())
+	}
+
+	if _, err := idx.Holders(id, 3, nil); err != ErrUnknownBlock {
+		t.Errorf("expected ErrUnknownBlock, got %v", err)
+	}
+}
@@ -0,0 +1,484 @@
+package tokenindex
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+)
+
+var (
+	// ErrDoesNotConnect is returned when a block does not extend the tip
+	ErrDoesNotConnect = errors.New("block does not connect to index tip")
+
+	// ErrNoBlocks is returned when disconnecting from an empty index
+	ErrNoBlocks = errors.New("index has no connected blocks")
+
+	// ErrRewindTooDeep is returned when rewinding below the first
+	// connected block or below the blocks whose undo data is kept
+	ErrRewindTooDeep = errors.New("rewind height is below the undo journal")
+)
+
+// DefaultMaxReorgDepth is the number of blocks that can be disconnected
+// from the tip of an index created without a Config
+const DefaultMaxReorgDepth = 100
+
+// Config configures an Index
+type Config struct {
+	// MaxReorgDepth is the number of blocks below the tip whose undo data
+	// is kept, older undo data is pruned from memory and the store. It
+	// also bounds the heights of SnapshotAt and Holders. Zero uses
+	// DefaultMaxReorgDepth and a negative depth keeps every block.
+	MaxReorgDepth int32
+}
+
+// BlockUndo holds everything needed to disconnect a block
+type BlockUndo struct {
+	Hash     chainhash.Hash
+	PrevHash chainhash.Hash
+	Height   int32
+
+	// Spent are the token outputs consumed by the block
+	Spent []*SpentToken
+
+	// Created are the token outputs added by the block
+	Created []wire.OutPoint
+
+	// SlpTxs are the SLP transactions whose validity was recorded
+	SlpTxs []chainhash.Hash
+
+	// BatonMoves are the mint batons created, moved or destroyed in
+	// block order
+	BatonMoves []*BatonMove
+
+	// Deltas are the supply changes per token ordered by token id
+	Deltas []*TokenDelta
+}
+
+// Index tracks the token UTXO set as blocks are connected and disconnected
+type Index struct {
+	mtx   sync.RWMutex
+	utxos map[wire.OutPoint]*TokenUtxo
+	txs   map[chainhash.Hash]bool
+	undo  []*BlockUndo
+	stats *statsTracker
+	meta  map[TokenID]*TokenMetadata
+
+	// tokens holds the UTXO set by token, scripts by output script and
+	// children the NFT1 children of every group
+	tokens   map[TokenID]map[wire.OutPoint]*TokenUtxo
+	scripts  map[string]map[wire.OutPoint]*TokenUtxo
+	children map[TokenID]map[TokenID]bool
+
+	// base is the block the undo journal starts from, it is the tip when
+	// the journal is empty and baseHeight is -1 before any block
+	base       chainhash.Hash
+	baseHeight int32
+
+	// maxDepth is the length the journal is pruned to, pruned is true once
+	// undo data before base has been dropped
+	maxDepth int32
+	pruned   bool
+
+	// store persists every change when set, storeErr is the commit
+	// failure that left the index out of sync with the store
+	store    Store
+	storeErr error
+}
+
+// New creates an empty token UTXO index keeping DefaultMaxReorgDepth blocks
+// of undo data
+func New() *Index {
+	return NewWithConfig(Config{})
+}
+
+// NewWithConfig creates an empty token UTXO index configured by cfg
+func NewWithConfig(cfg Config) *Index {
+	maxDepth := cfg.MaxReorgDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxReorgDepth
+	}
+	return &Index{
+		utxos: make(map[wire.OutPoint]*TokenUtxo),
+		txs:   make(map[chainhash.Hash]bool),
+		stats: newStatsTracker(),
+		meta:  make(map[TokenID]*TokenMetadata),
+
+		tokens:     make(map[TokenID]map[wire.OutPoint]*TokenUtxo),
+		scripts:    make(map[string]map[wire.OutPoint]*TokenUtxo),
+		children:   make(map[TokenID]map[TokenID]bool),
+		baseHeight: -1,
+		maxDepth:   maxDepth,
+	}
+}
+
+// Tip returns the hash and height of the last connected block, the height
+// is -1 when no block has been connected
+func (idx *Index) Tip() (chainhash.Hash, int32) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	return idx.tip()
+}
+
+// tip returns the current tip, the caller must hold the lock
+func (idx *Index) tip() (chainhash.Hash, int32) {
+	if len(idx.undo) == 0 {
+		return idx.base, idx.baseHeight
+	}
+	tip := idx.undo[len(idx.undo)-1]
+	return tip.Hash, tip.Height
+}
+
+// ConnectBlock applies the transactions of block at height to the token
+// UTXO set. The first block connected to a new index may have any height,
+// later blocks must extend the tip. The results of every transaction are returned in
+// the order they were applied.
+func (idx *Index) ConnectBlock(block *wire.MsgBlock, height int32) ([]*TxResult, error) {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+
+	if idx.storeErr != nil {
+		return nil, idx.storeErr
+	}
+	if tip, tipHeight := idx.tip(); tipHeight >= 0 {
+		if block.Header.PrevBlock != tip || height != tipHeight+1 {
+			return nil, ErrDoesNotConnect
+		}
+	} else {
+		idx.base = block.Header.PrevBlock
+		idx.baseHeight = height - 1
+	}
+
+	undo := &BlockUndo{
+		Hash:     block.BlockHash(),
+		PrevHash: block.Header.PrevBlock,
+		Height:   height,
+	}
+	txs := sortTxs(block.Transactions)
+	results := make([]*TxResult, 0, len(txs))
+	deltas := make(map[TokenID]*TokenDelta)
+	for _, tx := range txs {
+		res := ApplyTx(tx, height, idx.lookup)
+		idx.apply(res, undo)
+		journalTx(res, undo, deltas)
+		if meta := NewTokenMetadata(res, height); meta != nil {
+			idx.putMeta(meta)
+		}
+		results = append(results, res)
+	}
+	undo.Deltas = sortedDeltas(deltas)
+	idx.stats.apply(undo, 1)
+	idx.undo = append(idx.undo, undo)
+	b := idx.connectBatch(undo)
+	b.DeleteUndo = idx.prune()
+	if err := idx.commit(b); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// prune drops the undo data below the maximum reorg depth and returns the
+// heights dropped, the caller must hold the lock
+func (idx *Index) prune() []int32 {
+	if idx.maxDepth < 0 || len(idx.undo) <= int(idx.maxDepth) {
+		return nil
+	}
+	n := len(idx.undo) - int(idx.maxDepth)
+	heights := make([]int32, n)
+	for i, undo := range idx.undo[:n] {
+		heights[i] = undo.Height
+	}
+	idx.base = idx.undo[n-1].Hash
+	idx.baseHeight = idx.undo[n-1].Height
+	idx.undo = append([]*BlockUndo(nil), idx.undo[n:]...)
+	idx.pruned = true
+	return heights
+}
+
+// errEmptyJournal is the error of disconnecting with an empty journal
+func (idx *Index) errEmptyJournal() error {
+	if idx.pruned {
+		return ErrRewindTooDeep
+	}
+	return ErrNoBlocks
+}
+
+// apply updates the UTXO set with res, recording changes in undo
+func (idx *Index) apply(res *TxResult, undo *BlockUndo) {
+	for _, s := range res.Spent {
+		idx.deleteUtxo(s.OutPoint)
+		undo.Spent = append(undo.Spent, s)
+	}
+	for vout, u := range res.Outputs {
+		if u == nil {
+			continue
+		}
+		op := wire.OutPoint{Hash: res.TxHash, Index: uint32(vout)}
+		idx.putUtxo(op, u)
+		undo.Created = append(undo.Created, op)
+	}
+	if res.IsSlp() {
+		idx.txs[res.TxHash] = res.Valid
+		undo.SlpTxs = append(undo.SlpTxs, res.TxHash)
+	}
+}
+
+// putUtxo adds a token output, the caller must hold the lock
+func (idx *Index) putUtxo(op wire.OutPoint, u *TokenUtxo) {
+	idx.utxos[op] = u
+	utxos, ok := idx.tokens[u.TokenID]
+	if !ok {
+		utxos = make(map[wire.OutPoint]*TokenUtxo)
+		idx.tokens[u.TokenID] = utxos
+	}
+	utxos[op] = u
+	byScript, ok := idx.scripts[string(u.PkScript)]
+	if !ok {
+		byScript = make(map[wire.OutPoint]*TokenUtxo)
+		idx.scripts[string(u.PkScript)] = byScript
+	}
+	byScript[op] = u
+}
+
+// deleteUtxo removes a token output, the caller must hold the lock
+func (idx *Index) deleteUtxo(op wire.OutPoint) {
+	u, ok := idx.utxos[op]
+	if !ok {
+		return
+	}
+	delete(idx.utxos, op)
+	delete(idx.tokens[u.TokenID], op)
+	if len(idx.tokens[u.TokenID]) == 0 {
+		delete(idx.tokens, u.TokenID)
+	}
+	delete(idx.scripts[string(u.PkScript)], op)
+	if len(idx.scripts[string(u.PkScript)]) == 0 {
+		delete(idx.scripts, string(u.PkScript))
+	}
+}
+
+// putMeta adds the metadata of a token, the caller must hold the lock
+func (idx *Index) putMeta(meta *TokenMetadata) {
+	idx.meta[meta.TokenID] = meta
+	if meta.GroupID == nil {
+		return
+	}
+	children, ok := idx.children[*meta.GroupID]
+	if !ok {
+		children = make(map[TokenID]bool)
+		idx.children[*meta.GroupID] = children
+	}
+	children[meta.TokenID] = true
+}
+
+// deleteMeta removes the metadata of a token, the caller must hold the lock
+func (idx *Index) deleteMeta(tokenID TokenID) {
+	meta, ok := idx.meta[tokenID]
+	if !ok {
+		return
+	}
+	delete(idx.meta, tokenID)
+	if meta.GroupID != nil {
+		delete(idx.children[*meta.GroupID], tokenID)
+		if len(idx.children[*meta.GroupID]) == 0 {
+			delete(idx.children, *meta.GroupID)
+		}
+	}
+}
+
+// DisconnectBlock reverts the tip block using its stored undo data and
+// returns that data. ErrRewindTooDeep is returned once the maximum reorg
+// depth has been disconnected.
+func (idx *Index) DisconnectBlock() (*BlockUndo, error) {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+
+	if idx.storeErr != nil {
+		return nil, idx.storeErr
+	}
+	return idx.disconnect()
+}
+
+// disconnect reverts the tip block, the caller must hold the lock
+func (idx *Index) disconnect() (*BlockUndo, error) {
+	n := len(idx.undo)
+	if n == 0 {
+		return nil, idx.errEmptyJournal()
+	}
+	undo := idx.undo[n-1]
+
+	// spent outputs are restored before created outputs are removed so
+	// outputs created and spent within the block end up removed
+	for _, s := range undo.Spent {
+		idx.putUtxo(s.OutPoint, s.Utxo)
+	}
+	for _, op := range undo.Created {
+		idx.deleteUtxo(op)
+	}
+	for _, h := range undo.SlpTxs {
+		delete(idx.txs, h)
+	}
+	for _, d := range undo.Deltas {
+		if d.IsGenesis {
+			idx.deleteMeta(d.TokenID)
+		}
+	}
+	idx.stats.apply(undo, -1)
+	idx.undo = idx.undo[:n-1]
+	if err := idx.commit(idx.disconnectBatch(undo)); err != nil {
+		return nil, err
+	}
+	return undo, nil
+}
+
+// Rewind disconnects blocks until the tip is at toHeight and returns their
+// undo data, tip first. Rewinding to one below the first connected block
+// empties the journal, leaving the tip at the block the index started from.
+// Heights more than the maximum reorg depth below the tip cannot be
+// reached.
+func (idx *Index) Rewind(toHeight int32) ([]*BlockUndo, error) {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+
+	if idx.storeErr != nil {
+		return nil, idx.storeErr
+	}
+	if len(idx.undo) == 0 {
+		return nil, idx.errEmptyJournal()
+	}
+	if toHeight < idx.undo[0].Height-1 {
+		return nil, ErrRewindTooDeep
+	}
+	var undos []*BlockUndo
+	for len(idx.undo) > 0 && idx.undo[len(idx.undo)-1].Height > toHeight {
+		undo, err := idx.disconnect()
+		if err != nil {
+			return undos, err
+		}
+		undos = append(undos, undo)
+	}
+	return undos, nil
+}
+
+// BlockHash returns the hash of the connected block at height, which can be
+// used to find the fork point of a competing chain
+func (idx *Index) BlockHash(height int32) (chainhash.Hash, bool) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	if height == idx.baseHeight && height >= 0 {
+		return idx.base, true
+	}
+	i := int(height - idx.baseHeight - 1)
+	if i < 0 || i >= len(idx.undo) {
+		return chainhash.Hash{}, false
+	}
+	return idx.undo[i].Hash, true
+}
+
+// lookup implements UtxoLookup, the caller must hold the lock
+func (idx *Index) lookup(op wire.OutPoint) *TokenUtxo {
+	return idx.utxos[op]
+}
+
+// Utxo returns the token output at op, or nil if op is not an unspent token
+// output
+func (idx *Index) Utxo(op wire.OutPoint) *TokenUtxo {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	return idx.utxos[op]
+}
+
+// Lookup implements UtxoLookup on the current UTXO set
+func (idx *Index) Lookup(op wire.OutPoint) *TokenUtxo {
+	return idx.Utxo(op)
+}
+
+// TxValidity returns the SLP validity of a confirmed transaction, known is
+// false for transactions that are not SLP or not yet indexed
+func (idx *Index) TxValidity(hash chainhash.Hash) (valid, known bool) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	valid, known = idx.txs[hash]
+	return valid, known
+}
+
+// Metadata returns the genesis metadata of a token, or nil when the token is
+// unknown
+func (idx *Index) Metadata(tokenID TokenID) *TokenMetadata {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	return idx.meta[tokenID]
+}
+
+// TokenStats returns a copy of the stats of a token, or nil when the token
+// is unknown
+func (idx *Index) TokenStats(tokenID TokenID) *TokenStats {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	s, ok := idx.stats.tokens[tokenID]
+	if !ok {
+		return nil
+	}
+	return s.copy()
+}
+
+// StatsSnapshot returns a copy of the stats of every token at the tip
+func (idx *Index) StatsSnapshot() *StatsSnapshot {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	snap := &StatsSnapshot{Tokens: idx.stats.snapshot()}
+	snap.Hash, snap.Height = idx.tip()
+	return snap
+}
+
+// OutPointUtxo pairs a token output with its outpoint
+type OutPointUtxo struct {
+	OutPoint wire.OutPoint
+	Utxo     *TokenUtxo
+}
+
+// TokenUtxos returns the unspent outputs of a token ordered by outpoint
+func (idx *Index) TokenUtxos(tokenID TokenID) []*OutPointUtxo {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	return idx.tokenUtxos(tokenID)
+}
+
+// tokenUtxos returns the outputs of a token, the caller must hold the lock
+func (idx *Index) tokenUtxos(tokenID TokenID) []*OutPointUtxo {
+	var res []*OutPointUtxo
+	for op, u := range idx.tokens[tokenID] {
+		res = append(res, &OutPointUtxo{OutPoint: op, Utxo: u})
+	}
+	sortOutPoints(res)
+	return res
+}
+
+// ScriptUtxos returns the unspent token outputs paying to pkScript ordered
+// by outpoint
+func (idx *Index) ScriptUtxos(pkScript []byte) []*OutPointUtxo {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	var res []*OutPointUtxo
+	for op, u := range idx.scripts[string(pkScript)] {
+		res = append(res, &OutPointUtxo{OutPoint: op, Utxo: u})
+	}
+	sortOutPoints(res)
+	return res
+}
+
+// sortOutPoints orders utxos by txid then output index
+func sortOutPoints(utxos []*OutPointUtxo) {
+	sort.Slice(utxos, func(i, j int) bool {
+		a, b := utxos[i].OutPoint, utxos[j].OutPoint
+		if c := bytes.Compare(a.Hash[:], b.Hash[:]); c != 0 {
+			return c < 0
+		}
+		return a.Index < b.Index
+	})
+}
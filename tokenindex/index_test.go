@@ -0,0 +1,242 @@
+package tokenindex
+
+import (
+	"testing"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+)
+
+var testPkScript = []byte{0x51}
+
+// testTx creates a transaction spending spends with slpMsg at output 0
+// followed by n outputs
+func testTx(slpMsg []byte, spends []wire.OutPoint, n int) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	for i := range spends {
+		tx.AddTxIn(wire.NewTxIn(&spends[i], nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, slpMsg))
+	for i := 0; i < n; i++ {
+		tx.AddTxOut(wire.NewTxOut(546, testPkScript))
+	}
+	return tx
+}
+
+// testBlock creates a block extending prev, which may be nil
+func testBlock(prev *wire.MsgBlock, txs ...*wire.MsgTx) *wire.MsgBlock {
+	var prevHash chainhash.Hash
+	var nonce uint32
+	if prev != nil {
+		prevHash = prev.BlockHash()
+		nonce = prev.Header.Nonce + 1
+	}
+	block := wire.NewMsgBlock(wire.NewBlockHeader(1, &prevHash, &chainhash.Hash{}, 0, nonce))
+	for _, tx := range txs {
+		block.AddTransaction(tx)
+	}
+	return block
+}
+
+func testGenesis(t *testing.T, tokenType int, qty uint64, baton bool) *wire.MsgTx {
+	var batonVout *metadatamaker.MintBatonVout
+	if baton {
+		batonVout = metadatamaker.NewMintBatonVout(2)
+	}
+	decimals := 0
+	slpMsg, err := metadatamaker.CreateOpReturnGenesis(tokenType, []byte("T"), []byte("test"), nil, nil, decimals, batonVout, qty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a unique input keeps genesis txids distinct
+	return testTx(slpMsg, []wire.OutPoint{{Index: uint32(qty)}}, 2)
+}
+
+func testTokenID(tx *wire.MsgTx) TokenID {
+	hash := tx.TxHash()
+	var id TokenID
+	for i := range hash {
+		id[i] = hash[len(hash)-1-i]
+	}
+	return id
+}
+
+func testSend(t *testing.T, tokenType int, id TokenID, spends []wire.OutPoint, amounts ...uint64) *wire.MsgTx {
+	slpMsg, err := metadatamaker.CreateOpReturnSend(tokenType, id[:], amounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testTx(slpMsg, spends, len(amounts))
+}
+
+func testMint(t *testing.T, id TokenID, baton wire.OutPoint, qty uint64) *wire.MsgTx {
+	slpMsg, err := metadatamaker.CreateOpReturnMint(0x01, id[:], metadatamaker.NewMintBatonVout(2), qty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testTx(slpMsg, []wire.OutPoint{baton}, 2)
+}
+
+func TestIndexConnectDisconnect(t *testing.T) {
+	idx := New()
+
+	genesis := testGenesis(t, 0x01, 1000, true)
+	id := testTokenID(genesis)
+	gHash := genesis.TxHash()
+	b0 := testBlock(nil, genesis)
+	if _, err := idx.ConnectBlock(b0, 100); err != nil {
+		t.Fatal(err)
+	}
+	if u := idx.Utxo(wire.OutPoint{Hash: gHash, Index: 1}); u == nil || u.Amount != 1000 || u.TokenID != id {
+		t.Fatalf("expected genesis output, got %+v", u)
+	}
+	if u := idx.Utxo(wire.OutPoint{Hash: gHash, Index: 2}); u == nil || !u.IsMintBaton {
+		t.Fatal("expected mint baton")
+	}
+
+	send := testSend(t, 0x01, id, []wire.OutPoint{{Hash: gHash, Index: 1}}, 600, 400)
+	mint := testMint(t, id, wire.OutPoint{Hash: gHash, Index: 2}, 50)
+	bogus := testSend(t, 0x01, id, []wire.OutPoint{{Index: 7}}, 10)
+
+	// the child is listed before its parent as canonical ordering allows
+	child := testSend(t, 0x01, id, []wire.OutPoint{{Hash: send.TxHash(), Index: 2}}, 400)
+	b1 := testBlock(b0, child, bogus, mint, send)
+	results, err := idx.ConnectBlock(b1, 101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+
+	if valid, known := idx.TxValidity(bogus.TxHash()); !known || valid {
+		t.Error("expected bogus send to be invalid")
+	}
+	if valid, _ := idx.TxValidity(child.TxHash()); !valid {
+		t.Error("expected child send to be valid")
+	}
+	if n := len(idx.TokenUtxos(id)); n != 4 {
+		t.Errorf("expected 4 token utxos, got %d", n)
+	}
+	if u := idx.Utxo(wire.OutPoint{Hash: mint.TxHash(), Index: 1}); u == nil || u.Amount != 50 {
+		t.Error("expected minted output")
+	}
+
+	if _, err := idx.ConnectBlock(testBlock(nil), 102); err != ErrDoesNotConnect {
+		t.Errorf("expected ErrDoesNotConnect, got %v", err)
+	}
+
+	undo, err := idx.DisconnectBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if undo.Hash != b1.BlockHash() {
+		t.Error("disconnected wrong block")
+	}
+	utxos := idx.TokenUtxos(id)
+	if len(utxos) != 2 {
+		t.Fatalf("expected genesis outputs restored, got %d utxos", len(utxos))
+	}
+	if _, known := idx.TxValidity(send.TxHash()); known {
+		t.Error("validity of disconnected tx was kept")
+	}
+	if hash, height := idx.Tip(); hash != b0.BlockHash() || height != 100 {
+		t.Error("unexpected tip after disconnect")
+	}
+
+	if _, err := idx.DisconnectBlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.DisconnectBlock(); err != ErrNoBlocks {
+		t.Errorf("expected ErrNoBlocks, got %v", err)
+	}
+}
+
+func TestScriptUtxos(t *testing.T) {
+	idx := New()
+	genesis := testGenesis(t, 0x01, 1000, true)
+	id := testTokenID(genesis)
+	send := testSend(t, 0x01, id, []wire.OutPoint{{Hash: genesis.TxHash(), Index: 1}}, 600, 400)
+	send.TxOut[2].PkScript = []byte{0x52}
+	b0 := testBlock(nil, genesis)
+	if _, err := idx.ConnectBlock(b0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.ConnectBlock(testBlock(b0, send), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the baton and the first send output stay with testPkScript
+	utxos := idx.ScriptUtxos(testPkScript)
+	if len(utxos) != 2 {
+		t.Fatalf("expected 2 utxos, got %d", len(utxos))
+	}
+	if other := idx.ScriptUtxos([]byte{0x52}); len(other) != 1 || other[0].Utxo.Amount != 400 {
+		t.Fatalf("unexpected utxos of the other script %+v", other)
+	}
+
+	if _, err := idx.DisconnectBlock(); err != nil {
+		t.Fatal(err)
+	}
+	if other := idx.ScriptUtxos([]byte{0x52}); len(other) != 0 {
+		t.Fatalf("expected disconnected outputs removed, got %+v", other)
+	}
+	if utxos := idx.ScriptUtxos(testPkScript); len(utxos) != 2 || utxos[0].Utxo.Amount+utxos[1].Utxo.Amount != 1000 {
+		t.Fatalf("expected genesis outputs restored, got %+v", utxos)
+	}
+}
+
+func TestApplyTxSendExceedsInputs(t *testing.T) {
+	genesis := testGenesis(t, 0x01, 100, false)
+	id := testTokenID(genesis)
+	op := wire.OutPoint{Hash: genesis.TxHash(), Index: 1}
+	lookup := func(o wire.OutPoint) *TokenUtxo {
+		if o == op {
+			return &TokenUtxo{TokenID: id, TokenType: 0x01, Amount: 100}
+		}
+		return nil
+	}
+
+	res := ApplyTx(testSend(t, 0x01, id, []wire.OutPoint{op}, 60, 41), 1, lookup)
+	if res.Valid || len(res.Spent) != 1 {
+		t.Error("expected invalid send spending one token output")
+	}
+
+	// sending with the wrong token type does not count the inputs
+	res = ApplyTx(testSend(t, 0x81, id, []wire.OutPoint{op}, 1), 1, lookup)
+	if res.Valid {
+		t.Error("expected token type mismatch to be invalid")
+	}
+
+	res = ApplyTx(testSend(t, 0x01, id, []wire.OutPoint{op}, 60, 40), 1, lookup)
+	if !res.Valid || res.Outputs[1].Amount != 60 || res.Outputs[2].Amount != 40 {
+		t.Error("expected valid send")
+	}
+}
+
+func TestApplyTxNFT1Child(t *testing.T) {
+	group := testGenesis(t, 0x81, 10, false)
+	groupID := testTokenID(group)
+	op := wire.OutPoint{Hash: group.TxHash(), Index: 1}
+	lookup := func(o wire.OutPoint) *TokenUtxo {
+		if o == op {
+			return &TokenUtxo{TokenID: groupID, TokenType: 0x81, Amount: 1}
+		}
+		return nil
+	}
+
+	slpMsg, err := metadatamaker.NFT1ChildGenesis([]byte("C"), []byte("child"), nil, nil, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := ApplyTx(testTx(slpMsg, []wire.OutPoint{op}, 1), 1, lookup)
+	if !res.Valid || res.Outputs[1] == nil || res.Outputs[1].TokenType != 0x41 {
+		t.Error("expected valid nft1 child genesis")
+	}
+
+	res = ApplyTx(testTx(slpMsg, []wire.OutPoint{{Index: 9}, op}, 1), 1, lookup)
+	if res.Valid {
+		t.Error("expected child genesis without group input 0 to be invalid")
+	}
+}
@@ -0,0 +1,209 @@
+package tokenindex
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+// BatonMove records a mint baton being created, moved or destroyed
+type BatonMove struct {
+	TokenID TokenID
+
+	// From is nil when the baton is created by a genesis
+	From *wire.OutPoint
+
+	// To is nil when the baton is destroyed
+	To *wire.OutPoint
+}
+
+// TokenDelta is the change a block makes to the supply of one token
+type TokenDelta struct {
+	TokenID   TokenID
+	TokenType v1parser.TokenType
+
+	// IsGenesis is true when the block contains the token genesis
+	IsGenesis bool
+
+	// Genesis is the quantity issued by the genesis
+	Genesis uint64
+
+	// Minted is the quantity issued by MINT transactions
+	Minted *big.Int
+
+	// Burned is the quantity spent without being carried forward, Burns
+	// splits it by category
+	Burned *big.Int
+	Burns  map[BurnCategory]*big.Int
+
+	// Outputs is the net change in unspent outputs carrying an amount
+	Outputs int
+
+	// Holders is the net change in outputs carrying an amount per
+	// output script
+	Holders map[string]int
+}
+
+func newTokenDelta(id TokenID, tokenType v1parser.TokenType) *TokenDelta {
+	return &TokenDelta{
+		TokenID:   id,
+		TokenType: tokenType,
+		Minted:    new(big.Int),
+		Burned:    new(big.Int),
+		Burns:     make(map[BurnCategory]*big.Int),
+		Holders:   make(map[string]int),
+	}
+}
+
+// burn records amount as burned in category
+func (d *TokenDelta) burn(category BurnCategory, amount *big.Int) {
+	d.Burned.Add(d.Burned, amount)
+	if _, ok := d.Burns[category]; !ok {
+		d.Burns[category] = new(big.Int)
+	}
+	d.Burns[category].Add(d.Burns[category], amount)
+}
+
+// TokenBurn is an amount of a token burned by a transaction
+type TokenBurn struct {
+	TokenID   TokenID
+	TokenType v1parser.TokenType
+	Category  BurnCategory
+	Amount    *big.Int
+}
+
+// Burns returns the token amounts spent by the transaction without being
+// carried forward, in input order with the excess of a valid SEND last
+func (r *TxResult) Burns() []*TokenBurn {
+	var burns []*TokenBurn
+	sendInputs := new(big.Int)
+	for _, s := range r.Spent {
+		if s.Utxo.IsMintBaton {
+			continue
+		}
+		amount := new(big.Int).SetUint64(s.Utxo.Amount)
+		category, burned := burnCategory(r, s.Utxo)
+		if !burned {
+			sendInputs.Add(sendInputs, amount)
+			continue
+		}
+		burns = append(burns, &TokenBurn{
+			TokenID:   s.Utxo.TokenID,
+			TokenType: s.Utxo.TokenType,
+			Category:  category,
+			Amount:    amount,
+		})
+	}
+
+	// a valid send may carry forward less than its inputs
+	if sendInputs.Sign() == 0 {
+		return burns
+	}
+	for _, u := range r.Outputs {
+		if u != nil {
+			sendInputs.Sub(sendInputs, new(big.Int).SetUint64(u.Amount))
+		}
+	}
+	if sendInputs.Sign() > 0 {
+		burns = append(burns, &TokenBurn{
+			TokenID:   r.TokenID,
+			TokenType: r.SlpMsg.TokenType(),
+			Category:  BurnSendExcess,
+			Amount:    sendInputs,
+		})
+	}
+	return burns
+}
+
+// BatonMoves returns the mint batons created, moved or destroyed by the
+// transaction
+func (r *TxResult) BatonMoves() []*BatonMove {
+	var newBaton *wire.OutPoint
+	for vout, u := range r.Outputs {
+		if u != nil && u.IsMintBaton {
+			newBaton = &wire.OutPoint{Hash: r.TxHash, Index: uint32(vout)}
+		}
+	}
+
+	var moves []*BatonMove
+	_, isGenesis := r.SlpMsg.(*v1parser.SlpGenesis)
+	_, isMint := r.SlpMsg.(*v1parser.SlpMint)
+	if r.Valid && isGenesis && newBaton != nil {
+		moves = append(moves, &BatonMove{TokenID: r.TokenID, To: newBaton})
+	}
+	for _, s := range r.Spent {
+		if !s.Utxo.IsMintBaton {
+			continue
+		}
+		from := s.OutPoint
+		move := &BatonMove{TokenID: s.Utxo.TokenID, From: &from}
+		if r.Valid && isMint && s.Utxo.TokenID == r.TokenID {
+			// only the first baton input is carried forward
+			move.To = newBaton
+			newBaton = nil
+		}
+		moves = append(moves, move)
+	}
+	return moves
+}
+
+// journalTx records the baton moves and supply changes of res in undo
+func journalTx(res *TxResult, undo *BlockUndo, deltas map[TokenID]*TokenDelta) {
+	delta := func(id TokenID, tokenType v1parser.TokenType) *TokenDelta {
+		d, ok := deltas[id]
+		if !ok {
+			d = newTokenDelta(id, tokenType)
+			deltas[id] = d
+		}
+		return d
+	}
+
+	if _, ok := res.SlpMsg.(*v1parser.SlpGenesis); ok && res.Valid {
+		delta(res.TokenID, res.SlpMsg.TokenType()).IsGenesis = true
+	}
+	for _, u := range res.Outputs {
+		if u == nil || u.IsMintBaton {
+			continue
+		}
+		d := delta(u.TokenID, u.TokenType)
+		d.Outputs++
+		d.Holders[string(u.PkScript)]++
+		switch res.SlpMsg.(type) {
+		case *v1parser.SlpGenesis:
+			d.Genesis += u.Amount
+		case *v1parser.SlpMint:
+			d.Minted.Add(d.Minted, new(big.Int).SetUint64(u.Amount))
+		}
+	}
+	for _, s := range res.Spent {
+		d := delta(s.Utxo.TokenID, s.Utxo.TokenType)
+		if !s.Utxo.IsMintBaton {
+			d.Outputs--
+			d.Holders[string(s.Utxo.PkScript)]--
+		}
+	}
+	for _, b := range res.Burns() {
+		delta(b.TokenID, b.TokenType).burn(b.Category, b.Amount)
+	}
+	undo.BatonMoves = append(undo.BatonMoves, res.BatonMoves()...)
+}
+
+// sortedDeltas returns deltas ordered by token id
+func sortedDeltas(deltas map[TokenID]*TokenDelta) []*TokenDelta {
+	res := make([]*TokenDelta, 0, len(deltas))
+	for _, d := range deltas {
+		for script, n := range d.Holders {
+			if n == 0 {
+				delete(d.Holders, script)
+			}
+		}
+		res = append(res, d)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return bytes.Compare(res[i].TokenID[:], res[j].TokenID[:]) < 0
+	})
+	return res
+}
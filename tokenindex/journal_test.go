@@ -0,0 +1,130 @@
+package tokenindex
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gcash/bchd/wire"
+)
+
+func TestJournalDeltas(t *testing.T) {
+	idx := New()
+	genesis := testGenesis(t, 0x01, 1000, true)
+	id := testTokenID(genesis)
+	gHash := genesis.TxHash()
+	b0 := testBlock(nil, genesis)
+	if _, err := idx.ConnectBlock(b0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	mint := testMint(t, id, wire.OutPoint{Hash: gHash, Index: 2}, 50)
+	burn := testSend(t, 0x01, id, []wire.OutPoint{{Hash: gHash, Index: 1}}, 900)
+	if _, err := idx.ConnectBlock(testBlock(b0, mint, burn), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	undos, err := idx.Rewind(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(undos) != 2 {
+		t.Fatalf("expected 2 undos, got %d", len(undos))
+	}
+
+	d := undos[1].Deltas
+	if len(d) != 1 || d[0].Genesis != 1000 || d[0].Outputs != 1 || d[0].Burned.Sign() != 0 {
+		t.Errorf("unexpected genesis delta %+v", d[0])
+	}
+	moves := undos[1].BatonMoves
+	if len(moves) != 1 || moves[0].From != nil || *moves[0].To != (wire.OutPoint{Hash: gHash, Index: 2}) {
+		t.Errorf("unexpected genesis baton moves %+v", moves)
+	}
+
+	d = undos[0].Deltas
+	if d[0].Minted.Uint64() != 50 || d[0].Burned.Uint64() != 100 || d[0].Outputs != 1 {
+		t.Errorf("unexpected delta minted %s burned %s outputs %d", d[0].Minted, d[0].Burned, d[0].Outputs)
+	}
+	moves = undos[0].BatonMoves
+	if len(moves) != 1 || *moves[0].To != (wire.OutPoint{Hash: mint.TxHash(), Index: 2}) {
+		t.Errorf("unexpected mint baton moves %+v", moves)
+	}
+
+	if _, err := idx.Rewind(-1); err != ErrNoBlocks {
+		t.Errorf("expected ErrNoBlocks, got %v", err)
+	}
+}
+
+func TestRewindCompetingChains(t *testing.T) {
+	genesis := testGenesis(t, 0x01, 1000, true)
+	id := testTokenID(genesis)
+	gHash := genesis.TxHash()
+	b0 := testBlock(nil, genesis)
+
+	// chain a sends the genesis output and mints twice
+	sendA := testSend(t, 0x01, id, []wire.OutPoint{{Hash: gHash, Index: 1}}, 600, 400)
+	mintA := testMint(t, id, wire.OutPoint{Hash: gHash, Index: 2}, 10)
+	a1 := testBlock(b0, sendA, mintA)
+	a2 := testBlock(a1, testMint(t, id, wire.OutPoint{Hash: mintA.TxHash(), Index: 2}, 20))
+
+	// chain b burns part of the genesis output and destroys the baton
+	burnB := testSend(t, 0x01, id, []wire.OutPoint{{Hash: gHash, Index: 1}, {Hash: gHash, Index: 2}}, 700)
+	b1 := testBlock(b0, burnB)
+	b1.Header.Nonce = 100
+	b2 := testBlock(b1)
+	b3 := testBlock(b2)
+
+	idx := New()
+	for i, block := range []*wire.MsgBlock{b0, a1, a2} {
+		if _, err := idx.ConnectBlock(block, int32(10+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := idx.ConnectBlock(b2, 13); err != ErrDoesNotConnect {
+		t.Fatalf("expected ErrDoesNotConnect, got %v", err)
+	}
+
+	// find the fork point the way a caller following b would
+	fork := int32(12)
+	for ; fork >= 10; fork-- {
+		hash, ok := idx.BlockHash(fork)
+		if ok && hash == b0.BlockHash() {
+			break
+		}
+	}
+	if fork != 10 {
+		t.Fatalf("expected fork at 10, got %d", fork)
+	}
+	if _, err := idx.Rewind(8); err != ErrRewindTooDeep {
+		t.Errorf("expected ErrRewindTooDeep, got %v", err)
+	}
+	undos, err := idx.Rewind(fork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(undos) != 2 || undos[0].Hash != a2.BlockHash() {
+		t.Fatal("expected a2 then a1 to be disconnected")
+	}
+	for i, block := range []*wire.MsgBlock{b1, b2, b3} {
+		if _, err := idx.ConnectBlock(block, int32(11+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fresh := New()
+	for i, block := range []*wire.MsgBlock{b0, b1, b2, b3} {
+		if _, err := fresh.ConnectBlock(block, int32(10+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, want := idx.TokenUtxos(id), fresh.TokenUtxos(id)
+	if len(got) != len(want) || len(got) != 1 {
+		t.Fatalf("expected 1 token utxo, got %d want %d", len(got), len(want))
+	}
+	if got[0].OutPoint != want[0].OutPoint || !reflect.DeepEqual(got[0].Utxo, want[0].Utxo) {
+		t.Errorf("rewound state %+v differs from fresh state %+v", got[0], want[0])
+	}
+	if _, known := idx.TxValidity(sendA.TxHash()); known {
+		t.Error("validity of orphaned tx was kept")
+	}
+}
@@ -0,0 +1,372 @@
+// Package ldbstore implements tokenindex.Store on an embedded goleveldb
+// database.
+package ldbstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// SchemaVersion is the version of the key layout written by this package
+const SchemaVersion uint32 = 1
+
+// ErrNewerSchema is returned when opening a database written by a newer
+// version of this package
+var ErrNewerSchema = errors.New("database schema is newer than supported")
+
+// key prefixes of the stored records
+var (
+	keyVersion  = []byte("v")
+	keyTip      = []byte("t")
+	prefixUtxo  = []byte("u")
+	prefixMeta  = []byte("m")
+	prefixStats = []byte("s")
+	prefixTx    = []byte("x")
+	prefixUndo  = []byte("j")
+)
+
+// Migration upgrades a database from Version-1 to Version
+type Migration struct {
+	Version uint32
+	Migrate func(db *leveldb.DB) error
+}
+
+// migrations are the upgrades of earlier schema versions
+var migrations []Migration
+
+// Options configures Open
+type Options struct {
+	// Migrations are run in addition to the built in ones, this allows
+	// applications to upgrade data written by their own earlier layouts
+	Migrations []Migration
+}
+
+// Store is a tokenindex.Store backed by goleveldb
+type Store struct {
+	db *leveldb.DB
+}
+
+var _ tokenindex.Store = (*Store)(nil)
+
+// Open opens or creates the database at path, running any migrations
+// needed to bring it to SchemaVersion
+func Open(path string, opts *Options) (*Store, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: db}
+	if err := s.migrate(opts); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate stamps new databases with SchemaVersion and upgrades older ones
+func (s *Store) migrate(opts *Options) error {
+	version, err := s.version()
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: version %d", ErrNewerSchema, version)
+	}
+	if version == 0 {
+		// an empty database needs no migration
+		iter := s.db.NewIterator(nil, nil)
+		empty := !iter.Next()
+		iter.Release()
+		if empty {
+			return s.setVersion(SchemaVersion)
+		}
+	}
+
+	all := append([]Migration{}, migrations...)
+	if opts != nil {
+		all = append(all, opts.Migrations...)
+	}
+	for v := version + 1; v <= SchemaVersion; v++ {
+		for _, m := range all {
+			if m.Version != v {
+				continue
+			}
+			if err := m.Migrate(s.db); err != nil {
+				return fmt.Errorf("migration to version %d: %v", v, err)
+			}
+		}
+		if err := s.setVersion(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// version returns the stored schema version, 0 when none is stored
+func (s *Store) version() (uint32, error) {
+	v, err := s.db.Get(keyVersion, nil)
+	if err == leveldb.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(v) != 4 {
+		return 0, errors.New("invalid schema version record")
+	}
+	return binary.BigEndian.Uint32(v), nil
+}
+
+func (s *Store) setVersion(version uint32) error {
+	var v [4]byte
+	binary.BigEndian.PutUint32(v[:], version)
+	return s.db.Put(keyVersion, v[:], &opt.WriteOptions{Sync: true})
+}
+
+func key(prefix []byte, id []byte) []byte {
+	return append(append([]byte{}, prefix...), id...)
+}
+
+func outPointKey(op wire.OutPoint) []byte {
+	k := key(prefixUtxo, op.Hash[:])
+	var index [4]byte
+	binary.BigEndian.PutUint32(index[:], op.Index)
+	return append(k, index[:]...)
+}
+
+// undoKey orders undo records by height, heights are offset so negative
+// values cannot wrap
+func undoKey(height int32) []byte {
+	var h [4]byte
+	binary.BigEndian.PutUint32(h[:], uint32(int64(height)+1<<31))
+	return key(prefixUndo, h[:])
+}
+
+// get returns the value at k, or nil when it does not exist
+func (s *Store) get(k []byte) ([]byte, error) {
+	v, err := s.db.Get(k, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	return v, err
+}
+
+// Tip implements tokenindex.Store
+func (s *Store) Tip() (chainhash.Hash, int32, error) {
+	v, err := s.get(keyTip)
+	if err != nil || v == nil {
+		return chainhash.Hash{}, -1, err
+	}
+	if len(v) != chainhash.HashSize+4 {
+		return chainhash.Hash{}, -1, errors.New("invalid tip record")
+	}
+	var hash chainhash.Hash
+	copy(hash[:], v)
+	return hash, int32(binary.BigEndian.Uint32(v[chainhash.HashSize:])), nil
+}
+
+// Utxo implements tokenindex.Store
+func (s *Store) Utxo(op wire.OutPoint) (*tokenindex.TokenUtxo, error) {
+	v, err := s.get(outPointKey(op))
+	if err != nil || v == nil {
+		return nil, err
+	}
+	u := new(tokenindex.TokenUtxo)
+	return u, u.Deserialize(bytes.NewReader(v))
+}
+
+// Metadata implements tokenindex.Store
+func (s *Store) Metadata(tokenID tokenindex.TokenID) (*tokenindex.TokenMetadata, error) {
+	v, err := s.get(key(prefixMeta, tokenID[:]))
+	if err != nil || v == nil {
+		return nil, err
+	}
+	m := new(tokenindex.TokenMetadata)
+	return m, m.Deserialize(bytes.NewReader(v))
+}
+
+// Stats implements tokenindex.Store
+func (s *Store) Stats(tokenID tokenindex.TokenID) (*tokenindex.TokenStats, error) {
+	v, err := s.get(key(prefixStats, tokenID[:]))
+	if err != nil || v == nil {
+		return nil, err
+	}
+	stats := new(tokenindex.TokenStats)
+	return stats, stats.Deserialize(bytes.NewReader(v))
+}
+
+// TxValidity implements tokenindex.Store
+func (s *Store) TxValidity(hash chainhash.Hash) (valid, known bool, err error) {
+	v, err := s.get(key(prefixTx, hash[:]))
+	if err != nil || v == nil {
+		return false, false, err
+	}
+	return len(v) == 1 && v[0] == 1, true, nil
+}
+
+// Undo implements tokenindex.Store
+func (s *Store) Undo(height int32) (*tokenindex.BlockUndo, error) {
+	v, err := s.get(undoKey(height))
+	if err != nil || v == nil {
+		return nil, err
+	}
+	u := new(tokenindex.BlockUndo)
+	return u, u.Deserialize(bytes.NewReader(v))
+}
+
+// forEach calls fn with the key suffix and value of every record under
+// prefix in key order
+func (s *Store) forEach(prefix []byte, fn func(k, v []byte) error) error {
+	iter := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		if err := fn(iter.Key()[len(prefix):], iter.Value()); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// ForEachUtxo implements tokenindex.Store
+func (s *Store) ForEachUtxo(fn func(op wire.OutPoint, u *tokenindex.TokenUtxo) error) error {
+	return s.forEach(prefixUtxo, func(k, v []byte) error {
+		if len(k) != chainhash.HashSize+4 {
+			return errors.New("invalid utxo key")
+		}
+		var op wire.OutPoint
+		copy(op.Hash[:], k)
+		op.Index = binary.BigEndian.Uint32(k[chainhash.HashSize:])
+		u := new(tokenindex.TokenUtxo)
+		if err := u.Deserialize(bytes.NewReader(v)); err != nil {
+			return err
+		}
+		return fn(op, u)
+	})
+}
+
+// ForEachMetadata implements tokenindex.Store
+func (s *Store) ForEachMetadata(fn func(meta *tokenindex.TokenMetadata) error) error {
+	return s.forEach(prefixMeta, func(k, v []byte) error {
+		m := new(tokenindex.TokenMetadata)
+		if err := m.Deserialize(bytes.NewReader(v)); err != nil {
+			return err
+		}
+		return fn(m)
+	})
+}
+
+// ForEachStats implements tokenindex.Store
+func (s *Store) ForEachStats(fn func(stats *tokenindex.TokenStats) error) error {
+	return s.forEach(prefixStats, func(k, v []byte) error {
+		stats := new(tokenindex.TokenStats)
+		if err := stats.Deserialize(bytes.NewReader(v)); err != nil {
+			return err
+		}
+		return fn(stats)
+	})
+}
+
+// ForEachTx implements tokenindex.Store
+func (s *Store) ForEachTx(fn func(hash chainhash.Hash, valid bool) error) error {
+	return s.forEach(prefixTx, func(k, v []byte) error {
+		var hash chainhash.Hash
+		if err := hash.SetBytes(k); err != nil {
+			return err
+		}
+		return fn(hash, len(v) == 1 && v[0] == 1)
+	})
+}
+
+// ForEachUndo implements tokenindex.Store
+func (s *Store) ForEachUndo(fn func(undo *tokenindex.BlockUndo) error) error {
+	return s.forEach(prefixUndo, func(k, v []byte) error {
+		u := new(tokenindex.BlockUndo)
+		if err := u.Deserialize(bytes.NewReader(v)); err != nil {
+			return err
+		}
+		return fn(u)
+	})
+}
+
+// Commit implements tokenindex.Store, the batch is written with a single
+// synced leveldb batch so it is either fully applied or not at all
+func (s *Store) Commit(b *tokenindex.Batch) error {
+	batch := new(leveldb.Batch)
+	var buf bytes.Buffer
+	put := func(k []byte, v interface{ Serialize(w io.Writer) error }) error {
+		buf.Reset()
+		if err := v.Serialize(&buf); err != nil {
+			return err
+		}
+		batch.Put(k, append([]byte{}, buf.Bytes()...))
+		return nil
+	}
+
+	for _, op := range b.DeleteUtxos {
+		batch.Delete(outPointKey(op))
+	}
+	for op, u := range b.PutUtxos {
+		if err := put(outPointKey(op), u); err != nil {
+			return err
+		}
+	}
+	for _, id := range b.DeleteMetadata {
+		batch.Delete(key(prefixMeta, id[:]))
+	}
+	for _, m := range b.PutMetadata {
+		if err := put(key(prefixMeta, m.TokenID[:]), m); err != nil {
+			return err
+		}
+	}
+	for _, id := range b.DeleteStats {
+		batch.Delete(key(prefixStats, id[:]))
+	}
+	for _, stats := range b.PutStats {
+		if err := put(key(prefixStats, stats.TokenID[:]), stats); err != nil {
+			return err
+		}
+	}
+	for _, h := range b.DeleteTxs {
+		batch.Delete(key(prefixTx, h[:]))
+	}
+	for h, valid := range b.PutTxs {
+		v := []byte{0}
+		if valid {
+			v[0] = 1
+		}
+		batch.Put(key(prefixTx, h[:]), v)
+	}
+	for _, height := range b.DeleteUndo {
+		batch.Delete(undoKey(height))
+	}
+	if b.PutUndo != nil {
+		if err := put(undoKey(b.PutUndo.Height), b.PutUndo); err != nil {
+			return err
+		}
+	}
+
+	if b.Height < 0 {
+		batch.Delete(keyTip)
+	} else {
+		tip := make([]byte, chainhash.HashSize+4)
+		copy(tip, b.Hash[:])
+		binary.BigEndian.PutUint32(tip[chainhash.HashSize:], uint32(b.Height))
+		batch.Put(keyTip, tip)
+	}
+	return s.db.Write(batch, &opt.WriteOptions{Sync: true})
+}
+
+// Close implements tokenindex.Store
+func (s *Store) Close() error {
+	return s.db.Close()
+}
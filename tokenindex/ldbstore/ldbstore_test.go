@@ -0,0 +1,268 @@
+package ldbstore
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func testTx(slpMsg []byte, spends []wire.OutPoint, n int) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	for i := range spends {
+		tx.AddTxIn(wire.NewTxIn(&spends[i], nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, slpMsg))
+	for i := 0; i < n; i++ {
+		tx.AddTxOut(wire.NewTxOut(546, []byte{0x51, byte(i)}))
+	}
+	return tx
+}
+
+// testChain returns blocks issuing a token and then sending part of the
+// remaining balance on in every following block
+func testChain(t *testing.T, n int) (tokenindex.TokenID, []*wire.MsgBlock) {
+	slpMsg, err := metadatamaker.TokenType1Genesis([]byte("T"), []byte("test"), nil, nil, 0,
+		metadatamaker.NewMintBatonVout(2), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := testTx(slpMsg, []wire.OutPoint{{Index: 1}}, 2)
+	hash := genesis.TxHash()
+	var id tokenindex.TokenID
+	for i := range hash {
+		id[i] = hash[len(hash)-1-i]
+	}
+
+	var prevHash chainhash.Hash
+	prevTx := genesis
+	blocks := make([]*wire.MsgBlock, 0, n)
+	for i := 0; i < n; i++ {
+		block := wire.NewMsgBlock(wire.NewBlockHeader(1, &prevHash, &chainhash.Hash{}, 0, uint32(i)))
+		if i == 0 {
+			block.AddTransaction(genesis)
+		} else {
+			balance := uint64(1000 - 10*(i-1))
+			slpMsg, err := metadatamaker.TokenType1Send(id[:], []uint64{10, balance - 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx := testTx(slpMsg, []wire.OutPoint{{Hash: prevTx.TxHash(), Index: uint32(len(prevTx.TxOut) - 1)}}, 2)
+			if i == 1 {
+				tx.TxIn[0].PreviousOutPoint.Index = 1
+			}
+			block.AddTransaction(tx)
+			prevTx = tx
+		}
+		prevHash = block.BlockHash()
+		blocks = append(blocks, block)
+	}
+	return id, blocks
+}
+
+func connect(t *testing.T, idx *tokenindex.Index, blocks []*wire.MsgBlock) {
+	for i, block := range blocks {
+		if _, err := idx.ConnectBlock(block, int32(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ldbstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestStoreReopen(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	store, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := tokenindex.Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, blocks := testChain(t, 5)
+	connect(t, idx, blocks)
+	if _, err := idx.Rewind(3); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	reopened, err := tokenindex.Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reopened.TokenUtxos(id), idx.TokenUtxos(id)) {
+		t.Error("reopened utxos differ")
+	}
+	if !reflect.DeepEqual(reopened.StatsSnapshot(), idx.StatsSnapshot()) {
+		t.Error("reopened stats differ")
+	}
+	if !reflect.DeepEqual(reopened.Metadata(id), idx.Metadata(id)) {
+		t.Error("reopened metadata differs")
+	}
+	if valid, known, _ := store.TxValidity(blocks[3].Transactions[0].TxHash()); !valid || !known {
+		t.Error("expected stored validity")
+	}
+	if _, known, _ := store.TxValidity(blocks[4].Transactions[0].TxHash()); known {
+		t.Error("expected validity of rewound block removed")
+	}
+
+	// the reopened index continues where the store left off
+	if _, err := reopened.ConnectBlock(blocks[4], 4); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCrashRecovery copies the database while it is open, as a crash
+// would leave it, and cuts the write ahead log at every point of the last
+// writes. The recovered store must always hold a consistent state at some
+// committed tip.
+func TestCrashRecovery(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	store, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	idx, err := tokenindex.Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, blocks := testChain(t, 6)
+	connect(t, idx, blocks)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logName string
+	var logSize int64
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".log") && f.Size() > logSize {
+			logName, logSize = f.Name(), f.Size()
+		}
+	}
+	if logName == "" {
+		t.Fatal("no write ahead log found")
+	}
+
+	// fresh indexes at every height to compare against
+	expected := make([]*tokenindex.Index, len(blocks))
+	for i := range blocks {
+		expected[i] = tokenindex.New()
+		connect(t, expected[i], blocks[:i+1])
+	}
+
+	seen := make(map[int32]bool)
+	for cut := logSize; cut > 0; cut -= logSize / 50 {
+		crashed := tempDir(t)
+		for _, f := range files {
+			data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Name() == logName {
+				data = data[:cut]
+			}
+			if err := ioutil.WriteFile(filepath.Join(crashed, f.Name()), data, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		recovered, err := Open(crashed, nil)
+		if err != nil {
+			os.RemoveAll(crashed)
+			t.Fatalf("cut at %d: %v", cut, err)
+		}
+		ridx, err := tokenindex.Open(recovered)
+		if err != nil {
+			recovered.Close()
+			os.RemoveAll(crashed)
+			t.Fatalf("cut at %d: inconsistent store: %v", cut, err)
+		}
+		_, height := ridx.Tip()
+		seen[height] = true
+		if height >= 0 {
+			want := expected[height]
+			if !reflect.DeepEqual(ridx.TokenUtxos(id), want.TokenUtxos(id)) ||
+				!reflect.DeepEqual(ridx.StatsSnapshot(), want.StatsSnapshot()) {
+				t.Errorf("cut at %d: state at height %d differs from a fresh index", cut, height)
+			}
+		}
+		recovered.Close()
+		os.RemoveAll(crashed)
+	}
+	if !seen[int32(len(blocks)-1)] || len(seen) < 2 {
+		t.Errorf("expected recoveries at several heights, got %v", seen)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// an unversioned database with data from an earlier layout
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("legacy"), []byte{1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	var runs int
+	opts := &Options{Migrations: []Migration{{
+		Version: 1,
+		Migrate: func(db *leveldb.DB) error {
+			runs++
+			return db.Delete([]byte("legacy"), nil)
+		},
+	}}}
+	for i := 0; i < 2; i++ {
+		store, err := Open(dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.Close()
+	}
+	if runs != 1 {
+		t.Errorf("expected migration to run once, ran %d times", runs)
+	}
+
+	store, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.setVersion(SchemaVersion + 1); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if _, err := Open(dir, nil); !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("expected ErrNewerSchema, got %v", err)
+	}
+}
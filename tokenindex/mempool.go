@@ -0,0 +1,343 @@
+package tokenindex
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+)
+
+// ErrConflict is returned when a transaction spends an output already spent
+// by another unconfirmed transaction
+var ErrConflict = errors.New("input already spent by an unconfirmed transaction")
+
+// MempoolEntry is an unconfirmed transaction and its SLP result
+type MempoolEntry struct {
+	Tx     *wire.MsgTx
+	Result *TxResult
+
+	// DoubleSpent is set when a conflicting spend of one of the inputs was
+	// seen
+	DoubleSpent bool
+
+	// history holds the unconfirmed history entries of every script the
+	// transaction spends from or sends to
+	history map[string][]*HistoryEntry
+}
+
+// MempoolUtxo is a token output as seen with unconfirmed transactions
+// applied
+type MempoolUtxo struct {
+	OutPoint wire.OutPoint
+	Utxo     *TokenUtxo
+
+	// Unconfirmed is set for outputs of unconfirmed transactions
+	Unconfirmed bool
+
+	// ZeroConfRisk is set when the output or one of its unconfirmed
+	// ancestors has a conflicting spend, so it may never confirm
+	ZeroConfRisk bool
+}
+
+// Mempool tracks unconfirmed token outputs on top of a confirmed UTXO set.
+// The first transaction seen spending an output is kept, later conflicting
+// spends are rejected and flag the kept transaction and its descendants as
+// at risk. Transactions of disconnected blocks replace conflicting spends.
+type Mempool struct {
+	mtx       sync.RWMutex
+	confirmed UtxoLookup
+	entries   map[chainhash.Hash]*MempoolEntry
+	spends    map[wire.OutPoint]chainhash.Hash
+
+	// scripts holds the entries touching every output script
+	scripts map[string]map[chainhash.Hash]*MempoolEntry
+}
+
+// NewMempool creates an empty Mempool on top of the confirmed UTXO set
+// resolved by confirmed, usually Index.Lookup
+func NewMempool(confirmed UtxoLookup) *Mempool {
+	return &Mempool{
+		confirmed: confirmed,
+		entries:   make(map[chainhash.Hash]*MempoolEntry),
+		spends:    make(map[wire.OutPoint]chainhash.Hash),
+		scripts:   make(map[string]map[chainhash.Hash]*MempoolEntry),
+	}
+}
+
+// lookup resolves op from unconfirmed outputs first, the caller must hold
+// the lock
+func (m *Mempool) lookup(op wire.OutPoint) *TokenUtxo {
+	if e, ok := m.entries[op.Hash]; ok {
+		if int(op.Index) < len(e.Result.Outputs) {
+			return e.Result.Outputs[op.Index]
+		}
+		return nil
+	}
+	return m.confirmed(op)
+}
+
+// AddTx applies tx on top of the confirmed and unconfirmed outputs. An
+// error wrapping ErrConflict is returned when an input is already spent by
+// another unconfirmed transaction.
+func (m *Mempool) AddTx(tx *wire.MsgTx) (*TxResult, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.addTx(tx)
+}
+
+func (m *Mempool) addTx(tx *wire.MsgTx) (*TxResult, error) {
+	hash := tx.TxHash()
+	if e, ok := m.entries[hash]; ok {
+		return e.Result, nil
+	}
+	for _, in := range tx.TxIn {
+		if spender, ok := m.spends[in.PreviousOutPoint]; ok {
+			m.entries[spender].DoubleSpent = true
+			return nil, fmt.Errorf("%w: %v spent by %v", ErrConflict, in.PreviousOutPoint, spender)
+		}
+	}
+
+	res := ApplyTx(tx, -1, m.lookup)
+	e := &MempoolEntry{Tx: tx, Result: res, history: historyEntries(res, -1, 0)}
+	m.entries[hash] = e
+	for _, in := range tx.TxIn {
+		m.spends[in.PreviousOutPoint] = hash
+	}
+	for script := range e.history {
+		byScript, ok := m.scripts[script]
+		if !ok {
+			byScript = make(map[chainhash.Hash]*MempoolEntry)
+			m.scripts[script] = byScript
+		}
+		byScript[hash] = e
+	}
+	return res, nil
+}
+
+// RemoveTx removes an unconfirmed transaction and its descendants and
+// returns the removed hashes
+func (m *Mempool) RemoveTx(hash chainhash.Hash) []chainhash.Hash {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.evict(hash)
+}
+
+// evict removes hash and its descendants, the caller must hold the lock
+func (m *Mempool) evict(hash chainhash.Hash) []chainhash.Hash {
+	e, ok := m.entries[hash]
+	if !ok {
+		return nil
+	}
+	removed := []chainhash.Hash{hash}
+	for i := range e.Tx.TxOut {
+		op := wire.OutPoint{Hash: hash, Index: uint32(i)}
+		if child, ok := m.spends[op]; ok {
+			removed = append(removed, m.evict(child)...)
+		}
+	}
+	m.remove(e)
+	return removed
+}
+
+// remove deletes a single entry, the caller must hold the lock
+func (m *Mempool) remove(e *MempoolEntry) {
+	for _, in := range e.Tx.TxIn {
+		if m.spends[in.PreviousOutPoint] == e.Result.TxHash {
+			delete(m.spends, in.PreviousOutPoint)
+		}
+	}
+	for script := range e.history {
+		delete(m.scripts[script], e.Result.TxHash)
+		if len(m.scripts[script]) == 0 {
+			delete(m.scripts, script)
+		}
+	}
+	delete(m.entries, e.Result.TxHash)
+}
+
+// BlockConnected removes the transactions of a block that was connected to
+// the confirmed UTXO set, evicting unconfirmed transactions that conflict
+// with it along with their descendants. The evicted hashes are returned.
+func (m *Mempool) BlockConnected(block *wire.MsgBlock) []chainhash.Hash {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var evicted []chainhash.Hash
+	for _, tx := range block.Transactions {
+		hash := tx.TxHash()
+		if e, ok := m.entries[hash]; ok {
+			m.remove(e)
+		}
+		for _, in := range tx.TxIn {
+			if spender, ok := m.spends[in.PreviousOutPoint]; ok && spender != hash {
+				evicted = append(evicted, m.evict(spender)...)
+			}
+		}
+	}
+	return evicted
+}
+
+// BlockDisconnected returns the transactions of a block that was
+// disconnected from the confirmed UTXO set to the mempool. They take
+// priority over unconfirmed transactions spending the same outputs, which
+// are evicted along with their descendants. The evicted hashes are
+// returned.
+func (m *Mempool) BlockDisconnected(block *wire.MsgBlock) []chainhash.Hash {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var evicted []chainhash.Hash
+	for _, tx := range sortTxs(block.Transactions) {
+		if isCoinbase(tx) {
+			continue
+		}
+		hash := tx.TxHash()
+		for _, in := range tx.TxIn {
+			if spender, ok := m.spends[in.PreviousOutPoint]; ok && spender != hash {
+				evicted = append(evicted, m.evict(spender)...)
+			}
+		}
+		m.addTx(tx)
+	}
+	return evicted
+}
+
+func isCoinbase(tx *wire.MsgTx) bool {
+	if len(tx.TxIn) != 1 {
+		return false
+	}
+	prev := tx.TxIn[0].PreviousOutPoint
+	return prev.Index == wire.MaxPrevOutIndex && prev.Hash == chainhash.Hash{}
+}
+
+// Entry returns the unconfirmed transaction with hash, or nil
+func (m *Mempool) Entry(hash chainhash.Hash) *MempoolEntry {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.entries[hash]
+}
+
+// Spender returns the unconfirmed transaction spending op
+func (m *Mempool) Spender(op wire.OutPoint) (chainhash.Hash, bool) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	hash, ok := m.spends[op]
+	return hash, ok
+}
+
+// atRisk reports whether hash or an unconfirmed ancestor was double spent,
+// the caller must hold the lock
+func (m *Mempool) atRisk(hash chainhash.Hash, seen map[chainhash.Hash]bool) bool {
+	e, ok := m.entries[hash]
+	if !ok || seen[hash] {
+		return false
+	}
+	seen[hash] = true
+	if e.DoubleSpent {
+		return true
+	}
+	for _, in := range e.Tx.TxIn {
+		if m.atRisk(in.PreviousOutPoint.Hash, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// Utxo returns the token output at op with unconfirmed transactions
+// applied, nil when op carries no tokens or is spent by an unconfirmed
+// transaction
+func (m *Mempool) Utxo(op wire.OutPoint) *MempoolUtxo {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	if _, spent := m.spends[op]; spent {
+		return nil
+	}
+	u := m.lookup(op)
+	if u == nil {
+		return nil
+	}
+	_, unconfirmed := m.entries[op.Hash]
+	return &MempoolUtxo{
+		OutPoint:     op,
+		Utxo:         u,
+		Unconfirmed:  unconfirmed,
+		ZeroConfRisk: unconfirmed && m.atRisk(op.Hash, make(map[chainhash.Hash]bool)),
+	}
+}
+
+// Lookup implements UtxoLookup with unconfirmed transactions applied
+func (m *Mempool) Lookup(op wire.OutPoint) *TokenUtxo {
+	if u := m.Utxo(op); u != nil {
+		return u.Utxo
+	}
+	return nil
+}
+
+// Utxos returns the unspent token outputs of unconfirmed transactions
+// ordered by outpoint
+func (m *Mempool) Utxos() []*MempoolUtxo {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.utxos(m.entries, nil)
+}
+
+// ScriptUtxos returns the unspent token outputs of unconfirmed
+// transactions paying to pkScript ordered by outpoint
+func (m *Mempool) ScriptUtxos(pkScript []byte) []*MempoolUtxo {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.utxos(m.scripts[string(pkScript)], pkScript)
+}
+
+// utxos returns the unspent token outputs of entries ordered by outpoint,
+// only those paying to pkScript when it is not nil
+func (m *Mempool) utxos(entries map[chainhash.Hash]*MempoolEntry, pkScript []byte) []*MempoolUtxo {
+	var utxos []*OutPointUtxo
+	for hash, e := range entries {
+		for i, u := range e.Result.Outputs {
+			if u == nil || (pkScript != nil && !bytes.Equal(u.PkScript, pkScript)) {
+				continue
+			}
+			op := wire.OutPoint{Hash: hash, Index: uint32(i)}
+			if _, spent := m.spends[op]; !spent {
+				utxos = append(utxos, &OutPointUtxo{OutPoint: op, Utxo: u})
+			}
+		}
+	}
+	sortOutPoints(utxos)
+
+	res := make([]*MempoolUtxo, 0, len(utxos))
+	for _, u := range utxos {
+		res = append(res, &MempoolUtxo{
+			OutPoint:     u.OutPoint,
+			Utxo:         u.Utxo,
+			Unconfirmed:  true,
+			ZeroConfRisk: m.atRisk(u.OutPoint.Hash, make(map[chainhash.Hash]bool)),
+		})
+	}
+	return res
+}
+
+// SpentConfirmed returns the confirmed token outputs spent by unconfirmed
+// transactions, which wallets show as pending
+func (m *Mempool) SpentConfirmed() []*OutPointUtxo {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	var spent []*OutPointUtxo
+	for op := range m.spends {
+		if _, ok := m.entries[op.Hash]; ok {
+			continue
+		}
+		if u := m.confirmed(op); u != nil {
+			spent = append(spent, &OutPointUtxo{OutPoint: op, Utxo: u})
+		}
+	}
+	sortOutPoints(spent)
+	return spent
+}
@@ -0,0 +1,190 @@
+package tokenindex
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gcash/bchd/wire"
+)
+
+func TestMempoolConflicts(t *testing.T) {
+	idx := New()
+	genesis := testGenesis(t, 0x01, 1000, true)
+	id := testTokenID(genesis)
+	gOut := wire.OutPoint{Hash: genesis.TxHash(), Index: 1}
+	b0 := testBlock(nil, genesis)
+	if _, err := idx.ConnectBlock(b0, 0); err != nil {
+		t.Fatal(err)
+	}
+	mp := NewMempool(idx.Lookup)
+
+	send := testSend(t, 0x01, id, []wire.OutPoint{gOut}, 600, 400)
+	if res, err := mp.AddTx(send); err != nil || !res.Valid {
+		t.Fatalf("expected valid send, got %v", err)
+	}
+	child := testSend(t, 0x01, id, []wire.OutPoint{{Hash: send.TxHash(), Index: 2}}, 400)
+	if res, err := mp.AddTx(child); err != nil || !res.Valid {
+		t.Fatalf("expected valid child spending unconfirmed output, got %v", err)
+	}
+
+	if mp.Utxo(gOut) != nil {
+		t.Error("expected confirmed output spent in mempool")
+	}
+	if spent := mp.SpentConfirmed(); len(spent) != 1 || spent[0].OutPoint != gOut {
+		t.Errorf("unexpected spent confirmed outputs %v", spent)
+	}
+	u := mp.Utxo(wire.OutPoint{Hash: child.TxHash(), Index: 1})
+	if u == nil || !u.Unconfirmed || u.ZeroConfRisk || u.Utxo.Amount != 400 {
+		t.Fatalf("unexpected child output %+v", u)
+	}
+	if n := len(mp.Utxos()); n != 2 {
+		t.Errorf("expected 2 unconfirmed outputs, got %d", n)
+	}
+
+	// a double spend of the genesis output puts the send and its
+	// descendants at risk
+	doubleSpend := testSend(t, 0x01, id, []wire.OutPoint{gOut}, 1000)
+	if _, err := mp.AddTx(doubleSpend); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if u := mp.Utxo(wire.OutPoint{Hash: child.TxHash(), Index: 1}); !u.ZeroConfRisk {
+		t.Error("expected descendant of double spent tx at risk")
+	}
+
+	// the double spend confirms, evicting the send and its child
+	b1 := testBlock(b0, doubleSpend)
+	if _, err := idx.ConnectBlock(b1, 1); err != nil {
+		t.Fatal(err)
+	}
+	evicted := mp.BlockConnected(b1)
+	if len(evicted) != 2 || mp.Entry(send.TxHash()) != nil || mp.Entry(child.TxHash()) != nil {
+		t.Errorf("expected send and child evicted, got %v", evicted)
+	}
+	if u := mp.Utxo(wire.OutPoint{Hash: doubleSpend.TxHash(), Index: 1}); u == nil || u.Unconfirmed {
+		t.Error("expected confirmed double spend output")
+	}
+}
+
+func TestMempoolConfirm(t *testing.T) {
+	idx := New()
+	genesis := testGenesis(t, 0x01, 1000, true)
+	id := testTokenID(genesis)
+	b0 := testBlock(nil, genesis)
+	if _, err := idx.ConnectBlock(b0, 0); err != nil {
+		t.Fatal(err)
+	}
+	mp := NewMempool(idx.Lookup)
+
+	send := testSend(t, 0x01, id, []wire.OutPoint{{Hash: genesis.TxHash(), Index: 1}}, 600, 400)
+	child := testSend(t, 0x01, id, []wire.OutPoint{{Hash: send.TxHash(), Index: 1}}, 600)
+	for _, tx := range []*wire.MsgTx{send, child} {
+		if _, err := mp.AddTx(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b1 := testBlock(b0, send)
+	if _, err := idx.ConnectBlock(b1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if evicted := mp.BlockConnected(b1); len(evicted) != 0 {
+		t.Errorf("expected no evictions, got %v", evicted)
+	}
+	if mp.Entry(send.TxHash()) != nil || mp.Entry(child.TxHash()) == nil {
+		t.Fatal("expected only the mined tx removed")
+	}
+	if u := mp.Utxo(wire.OutPoint{Hash: send.TxHash(), Index: 2}); u == nil || u.Unconfirmed {
+		t.Error("expected mined output to be confirmed")
+	}
+
+	// disconnecting the block returns the send to the mempool
+	if _, err := idx.DisconnectBlock(); err != nil {
+		t.Fatal(err)
+	}
+	mp.BlockDisconnected(b1)
+	if mp.Entry(send.TxHash()) == nil {
+		t.Error("expected disconnected tx back in the mempool")
+	}
+	if u := mp.Utxo(wire.OutPoint{Hash: send.TxHash(), Index: 2}); u == nil || !u.Unconfirmed {
+		t.Error("expected disconnected output to be unconfirmed")
+	}
+}
+
+func TestMempoolReorgConflict(t *testing.T) {
+	idx := New()
+	genesis := testGenesis(t, 0x01, 1000, true)
+	id := testTokenID(genesis)
+	b0 := testBlock(nil, genesis)
+	if _, err := idx.ConnectBlock(b0, 0); err != nil {
+		t.Fatal(err)
+	}
+	mp := NewMempool(idx.Lookup)
+
+	// the block spends the genesis output, after it is disconnected a
+	// mempool tx spends the same output with a child of its own
+	mined := testSend(t, 0x01, id, []wire.OutPoint{{Hash: genesis.TxHash(), Index: 1}}, 1000)
+	b1 := testBlock(b0, mined)
+	if _, err := idx.ConnectBlock(b1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.DisconnectBlock(); err != nil {
+		t.Fatal(err)
+	}
+	rival := testSend(t, 0x01, id, []wire.OutPoint{{Hash: genesis.TxHash(), Index: 1}}, 600, 400)
+	child := testSend(t, 0x01, id, []wire.OutPoint{{Hash: rival.TxHash(), Index: 1}}, 600)
+	for _, tx := range []*wire.MsgTx{rival, child} {
+		if _, err := mp.AddTx(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	evicted := mp.BlockDisconnected(b1)
+	if len(evicted) != 2 || mp.Entry(rival.TxHash()) != nil || mp.Entry(child.TxHash()) != nil {
+		t.Fatalf("expected rival and child evicted, got %v", evicted)
+	}
+	if mp.Entry(mined.TxHash()) == nil {
+		t.Fatal("expected the disconnected tx in the mempool")
+	}
+	if u := mp.Utxo(wire.OutPoint{Hash: rival.TxHash(), Index: 1}); u != nil {
+		t.Error("expected no outputs of the evicted tx")
+	}
+	utxos := mp.Utxos()
+	if len(utxos) != 1 || utxos[0].OutPoint.Hash != mined.TxHash() {
+		t.Errorf("expected only the output of the disconnected tx, got %+v", utxos)
+	}
+}
+
+func TestMempoolScriptUtxos(t *testing.T) {
+	idx := New()
+	genesis := testGenesis(t, 0x01, 1000, true)
+	id := testTokenID(genesis)
+	if _, err := idx.ConnectBlock(testBlock(nil, genesis), 0); err != nil {
+		t.Fatal(err)
+	}
+	mp := NewMempool(idx.Lookup)
+
+	other := []byte{0x52}
+	send := testSend(t, 0x01, id, []wire.OutPoint{{Hash: genesis.TxHash(), Index: 1}}, 600, 400)
+	send.TxOut[2].PkScript = other
+	if _, err := mp.AddTx(send); err != nil {
+		t.Fatal(err)
+	}
+	if u := mp.ScriptUtxos(other); len(u) != 1 || u[0].OutPoint.Index != 2 || !u[0].Unconfirmed {
+		t.Fatalf("unexpected outputs of other %+v", u)
+	}
+	if u := mp.ScriptUtxos(testPkScript); len(u) != 1 || u[0].OutPoint.Index != 1 {
+		t.Fatalf("unexpected outputs of testPkScript %+v", u)
+	}
+
+	// spending the output of other leaves it nothing unconfirmed
+	child := testSend(t, 0x01, id, []wire.OutPoint{{Hash: send.TxHash(), Index: 2}}, 400)
+	if _, err := mp.AddTx(child); err != nil {
+		t.Fatal(err)
+	}
+	if u := mp.ScriptUtxos(other); len(u) != 0 {
+		t.Errorf("expected no outputs of other, got %+v", u)
+	}
+	if u := mp.ScriptUtxos(testPkScript); len(u) != 2 {
+		t.Errorf("expected 2 outputs of testPkScript, got %+v", u)
+	}
+}
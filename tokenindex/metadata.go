@@ -0,0 +1,53 @@
+package tokenindex
+
+import (
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+// TokenMetadata is the information a token genesis declares
+type TokenMetadata struct {
+	TokenID   TokenID
+	TokenType v1parser.TokenType
+
+	Ticker       []byte
+	Name         []byte
+	DocumentURI  []byte
+	DocumentHash []byte
+	Decimals     int
+
+	GenesisTx     chainhash.Hash
+	GenesisHeight int32
+
+	// GroupID is the NFT1 group an NFT1 child was created from, nil for
+	// other tokens
+	GroupID *TokenID
+}
+
+// NewTokenMetadata returns the metadata declared by a valid genesis result,
+// or nil when res is not one
+func NewTokenMetadata(res *TxResult, height int32) *TokenMetadata {
+	genesis, ok := res.SlpMsg.(*v1parser.SlpGenesis)
+	if !ok || !res.Valid {
+		return nil
+	}
+	meta := &TokenMetadata{
+		TokenID:       res.TokenID,
+		TokenType:     genesis.TokenType(),
+		Ticker:        genesis.Ticker,
+		Name:          genesis.Name,
+		DocumentURI:   genesis.DocumentURI,
+		DocumentHash:  genesis.DocumentHash,
+		Decimals:      genesis.Decimals,
+		GenesisTx:     res.TxHash,
+		GenesisHeight: height,
+	}
+
+	// a valid child genesis spends its group at input 0, which is the
+	// first spent token
+	if meta.TokenType == v1parser.TokenTypeNft1Child41 && len(res.Spent) > 0 {
+		groupID := res.Spent[0].Utxo.TokenID
+		meta.GroupID = &groupID
+	}
+	return meta
+}
@@ -0,0 +1,64 @@
+package tokenindex
+
+import (
+	"bytes"
+	"sort"
+)
+
+// NFTChild is an NFT1 child token and the outputs currently holding it
+type NFTChild struct {
+	Metadata *TokenMetadata
+
+	// Owners are the unspent outputs of the child, empty once it is burned
+	Owners []*OutPointUtxo
+}
+
+// NFTGroup returns the NFT1 group a child token was created from, ok is
+// false when tokenID is not a known child
+func (idx *Index) NFTGroup(tokenID TokenID) (groupID TokenID, ok bool) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	meta, known := idx.meta[tokenID]
+	if !known || meta.GroupID == nil {
+		return TokenID{}, false
+	}
+	return *meta.GroupID, true
+}
+
+// NFTChildCount returns the number of children created from an NFT1 group
+func (idx *Index) NFTChildCount(groupID TokenID) int {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	return len(idx.children[groupID])
+}
+
+// NFTChildren returns up to limit children of an NFT1 group ordered by
+// token id, starting after the child after when it is not nil. next is the
+// after of the following page and nil on the last page.
+func (idx *Index) NFTChildren(groupID TokenID, after *TokenID, limit int) (children []*NFTChild, next *TokenID) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	ids := make([]TokenID, 0, len(idx.children[groupID]))
+	for id := range idx.children[groupID] {
+		if after == nil || bytes.Compare(id[:], after[:]) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i][:], ids[j][:]) < 0
+	})
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+		last := ids[limit-1]
+		next = &last
+	}
+
+	for _, id := range ids {
+		children = append(children, &NFTChild{
+			Metadata: idx.meta[id],
+			Owners:   idx.tokenUtxos(id),
+		})
+	}
+	return children, next
+}
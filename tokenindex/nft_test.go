@@ -0,0 +1,100 @@
+package tokenindex
+
+import (
+	"testing"
+
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+)
+
+// testChildGenesis creates an NFT1 child genesis spending group at input 0
+func testChildGenesis(t *testing.T, group wire.OutPoint) *wire.MsgTx {
+	slpMsg, err := metadatamaker.CreateOpReturnGenesis(0x41, []byte("C"), []byte("child"), nil, nil, 0, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testTx(slpMsg, []wire.OutPoint{group}, 1)
+}
+
+func TestNFTChildren(t *testing.T) {
+	store := NewMemoryStore()
+	idx, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := testGenesis(t, 0x81, 10, false)
+	groupID := testTokenID(group)
+	split := testSend(t, 0x81, groupID, []wire.OutPoint{{Hash: group.TxHash(), Index: 1}}, 1, 1, 1, 7)
+	b0 := testBlock(nil, group, split)
+	if _, err := idx.ConnectBlock(b0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var childIDs []TokenID
+	var txs []*wire.MsgTx
+	for i := uint32(1); i <= 3; i++ {
+		child := testChildGenesis(t, wire.OutPoint{Hash: split.TxHash(), Index: i})
+		childIDs = append(childIDs, testTokenID(child))
+		txs = append(txs, child)
+	}
+	// the first child moves to another script
+	moved := testSend(t, 0x41, childIDs[0], []wire.OutPoint{{Hash: txs[0].TxHash(), Index: 1}}, 1)
+	moved.TxOut[1].PkScript = []byte{0x52}
+	b1 := testBlock(b0, append(txs, moved)...)
+	if _, err := idx.ConnectBlock(b1, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, ok := idx.NFTGroup(childIDs[1]); !ok || g != groupID {
+		t.Errorf("expected group of child, got %v %v", g, ok)
+	}
+	if _, ok := idx.NFTGroup(groupID); ok {
+		t.Error("expected a group to have no group")
+	}
+	if n := idx.NFTChildCount(groupID); n != 3 {
+		t.Fatalf("expected 3 children, got %d", n)
+	}
+	reopened, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := reopened.NFTChildCount(groupID); n != 3 {
+		t.Errorf("expected 3 children after reopening, got %d", n)
+	}
+
+	var seen []*NFTChild
+	var after *TokenID
+	for page := 0; ; page++ {
+		children, next := idx.NFTChildren(groupID, after, 2)
+		seen = append(seen, children...)
+		if next == nil {
+			break
+		}
+		if page > 2 {
+			t.Fatal("paging does not end")
+		}
+		after = next
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected 3 children over all pages, got %d", len(seen))
+	}
+	for _, c := range seen {
+		if len(c.Owners) != 1 {
+			t.Fatalf("expected one owner of %s, got %d", c.Metadata.TokenID, len(c.Owners))
+		}
+		script := c.Owners[0].Utxo.PkScript
+		if moved := c.Metadata.TokenID == childIDs[0]; moved != (script[0] == 0x52) {
+			t.Errorf("unexpected owner script %x of %s", script, c.Metadata.TokenID)
+		}
+	}
+
+	if _, err := idx.DisconnectBlock(); err != nil {
+		t.Fatal(err)
+	}
+	if n := idx.NFTChildCount(groupID); n != 0 {
+		t.Errorf("expected children removed with their block, got %d", n)
+	}
+	if _, ok := idx.NFTGroup(childIDs[0]); ok {
+		t.Error("expected disconnected child to be unknown")
+	}
+}
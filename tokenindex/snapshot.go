@@ -0,0 +1,586 @@
+package tokenindex
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+// SnapshotVersion is the version of the snapshot formats written
+const SnapshotVersion = 1
+
+// snapshotMagic starts every binary snapshot
+var snapshotMagic = [4]byte{'s', 'l', 'p', 's'}
+
+var (
+	// ErrUnknownBlock is returned when snapshotting a block the index has
+	// no undo data for
+	ErrUnknownBlock = errors.New("block is not in the undo journal")
+
+	// ErrSnapshotFormat is returned when reading data that is not a
+	// snapshot of a supported version
+	ErrSnapshotFormat = errors.New("unsupported snapshot format")
+
+	// ErrSnapshotHash is returned when a snapshot does not match its
+	// content hash
+	ErrSnapshotHash = errors.New("snapshot content hash mismatch")
+
+	// ErrStoreNotEmpty is returned when restoring into a store that already
+	// holds state
+	ErrStoreNotEmpty = errors.New("snapshot must be restored into an empty store")
+)
+
+// Snapshot is the token UTXO set, metadata and stats at a block. Entries are
+// ordered by outpoint and token id so equal states encode identically.
+type Snapshot struct {
+	Hash   chainhash.Hash
+	Height int32
+
+	Utxos    []*OutPointUtxo
+	Metadata []*TokenMetadata
+	Stats    []*TokenStats
+}
+
+// Snapshot returns the state at the tip
+func (idx *Index) Snapshot() *Snapshot {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	hash, _ := idx.tip()
+	snap, _ := idx.snapshotAt(hash)
+	return snap
+}
+
+// SnapshotAt returns the state at the connected block hash, reverting
+// later blocks with their undo data without changing the index
+func (idx *Index) SnapshotAt(hash chainhash.Hash) (*Snapshot, error) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	return idx.snapshotAt(hash)
+}
+
+// snapshotAt builds the snapshot at hash, the caller must hold the lock
+func (idx *Index) snapshotAt(hash chainhash.Hash) (*Snapshot, error) {
+	snap := &Snapshot{Hash: idx.base, Height: idx.baseHeight}
+	keep := -1
+	for i, undo := range idx.undo {
+		if undo.Hash == hash {
+			keep = i
+			snap.Hash = undo.Hash
+			snap.Height = undo.Height
+		}
+	}
+	if keep < 0 && hash != idx.base {
+		return nil, ErrUnknownBlock
+	}
+
+	utxos := make(map[wire.OutPoint]*TokenUtxo, len(idx.utxos))
+	for op, u := range idx.utxos {
+		utxos[op] = u
+	}
+	meta := make(map[TokenID]*TokenMetadata, len(idx.meta))
+	for id, m := range idx.meta {
+		meta[id] = m
+	}
+	stats := &statsTracker{tokens: idx.stats.snapshot(), holders: make(map[TokenID]map[string]int)}
+	for id, holders := range idx.stats.holders {
+		stats.holders[id] = make(map[string]int, len(holders))
+		for script, n := range holders {
+			stats.holders[id][script] = n
+		}
+	}
+
+	for i := len(idx.undo) - 1; i > keep; i-- {
+		undo := idx.undo[i]
+		for _, s := range undo.Spent {
+			utxos[s.OutPoint] = s.Utxo
+		}
+		for _, op := range undo.Created {
+			delete(utxos, op)
+		}
+		for _, d := range undo.Deltas {
+			if d.IsGenesis {
+				delete(meta, d.TokenID)
+			}
+		}
+		stats.apply(undo, -1)
+	}
+
+	for op, u := range utxos {
+		snap.Utxos = append(snap.Utxos, &OutPointUtxo{OutPoint: op, Utxo: u})
+	}
+	sortOutPoints(snap.Utxos)
+	for _, m := range meta {
+		snap.Metadata = append(snap.Metadata, m)
+	}
+	sort.Slice(snap.Metadata, func(i, j int) bool {
+		return bytes.Compare(snap.Metadata[i].TokenID[:], snap.Metadata[j].TokenID[:]) < 0
+	})
+	for _, s := range stats.tokens {
+		snap.Stats = append(snap.Stats, s)
+	}
+	sort.Slice(snap.Stats, func(i, j int) bool {
+		return bytes.Compare(snap.Stats[i].TokenID[:], snap.Stats[j].TokenID[:]) < 0
+	})
+	return snap, nil
+}
+
+// Restore creates an Index at the snapshot block, later blocks connect on
+// top of it. The snapshot has no undo data so the index cannot rewind
+// below it, nor does it know the validity of earlier transactions. When
+// store is not nil the snapshot is written to it in one batch and the index
+// commits every later change to it.
+func Restore(snap *Snapshot, store Store) (*Index, error) {
+	return RestoreWithConfig(snap, store, Config{})
+}
+
+// RestoreWithConfig is Restore creating an Index configured by cfg
+func RestoreWithConfig(snap *Snapshot, store Store, cfg Config) (*Index, error) {
+	idx := NewWithConfig(cfg)
+	idx.base = snap.Hash
+	idx.baseHeight = snap.Height
+	idx.pruned = true
+	for _, u := range snap.Utxos {
+		idx.addUtxo(u.OutPoint, u.Utxo)
+	}
+	for _, m := range snap.Metadata {
+		idx.putMeta(m)
+	}
+	for _, s := range snap.Stats {
+		idx.addStats(s.copy())
+	}
+	if store == nil {
+		return idx, nil
+	}
+
+	if _, height, err := store.Tip(); err != nil {
+		return nil, err
+	} else if height >= 0 {
+		return nil, ErrStoreNotEmpty
+	}
+	b := newBatch(snap.Hash, snap.Height)
+	for op, u := range idx.utxos {
+		b.PutUtxos[op] = u
+	}
+	b.PutMetadata = snap.Metadata
+	for _, s := range snap.Stats {
+		b.PutStats = append(b.PutStats, s.copy())
+	}
+	if err := store.Commit(b); err != nil {
+		return nil, err
+	}
+	idx.store = store
+	return idx, nil
+}
+
+// encode writes the snapshot body that the content hash covers
+func (s *Snapshot) encode(w io.Writer) error {
+	e := &encoder{w: w}
+	e.write(s.Hash[:])
+	e.int64(int64(s.Height))
+	e.uint64(uint64(len(s.Utxos)))
+	for _, u := range s.Utxos {
+		e.outPoint(u.OutPoint)
+		e.tokenUtxo(u.Utxo)
+	}
+	if e.err != nil {
+		return e.err
+	}
+	e.uint64(uint64(len(s.Metadata)))
+	for _, m := range s.Metadata {
+		if err := m.Serialize(w); err != nil {
+			return err
+		}
+	}
+	e.uint64(uint64(len(s.Stats)))
+	for _, st := range s.Stats {
+		if err := st.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return e.err
+}
+
+// ContentHash returns the double sha256 of the binary snapshot body, two
+// nodes with equal state at the same block have the same content hash
+func (s *Snapshot) ContentHash() chainhash.Hash {
+	h := sha256.New()
+	s.encode(h)
+	return chainhash.Hash(sha256.Sum256(h.Sum(nil)))
+}
+
+// Serialize writes the versioned binary encoding of s followed by its
+// content hash
+func (s *Snapshot) Serialize(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	e := &encoder{w: bw}
+	e.write(snapshotMagic[:])
+	e.uint64(SnapshotVersion)
+	if e.err != nil {
+		return e.err
+	}
+	if err := s.encode(bw); err != nil {
+		return err
+	}
+	hash := s.ContentHash()
+	e.write(hash[:])
+	if e.err != nil {
+		return e.err
+	}
+	return bw.Flush()
+}
+
+// Deserialize reads the encoding written by Serialize, verifying the
+// content hash
+func (s *Snapshot) Deserialize(r io.Reader) error {
+	br := bufio.NewReader(r)
+	d := newDecoder(br)
+	var magic [4]byte
+	d.read(magic[:])
+	if d.err == nil && (magic != snapshotMagic || d.uint64() != SnapshotVersion) {
+		return ErrSnapshotFormat
+	}
+	s.Hash = d.hash()
+	s.Height = int32(d.int64())
+
+	s.Utxos = nil
+	n := d.uint64()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		u := &OutPointUtxo{OutPoint: d.outPoint(), Utxo: new(TokenUtxo)}
+		d.tokenUtxo(u.Utxo)
+		s.Utxos = append(s.Utxos, u)
+	}
+
+	// the metadata and stats decoders read from the same buffered reader
+	s.Metadata = nil
+	n = d.uint64()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		m := new(TokenMetadata)
+		d.err = m.Deserialize(br)
+		s.Metadata = append(s.Metadata, m)
+	}
+	s.Stats = nil
+	n = d.uint64()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		st := new(TokenStats)
+		d.err = st.Deserialize(br)
+		s.Stats = append(s.Stats, st)
+	}
+
+	hash := d.hash()
+	if d.err != nil {
+		return d.err
+	}
+	if hash != s.ContentHash() {
+		return ErrSnapshotHash
+	}
+	return nil
+}
+
+// snapshotLine is one line of the JSONL snapshot format. The first line is
+// the header, followed by one line per utxo, metadata and stats entry, and
+// the content hash on the last line.
+type snapshotLine struct {
+	Type string `json:"type"`
+
+	Version     int    `json:"version,omitempty"`
+	Hash        string `json:"hash,omitempty"`
+	Height      *int32 `json:"height,omitempty"`
+	ContentHash string `json:"contentHash,omitempty"`
+
+	Utxo     *jsonUtxo     `json:"utxo,omitempty"`
+	Metadata *jsonMetadata `json:"metadata,omitempty"`
+	Stats    *jsonStats    `json:"stats,omitempty"`
+}
+
+type jsonUtxo struct {
+	OutPoint    string `json:"outpoint"`
+	TokenID     string `json:"tokenId"`
+	TokenType   int    `json:"tokenType"`
+	Amount      uint64 `json:"amount"`
+	IsMintBaton bool   `json:"isMintBaton"`
+	Value       int64  `json:"value"`
+	PkScript    string `json:"pkScript"`
+	Height      int32  `json:"height"`
+}
+
+type jsonMetadata struct {
+	TokenID       string `json:"tokenId"`
+	TokenType     int    `json:"tokenType"`
+	Ticker        string `json:"ticker"`
+	Name          string `json:"name"`
+	DocumentURI   string `json:"documentUri"`
+	DocumentHash  string `json:"documentHash"`
+	Decimals      int    `json:"decimals"`
+	GenesisTx     string `json:"genesisTx"`
+	GenesisHeight int32  `json:"genesisHeight"`
+	GroupID       string `json:"groupId,omitempty"`
+}
+
+type jsonStats struct {
+	TokenID         string              `json:"tokenId"`
+	TokenType       int                 `json:"tokenType"`
+	GenesisQuantity uint64              `json:"genesisQuantity"`
+	Minted          *big.Int            `json:"minted"`
+	Burned          *big.Int            `json:"burned"`
+	Burns           map[string]*big.Int `json:"burns"`
+	Circulating     *big.Int            `json:"circulating"`
+	Outputs         int                 `json:"outputs"`
+	Addresses       int                 `json:"addresses"`
+	Baton           string              `json:"baton,omitempty"`
+}
+
+// WriteJSONL writes s as JSON lines, byte strings are hex encoded
+func (s *Snapshot) WriteJSONL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	height := s.Height
+	err := enc.Encode(&snapshotLine{Type: "header", Version: SnapshotVersion, Hash: s.Hash.String(), Height: &height})
+	if err != nil {
+		return err
+	}
+	for _, u := range s.Utxos {
+		line := &snapshotLine{Type: "utxo", Utxo: &jsonUtxo{
+			OutPoint:    u.OutPoint.String(),
+			TokenID:     u.Utxo.TokenID.String(),
+			TokenType:   int(u.Utxo.TokenType),
+			Amount:      u.Utxo.Amount,
+			IsMintBaton: u.Utxo.IsMintBaton,
+			Value:       u.Utxo.Value,
+			PkScript:    hex.EncodeToString(u.Utxo.PkScript),
+			Height:      u.Utxo.Height,
+		}}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	for _, m := range s.Metadata {
+		jm := &jsonMetadata{
+			TokenID:       m.TokenID.String(),
+			TokenType:     int(m.TokenType),
+			Ticker:        hex.EncodeToString(m.Ticker),
+			Name:          hex.EncodeToString(m.Name),
+			DocumentURI:   hex.EncodeToString(m.DocumentURI),
+			DocumentHash:  hex.EncodeToString(m.DocumentHash),
+			Decimals:      m.Decimals,
+			GenesisTx:     m.GenesisTx.String(),
+			GenesisHeight: m.GenesisHeight,
+		}
+		if m.GroupID != nil {
+			jm.GroupID = m.GroupID.String()
+		}
+		if err := enc.Encode(&snapshotLine{Type: "metadata", Metadata: jm}); err != nil {
+			return err
+		}
+	}
+	for _, st := range s.Stats {
+		js := &jsonStats{
+			TokenID:         st.TokenID.String(),
+			TokenType:       int(st.TokenType),
+			GenesisQuantity: st.GenesisQuantity,
+			Minted:          st.Minted,
+			Burned:          st.Burned,
+			Burns:           make(map[string]*big.Int, len(st.Burns)),
+			Circulating:     st.Circulating,
+			Outputs:         st.Outputs,
+			Addresses:       st.Addresses,
+		}
+		for c, v := range st.Burns {
+			js.Burns[c.String()] = v
+		}
+		if st.Baton != nil {
+			js.Baton = st.Baton.String()
+		}
+		if err := enc.Encode(&snapshotLine{Type: "stats", Stats: js}); err != nil {
+			return err
+		}
+	}
+	if err := enc.Encode(&snapshotLine{Type: "end", ContentHash: s.ContentHash().String()}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ReadJSONL reads the format written by WriteJSONL, verifying the content
+// hash
+func (s *Snapshot) ReadJSONL(r io.Reader) error {
+	*s = Snapshot{}
+	dec := json.NewDecoder(r)
+	var line snapshotLine
+	if err := dec.Decode(&line); err != nil {
+		return err
+	}
+	if line.Type != "header" || line.Version != SnapshotVersion || line.Height == nil {
+		return ErrSnapshotFormat
+	}
+	hash, err := chainhash.NewHashFromStr(line.Hash)
+	if err != nil {
+		return err
+	}
+	s.Hash = *hash
+	s.Height = *line.Height
+
+	for {
+		line = snapshotLine{}
+		if err := dec.Decode(&line); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		switch {
+		case line.Type == "utxo" && line.Utxo != nil:
+			u, err := line.Utxo.parse()
+			if err != nil {
+				return err
+			}
+			s.Utxos = append(s.Utxos, u)
+		case line.Type == "metadata" && line.Metadata != nil:
+			m, err := line.Metadata.parse()
+			if err != nil {
+				return err
+			}
+			s.Metadata = append(s.Metadata, m)
+		case line.Type == "stats" && line.Stats != nil:
+			st, err := line.Stats.parse()
+			if err != nil {
+				return err
+			}
+			s.Stats = append(s.Stats, st)
+		case line.Type == "end":
+			if line.ContentHash != s.ContentHash().String() {
+				return ErrSnapshotHash
+			}
+			return nil
+		default:
+			return fmt.Errorf("%w: unexpected %q line", ErrSnapshotFormat, line.Type)
+		}
+	}
+}
+
+func parseOutPoint(s string) (wire.OutPoint, error) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return wire.OutPoint{}, fmt.Errorf("invalid outpoint %q", s)
+	}
+	hash, err := chainhash.NewHashFromStr(s[:i])
+	if err != nil {
+		return wire.OutPoint{}, err
+	}
+	index, err := strconv.ParseUint(s[i+1:], 10, 32)
+	if err != nil {
+		return wire.OutPoint{}, err
+	}
+	return wire.OutPoint{Hash: *hash, Index: uint32(index)}, nil
+}
+
+func (j *jsonUtxo) parse() (*OutPointUtxo, error) {
+	op, err := parseOutPoint(j.OutPoint)
+	if err != nil {
+		return nil, err
+	}
+	id, err := TokenIDFromString(j.TokenID)
+	if err != nil {
+		return nil, err
+	}
+	script, err := hex.DecodeString(j.PkScript)
+	if err != nil {
+		return nil, err
+	}
+	return &OutPointUtxo{OutPoint: op, Utxo: &TokenUtxo{
+		TokenID:     id,
+		TokenType:   v1parser.TokenType(j.TokenType),
+		Amount:      j.Amount,
+		IsMintBaton: j.IsMintBaton,
+		Value:       j.Value,
+		PkScript:    script,
+		Height:      j.Height,
+	}}, nil
+}
+
+func (j *jsonMetadata) parse() (*TokenMetadata, error) {
+	id, err := TokenIDFromString(j.TokenID)
+	if err != nil {
+		return nil, err
+	}
+	genesisTx, err := chainhash.NewHashFromStr(j.GenesisTx)
+	if err != nil {
+		return nil, err
+	}
+	m := &TokenMetadata{
+		TokenID:       id,
+		TokenType:     v1parser.TokenType(j.TokenType),
+		Decimals:      j.Decimals,
+		GenesisTx:     *genesisTx,
+		GenesisHeight: j.GenesisHeight,
+	}
+	for _, f := range []struct {
+		dst *[]byte
+		src string
+	}{{&m.Ticker, j.Ticker}, {&m.Name, j.Name}, {&m.DocumentURI, j.DocumentURI}, {&m.DocumentHash, j.DocumentHash}} {
+		if *f.dst, err = hex.DecodeString(f.src); err != nil {
+			return nil, err
+		}
+	}
+	if j.GroupID != "" {
+		groupID, err := TokenIDFromString(j.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		m.GroupID = &groupID
+	}
+	return m, nil
+}
+
+func (j *jsonStats) parse() (*TokenStats, error) {
+	id, err := TokenIDFromString(j.TokenID)
+	if err != nil {
+		return nil, err
+	}
+	if j.Minted == nil || j.Burned == nil || j.Circulating == nil {
+		return nil, fmt.Errorf("%w: incomplete stats of %s", ErrSnapshotFormat, j.TokenID)
+	}
+	st := newTokenStats(id, v1parser.TokenType(j.TokenType))
+	st.GenesisQuantity = j.GenesisQuantity
+	st.Minted = j.Minted
+	st.Burned = j.Burned
+	st.Circulating = j.Circulating
+	st.Outputs = j.Outputs
+	st.Addresses = j.Addresses
+	for name, v := range j.Burns {
+		c, ok := burnCategoryByName(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown burn category %q", ErrSnapshotFormat, name)
+		}
+		st.Burns[c] = v
+	}
+	if j.Baton != "" {
+		op, err := parseOutPoint(j.Baton)
+		if err != nil {
+			return nil, err
+		}
+		st.Baton = &op
+	}
+	return st, nil
+}
+
+func burnCategoryByName(name string) (BurnCategory, bool) {
+	for c := BurnNonSlp; c <= BurnSendExcess; c++ {
+		if c.String() == name {
+			return c, true
+		}
+	}
+	return 0, false
+}
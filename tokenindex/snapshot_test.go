@@ -0,0 +1,115 @@
+package tokenindex
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	idx := New()
+	testChain(t, idx)
+	snap := idx.Snapshot()
+	if len(snap.Utxos) == 0 || len(snap.Metadata) != 1 || len(snap.Stats) != 1 {
+		t.Fatalf("unexpected snapshot %+v", snap)
+	}
+
+	var buf bytes.Buffer
+	if err := snap.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	var decoded Snapshot
+	if err := decoded.Deserialize(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, snap) {
+		t.Error("decoded snapshot differs")
+	}
+
+	buf.Reset()
+	if err := snap.WriteJSONL(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON Snapshot
+	if err := fromJSON.ReadJSONL(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if fromJSON.ContentHash() != snap.ContentHash() {
+		t.Error("JSONL snapshot has a different content hash")
+	}
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-40]++
+	if err := new(Snapshot).Deserialize(bytes.NewReader(corrupt)); err != ErrSnapshotHash {
+		t.Errorf("expected ErrSnapshotHash, got %v", err)
+	}
+	if err := new(Snapshot).Deserialize(bytes.NewReader([]byte("junk"))); err != ErrSnapshotFormat {
+		t.Errorf("expected ErrSnapshotFormat, got %v", err)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	idx := New()
+	_, blocks := testChain(t, idx)
+
+	// the snapshot at block 1 matches an index that stopped there
+	snap, err := idx.SnapshotAt(blocks[1].BlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial := New()
+	for i, block := range blocks[:2] {
+		if _, err := partial.ConnectBlock(block, int32(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if snap.ContentHash() != partial.Snapshot().ContentHash() {
+		t.Fatal("snapshot at block 1 differs from the state at block 1")
+	}
+
+	store := NewMemoryStore()
+	restored, err := Restore(snap, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := restored.StatsSnapshot(); stats.Hash != blocks[1].BlockHash() || stats.Height != 1 || len(stats.Tokens) == 0 {
+		t.Errorf("unexpected restored stats at %v height %d", stats.Hash, stats.Height)
+	}
+	if _, err := restored.ConnectBlock(blocks[0], 0); err != ErrDoesNotConnect {
+		t.Errorf("expected ErrDoesNotConnect, got %v", err)
+	}
+	if _, err := restored.ConnectBlock(blocks[2], 2); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Snapshot().ContentHash() != idx.Snapshot().ContentHash() {
+		t.Error("resumed index differs from the original")
+	}
+
+	reopened, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, height := reopened.Tip(); hash != blocks[2].BlockHash() || height != 2 {
+		t.Errorf("unexpected reopened tip %v at %d", hash, height)
+	}
+	if _, err := reopened.Rewind(0); err != ErrRewindTooDeep {
+		t.Errorf("expected ErrRewindTooDeep, got %v", err)
+	}
+	if _, err := reopened.Rewind(1); err != nil {
+		t.Fatal(err)
+	}
+	if hash, _ := reopened.Tip(); hash != blocks[1].BlockHash() {
+		t.Error("expected tip back at the snapshot block")
+	}
+	if stats := reopened.StatsSnapshot(); stats.Hash != blocks[1].BlockHash() || stats.Height != 1 {
+		t.Errorf("unexpected rewound stats at %v height %d", stats.Hash, stats.Height)
+	}
+	if reopened.Snapshot().ContentHash() != snap.ContentHash() {
+		t.Error("rewound index differs from the snapshot")
+	}
+
+	if _, err := Restore(snap, store); err != ErrStoreNotEmpty {
+		t.Errorf("expected ErrStoreNotEmpty, got %v", err)
+	}
+}
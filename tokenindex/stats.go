@@ -0,0 +1,298 @@
+package tokenindex
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+// BurnCategory is the reason token amounts were burned
+type BurnCategory int
+
+const (
+	// BurnNonSlp is an amount spent by a transaction without an SLP message
+	BurnNonSlp BurnCategory = iota
+
+	// BurnInvalid is an amount spent by an invalid SLP transaction
+	BurnInvalid
+
+	// BurnOtherToken is an amount spent by a valid SLP transaction of a
+	// different token, including NFT1 groups consumed by child genesis
+	BurnOtherToken
+
+	// BurnMint is an amount spent by a valid MINT of the same token
+	BurnMint
+
+	// BurnSendExcess is the part of the inputs a valid SEND did not carry
+	// forward
+	BurnSendExcess
+)
+
+// String returns the name of the burn category
+func (c BurnCategory) String() string {
+	switch c {
+	case BurnNonSlp:
+		return "non-slp"
+	case BurnInvalid:
+		return "invalid"
+	case BurnOtherToken:
+		return "other-token"
+	case BurnMint:
+		return "mint"
+	case BurnSendExcess:
+		return "send-excess"
+	}
+	return "unknown"
+}
+
+// burnCategory returns why res burns the amount of u, burned is false when
+// u is an input to a valid SEND of the same token
+func burnCategory(res *TxResult, u *TokenUtxo) (category BurnCategory, burned bool) {
+	if !res.IsSlp() {
+		return BurnNonSlp, true
+	}
+	if !res.Valid {
+		return BurnInvalid, true
+	}
+	if u.TokenID != res.TokenID || u.TokenType != res.SlpMsg.TokenType() {
+		return BurnOtherToken, true
+	}
+	if _, ok := res.SlpMsg.(*v1parser.SlpMint); ok {
+		return BurnMint, true
+	}
+	return 0, false
+}
+
+// TokenStats is the supply and distribution of one token
+type TokenStats struct {
+	TokenID   TokenID
+	TokenType v1parser.TokenType
+
+	// GenesisQuantity is the quantity issued by the genesis
+	GenesisQuantity uint64
+
+	// Minted is the cumulative quantity issued by MINT transactions
+	Minted *big.Int
+
+	// Burned is the cumulative quantity burned, Burns splits it by category
+	Burned *big.Int
+	Burns  map[BurnCategory]*big.Int
+
+	// Circulating is the quantity held by unspent outputs
+	Circulating *big.Int
+
+	// Outputs is the number of unspent outputs carrying an amount
+	Outputs int
+
+	// Addresses is the number of distinct output scripts holding an amount
+	Addresses int
+
+	// Baton is the outpoint of the mint baton, nil when there is none
+	Baton *wire.OutPoint
+}
+
+func newTokenStats(id TokenID, tokenType v1parser.TokenType) *TokenStats {
+	return &TokenStats{
+		TokenID:     id,
+		TokenType:   tokenType,
+		Minted:      new(big.Int),
+		Burned:      new(big.Int),
+		Burns:       make(map[BurnCategory]*big.Int),
+		Circulating: new(big.Int),
+	}
+}
+
+// copy returns a deep copy of s
+func (s *TokenStats) copy() *TokenStats {
+	c := *s
+	c.Minted = new(big.Int).Set(s.Minted)
+	c.Burned = new(big.Int).Set(s.Burned)
+	c.Circulating = new(big.Int).Set(s.Circulating)
+	c.Burns = make(map[BurnCategory]*big.Int, len(s.Burns))
+	for k, v := range s.Burns {
+		c.Burns[k] = new(big.Int).Set(v)
+	}
+	if s.Baton != nil {
+		baton := *s.Baton
+		c.Baton = &baton
+	}
+	return &c
+}
+
+// statsTracker tracks TokenStats by applying and reverting block journals
+type statsTracker struct {
+	tokens  map[TokenID]*TokenStats
+	holders map[TokenID]map[string]int
+}
+
+func newStatsTracker() *statsTracker {
+	return &statsTracker{
+		tokens:  make(map[TokenID]*TokenStats),
+		holders: make(map[TokenID]map[string]int),
+	}
+}
+
+// get returns the stats of id, creating them when missing
+func (ts *statsTracker) get(id TokenID, tokenType v1parser.TokenType) *TokenStats {
+	s, ok := ts.tokens[id]
+	if !ok {
+		s = newTokenStats(id, tokenType)
+		ts.tokens[id] = s
+		ts.holders[id] = make(map[string]int)
+	}
+	return s
+}
+
+// apply adds the journal of a connected block, sign is -1 to revert it
+func (ts *statsTracker) apply(undo *BlockUndo, sign int) {
+	for _, d := range undo.Deltas {
+		if sign < 0 && d.IsGenesis {
+			delete(ts.tokens, d.TokenID)
+			delete(ts.holders, d.TokenID)
+			continue
+		}
+		s := ts.get(d.TokenID, d.TokenType)
+		add := func(x, y *big.Int) {
+			if sign < 0 {
+				x.Sub(x, y)
+			} else {
+				x.Add(x, y)
+			}
+		}
+		if d.IsGenesis {
+			s.GenesisQuantity = d.Genesis
+		}
+		genesis := new(big.Int).SetUint64(d.Genesis)
+		add(s.Minted, d.Minted)
+		add(s.Burned, d.Burned)
+		for k, v := range d.Burns {
+			if _, ok := s.Burns[k]; !ok {
+				s.Burns[k] = new(big.Int)
+			}
+			add(s.Burns[k], v)
+			if s.Burns[k].Sign() == 0 {
+				delete(s.Burns, k)
+			}
+		}
+		add(s.Circulating, genesis)
+		add(s.Circulating, d.Minted)
+		add(s.Circulating, new(big.Int).Neg(d.Burned))
+		s.Outputs += sign * d.Outputs
+
+		holders := ts.holders[d.TokenID]
+		for script, n := range d.Holders {
+			holders[script] += sign * n
+			if holders[script] == 0 {
+				delete(holders, script)
+			}
+		}
+		s.Addresses = len(holders)
+	}
+
+	moves := undo.BatonMoves
+	for i := range moves {
+		m := moves[i]
+		if sign < 0 {
+			m = moves[len(moves)-1-i]
+		}
+		s, ok := ts.tokens[m.TokenID]
+		if !ok {
+			continue
+		}
+		if sign < 0 {
+			s.Baton = m.From
+		} else {
+			s.Baton = m.To
+		}
+	}
+}
+
+// StatsSnapshot holds the stats of every token at a block
+type StatsSnapshot struct {
+	Hash   chainhash.Hash
+	Height int32
+	Tokens map[TokenID]*TokenStats
+}
+
+// snapshot returns a deep copy of the current stats
+func (ts *statsTracker) snapshot() map[TokenID]*TokenStats {
+	tokens := make(map[TokenID]*TokenStats, len(ts.tokens))
+	for id, s := range ts.tokens {
+		tokens[id] = s.copy()
+	}
+	return tokens
+}
+
+// StatsDiff is the change in the stats of a token between two snapshots
+type StatsDiff struct {
+	TokenID TokenID
+
+	// Added and Removed are set when the token only exists in the newer or
+	// older snapshot respectively
+	Added   bool
+	Removed bool
+
+	Minted      *big.Int
+	Burned      *big.Int
+	Circulating *big.Int
+	Outputs     int
+	Addresses   int
+
+	// BatonChanged is true when the mint baton moved, was created or
+	// destroyed
+	BatonChanged bool
+}
+
+// DiffStats returns the tokens whose stats differ between older and newer,
+// ordered by token id
+func DiffStats(older, newer *StatsSnapshot) []*StatsDiff {
+	ids := make(map[TokenID]bool)
+	for id := range older.Tokens {
+		ids[id] = true
+	}
+	for id := range newer.Tokens {
+		ids[id] = true
+	}
+
+	var diffs []*StatsDiff
+	for id := range ids {
+		a, okA := older.Tokens[id]
+		b, okB := newer.Tokens[id]
+		if !okA {
+			a = newTokenStats(id, b.TokenType)
+		}
+		if !okB {
+			b = newTokenStats(id, a.TokenType)
+		}
+		d := &StatsDiff{
+			TokenID:      id,
+			Added:        !okA,
+			Removed:      !okB,
+			Minted:       new(big.Int).Sub(b.Minted, a.Minted),
+			Burned:       new(big.Int).Sub(b.Burned, a.Burned),
+			Circulating:  new(big.Int).Sub(b.Circulating, a.Circulating),
+			Outputs:      b.Outputs - a.Outputs,
+			Addresses:    b.Addresses - a.Addresses,
+			BatonChanged: !sameOutPoint(a.Baton, b.Baton),
+		}
+		if d.Added || d.Removed || d.Minted.Sign() != 0 || d.Burned.Sign() != 0 ||
+			d.Circulating.Sign() != 0 || d.Outputs != 0 || d.Addresses != 0 || d.BatonChanged {
+			diffs = append(diffs, d)
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return bytes.Compare(diffs[i].TokenID[:], diffs[j].TokenID[:]) < 0
+	})
+	return diffs
+}
+
+func sameOutPoint(a, b *wire.OutPoint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
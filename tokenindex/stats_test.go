@@ -0,0 +1,91 @@
+package tokenindex
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gcash/bchd/wire"
+)
+
+func TestTokenStats(t *testing.T) {
+	idx := New()
+	genesis := testGenesis(t, 0x01, 1000, true)
+	id := testTokenID(genesis)
+	gHash := genesis.TxHash()
+	b0 := testBlock(nil, genesis)
+	if _, err := idx.ConnectBlock(b0, 0); err != nil {
+		t.Fatal(err)
+	}
+	s0 := idx.StatsSnapshot()
+
+	s := idx.TokenStats(id)
+	if s.GenesisQuantity != 1000 || s.Circulating.Uint64() != 1000 || s.Outputs != 1 || s.Addresses != 1 {
+		t.Errorf("unexpected genesis stats %+v", s)
+	}
+	if s.Baton == nil || *s.Baton != (wire.OutPoint{Hash: gHash, Index: 2}) {
+		t.Errorf("unexpected baton %v", s.Baton)
+	}
+
+	// send 900 of 1000 to two scripts and mint 50 more
+	send := testSend(t, 0x01, id, []wire.OutPoint{{Hash: gHash, Index: 1}}, 600, 300)
+	send.TxOut[2].PkScript = []byte{0x52}
+	mint := testMint(t, id, wire.OutPoint{Hash: gHash, Index: 2}, 50)
+	b1 := testBlock(b0, send, mint)
+	if _, err := idx.ConnectBlock(b1, 1); err != nil {
+		t.Fatal(err)
+	}
+	s1 := idx.StatsSnapshot()
+
+	s = idx.TokenStats(id)
+	if s.Minted.Uint64() != 50 || s.Circulating.Uint64() != 950 || s.Outputs != 3 || s.Addresses != 2 {
+		t.Errorf("unexpected stats minted %s circulating %s outputs %d addresses %d",
+			s.Minted, s.Circulating, s.Outputs, s.Addresses)
+	}
+	if s.Burns[BurnSendExcess].Uint64() != 100 {
+		t.Errorf("expected 100 burned by send excess, got %s", s.Burns[BurnSendExcess])
+	}
+
+	// burn the 300 output with a plain transaction and the minted output
+	// with an invalid send
+	plain := testTx([]byte{0x51}, []wire.OutPoint{{Hash: send.TxHash(), Index: 2}}, 1)
+	invalid := testSend(t, 0x01, id, []wire.OutPoint{{Hash: mint.TxHash(), Index: 1}}, 60)
+	if _, err := idx.ConnectBlock(testBlock(b1, plain, invalid), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	s = idx.TokenStats(id)
+	if s.Burned.Uint64() != 450 || s.Burns[BurnNonSlp].Uint64() != 300 || s.Burns[BurnInvalid].Uint64() != 50 {
+		t.Errorf("unexpected burns %s %v", s.Burned, s.Burns)
+	}
+	if s.Circulating.Uint64() != 600 || s.Outputs != 1 || s.Addresses != 1 {
+		t.Errorf("unexpected circulating %s outputs %d addresses %d", s.Circulating, s.Outputs, s.Addresses)
+	}
+
+	diffs := DiffStats(s0, s1)
+	if len(diffs) != 1 {
+		t.Fatalf("expected 1 diff, got %d", len(diffs))
+	}
+	d := diffs[0]
+	if d.Added || d.Minted.Uint64() != 50 || d.Circulating.Int64() != -50 || d.Outputs != 2 || !d.BatonChanged {
+		t.Errorf("unexpected diff %+v", d)
+	}
+	if diffs := DiffStats(s1, s1); len(diffs) != 0 {
+		t.Errorf("expected no diff between equal snapshots, got %d", len(diffs))
+	}
+
+	if _, err := idx.Rewind(0); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(idx.StatsSnapshot(), s0) {
+		t.Error("stats after rewind differ from the snapshot before")
+	}
+	if _, err := idx.Rewind(-1); err != nil {
+		t.Fatal(err)
+	}
+	if idx.TokenStats(id) != nil {
+		t.Error("expected stats removed with the genesis block")
+	}
+	if diffs := DiffStats(s0, idx.StatsSnapshot()); len(diffs) != 1 || !diffs[0].Removed {
+		t.Error("expected token removed in diff")
+	}
+}
@@ -0,0 +1,439 @@
+package tokenindex
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+)
+
+// Store persists the state of an Index. Every connected or disconnected
+// block is written as one Batch which must be applied atomically, so a
+// store always holds the state at some tip.
+type Store interface {
+	// Tip returns the block the stored state is at, the height is -1 for
+	// an empty store
+	Tip() (chainhash.Hash, int32, error)
+
+	// Utxo returns the token output at op, or nil when there is none
+	Utxo(op wire.OutPoint) (*TokenUtxo, error)
+
+	// Metadata returns the genesis metadata of a token, or nil
+	Metadata(tokenID TokenID) (*TokenMetadata, error)
+
+	// Stats returns the stats of a token, or nil
+	Stats(tokenID TokenID) (*TokenStats, error)
+
+	// TxValidity returns the validity of an SLP transaction, known is false
+	// when the transaction is not stored
+	TxValidity(hash chainhash.Hash) (valid, known bool, err error)
+
+	// Undo returns the undo data of the block at height, or nil
+	Undo(height int32) (*BlockUndo, error)
+
+	// ForEachUtxo calls fn for every stored token output
+	ForEachUtxo(fn func(op wire.OutPoint, u *TokenUtxo) error) error
+
+	// ForEachMetadata calls fn for the metadata of every stored token
+	ForEachMetadata(fn func(meta *TokenMetadata) error) error
+
+	// ForEachStats calls fn for the stats of every stored token
+	ForEachStats(fn func(stats *TokenStats) error) error
+
+	// ForEachTx calls fn for every stored SLP transaction validity
+	ForEachTx(fn func(hash chainhash.Hash, valid bool) error) error
+
+	// ForEachUndo calls fn for the stored undo data by ascending height
+	ForEachUndo(fn func(undo *BlockUndo) error) error
+
+	// Commit atomically applies b
+	Commit(b *Batch) error
+
+	// Close releases the store
+	Close() error
+}
+
+// Batch holds the changes of one connected or disconnected block
+type Batch struct {
+	// Hash and Height are the tip after the batch, the height is -1 when
+	// the last block was disconnected
+	Hash   chainhash.Hash
+	Height int32
+
+	PutUtxos    map[wire.OutPoint]*TokenUtxo
+	DeleteUtxos []wire.OutPoint
+
+	PutMetadata    []*TokenMetadata
+	DeleteMetadata []TokenID
+
+	PutStats    []*TokenStats
+	DeleteStats []TokenID
+
+	PutTxs    map[chainhash.Hash]bool
+	DeleteTxs []chainhash.Hash
+
+	PutUndo *BlockUndo
+
+	// DeleteUndo holds the disconnected height or the heights pruned
+	// below the maximum reorg depth
+	DeleteUndo []int32
+}
+
+func newBatch(hash chainhash.Hash, height int32) *Batch {
+	return &Batch{
+		Hash:     hash,
+		Height:   height,
+		PutUtxos: make(map[wire.OutPoint]*TokenUtxo),
+		PutTxs:   make(map[chainhash.Hash]bool),
+	}
+}
+
+// addToken records the current metadata and stats of tokenID in b
+func (idx *Index) addToken(b *Batch, tokenID TokenID) {
+	if meta, ok := idx.meta[tokenID]; ok {
+		b.PutMetadata = append(b.PutMetadata, meta)
+	} else {
+		b.DeleteMetadata = append(b.DeleteMetadata, tokenID)
+	}
+	if s, ok := idx.stats.tokens[tokenID]; ok {
+		b.PutStats = append(b.PutStats, s.copy())
+	} else {
+		b.DeleteStats = append(b.DeleteStats, tokenID)
+	}
+}
+
+// connectBatch returns the changes made by connecting the block of undo
+func (idx *Index) connectBatch(undo *BlockUndo) *Batch {
+	b := newBatch(undo.Hash, undo.Height)
+	for _, s := range undo.Spent {
+		b.DeleteUtxos = append(b.DeleteUtxos, s.OutPoint)
+	}
+	for _, op := range undo.Created {
+		if u, ok := idx.utxos[op]; ok {
+			b.PutUtxos[op] = u
+		}
+	}
+	for _, h := range undo.SlpTxs {
+		b.PutTxs[h] = idx.txs[h]
+	}
+	for _, d := range undo.Deltas {
+		idx.addToken(b, d.TokenID)
+	}
+	b.PutUndo = undo
+	return b
+}
+
+// disconnectBatch returns the changes made by disconnecting the block of
+// undo
+func (idx *Index) disconnectBatch(undo *BlockUndo) *Batch {
+	b := newBatch(undo.PrevHash, undo.Height-1)
+	for _, s := range undo.Spent {
+		if u, ok := idx.utxos[s.OutPoint]; ok {
+			b.PutUtxos[s.OutPoint] = u
+		}
+	}
+	for _, op := range undo.Created {
+		b.DeleteUtxos = append(b.DeleteUtxos, op)
+	}
+	b.DeleteTxs = append(b.DeleteTxs, undo.SlpTxs...)
+	for _, d := range undo.Deltas {
+		idx.addToken(b, d.TokenID)
+	}
+	b.DeleteUndo = []int32{undo.Height}
+	return b
+}
+
+// commit writes b to the store, a failure leaves the index unusable since
+// its memory state is ahead of the store
+func (idx *Index) commit(b *Batch) error {
+	if idx.store == nil {
+		return nil
+	}
+	if err := idx.store.Commit(b); err != nil {
+		idx.storeErr = fmt.Errorf("index must be reopened after failed commit: %w", err)
+		return idx.storeErr
+	}
+	return nil
+}
+
+// addUtxo adds a loaded token output, counting its holder
+func (idx *Index) addUtxo(op wire.OutPoint, u *TokenUtxo) {
+	idx.putUtxo(op, u)
+	if !u.IsMintBaton {
+		holders, ok := idx.stats.holders[u.TokenID]
+		if !ok {
+			holders = make(map[string]int)
+			idx.stats.holders[u.TokenID] = holders
+		}
+		holders[string(u.PkScript)]++
+	}
+}
+
+// addStats adds loaded token stats
+func (idx *Index) addStats(s *TokenStats) {
+	idx.stats.tokens[s.TokenID] = s
+	if _, ok := idx.stats.holders[s.TokenID]; !ok {
+		idx.stats.holders[s.TokenID] = make(map[string]int)
+	}
+}
+
+// Open loads the state held by store into a new Index that commits every
+// later change to store, keeping DefaultMaxReorgDepth blocks of undo data
+func Open(store Store) (*Index, error) {
+	return OpenWithConfig(store, Config{})
+}
+
+// OpenWithConfig loads the state held by store into a new Index configured
+// by cfg. Stored undo data below the maximum reorg depth is pruned.
+func OpenWithConfig(store Store, cfg Config) (*Index, error) {
+	idx := NewWithConfig(cfg)
+	err := store.ForEachUtxo(func(op wire.OutPoint, u *TokenUtxo) error {
+		idx.addUtxo(op, u)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = store.ForEachMetadata(func(meta *TokenMetadata) error {
+		idx.putMeta(meta)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = store.ForEachStats(func(s *TokenStats) error {
+		idx.addStats(s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = store.ForEachTx(func(hash chainhash.Hash, valid bool) error {
+		idx.txs[hash] = valid
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	hash, height, err := store.Tip()
+	if err != nil {
+		return nil, err
+	}
+	var prune []int32
+	err = store.ForEachUndo(func(undo *BlockUndo) error {
+		if idx.maxDepth >= 0 && undo.Height <= height-idx.maxDepth {
+			prune = append(prune, undo.Height)
+			return nil
+		}
+		idx.undo = append(idx.undo, undo)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(idx.undo) > 0 {
+		idx.base = idx.undo[0].PrevHash
+		idx.baseHeight = idx.undo[0].Height - 1
+	} else {
+		idx.base = hash
+		idx.baseHeight = height
+	}
+	if tip, tipHeight := idx.Tip(); tip != hash || tipHeight != height {
+		return nil, fmt.Errorf("store tip %s at %d does not match its undo data", hash, height)
+	}
+	idx.store = store
+
+	// earlier pruning is not stored, so a full journal is taken as pruned
+	idx.pruned = len(prune) > 0 || (idx.maxDepth >= 0 && len(idx.undo) == int(idx.maxDepth))
+	if len(prune) > 0 {
+		b := newBatch(hash, height)
+		b.DeleteUndo = prune
+		if err := idx.commit(b); err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+// MemoryStore is a Store that keeps everything in memory, it is useful for
+// tests and short lived indexes
+type MemoryStore struct {
+	mtx    sync.RWMutex
+	hash   chainhash.Hash
+	height int32
+	utxos  map[wire.OutPoint]*TokenUtxo
+	meta   map[TokenID]*TokenMetadata
+	stats  map[TokenID]*TokenStats
+	txs    map[chainhash.Hash]bool
+	undo   map[int32]*BlockUndo
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		height: -1,
+		utxos:  make(map[wire.OutPoint]*TokenUtxo),
+		meta:   make(map[TokenID]*TokenMetadata),
+		stats:  make(map[TokenID]*TokenStats),
+		txs:    make(map[chainhash.Hash]bool),
+		undo:   make(map[int32]*BlockUndo),
+	}
+}
+
+// Tip implements Store
+func (s *MemoryStore) Tip() (chainhash.Hash, int32, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.hash, s.height, nil
+}
+
+// Utxo implements Store
+func (s *MemoryStore) Utxo(op wire.OutPoint) (*TokenUtxo, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.utxos[op], nil
+}
+
+// Metadata implements Store
+func (s *MemoryStore) Metadata(tokenID TokenID) (*TokenMetadata, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.meta[tokenID], nil
+}
+
+// Stats implements Store
+func (s *MemoryStore) Stats(tokenID TokenID) (*TokenStats, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if stats, ok := s.stats[tokenID]; ok {
+		return stats.copy(), nil
+	}
+	return nil, nil
+}
+
+// TxValidity implements Store
+func (s *MemoryStore) TxValidity(hash chainhash.Hash) (valid, known bool, err error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	valid, known = s.txs[hash]
+	return valid, known, nil
+}
+
+// Undo implements Store
+func (s *MemoryStore) Undo(height int32) (*BlockUndo, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.undo[height], nil
+}
+
+// ForEachUtxo implements Store
+func (s *MemoryStore) ForEachUtxo(fn func(op wire.OutPoint, u *TokenUtxo) error) error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for op, u := range s.utxos {
+		if err := fn(op, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachMetadata implements Store
+func (s *MemoryStore) ForEachMetadata(fn func(meta *TokenMetadata) error) error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for _, meta := range s.meta {
+		if err := fn(meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachStats implements Store
+func (s *MemoryStore) ForEachStats(fn func(stats *TokenStats) error) error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for _, stats := range s.stats {
+		if err := fn(stats.copy()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachTx implements Store
+func (s *MemoryStore) ForEachTx(fn func(hash chainhash.Hash, valid bool) error) error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for hash, valid := range s.txs {
+		if err := fn(hash, valid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachUndo implements Store
+func (s *MemoryStore) ForEachUndo(fn func(undo *BlockUndo) error) error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	heights := make([]int32, 0, len(s.undo))
+	for h := range s.undo {
+		heights = append(heights, h)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	for _, h := range heights {
+		if err := fn(s.undo[h]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit implements Store
+func (s *MemoryStore) Commit(b *Batch) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, op := range b.DeleteUtxos {
+		delete(s.utxos, op)
+	}
+	for op, u := range b.PutUtxos {
+		s.utxos[op] = u
+	}
+	for _, id := range b.DeleteMetadata {
+		delete(s.meta, id)
+	}
+	for _, meta := range b.PutMetadata {
+		s.meta[meta.TokenID] = meta
+	}
+	for _, id := range b.DeleteStats {
+		delete(s.stats, id)
+	}
+	for _, stats := range b.PutStats {
+		s.stats[stats.TokenID] = stats.copy()
+	}
+	for _, h := range b.DeleteTxs {
+		delete(s.txs, h)
+	}
+	for h, valid := range b.PutTxs {
+		s.txs[h] = valid
+	}
+	for _, h := range b.DeleteUndo {
+		delete(s.undo, h)
+	}
+	if b.PutUndo != nil {
+		s.undo[b.PutUndo.Height] = b.PutUndo
+	}
+	s.hash = b.Hash
+	s.height = b.Height
+	return nil
+}
+
+// Close implements Store
+func (s *MemoryStore) Close() error {
+	return nil
+}
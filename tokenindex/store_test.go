@@ -0,0 +1,193 @@
+package tokenindex
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gcash/bchd/wire"
+)
+
+// testChain connects a genesis, a send with a mint and a burn to idx
+func testChain(t *testing.T, idx *Index) (TokenID, []*wire.MsgBlock) {
+	genesis := testGenesis(t, 0x01, 1000, true)
+	id := testTokenID(genesis)
+	gHash := genesis.TxHash()
+	b0 := testBlock(nil, genesis)
+
+	send := testSend(t, 0x01, id, []wire.OutPoint{{Hash: gHash, Index: 1}}, 600, 300)
+	send.TxOut[2].PkScript = []byte{0x52}
+	mint := testMint(t, id, wire.OutPoint{Hash: gHash, Index: 2}, 50)
+	b1 := testBlock(b0, send, mint)
+
+	burn := testTx([]byte{0x51}, []wire.OutPoint{{Hash: send.TxHash(), Index: 2}}, 1)
+	b2 := testBlock(b1, burn)
+
+	blocks := []*wire.MsgBlock{b0, b1, b2}
+	for i, block := range blocks {
+		if _, err := idx.ConnectBlock(block, int32(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id, blocks
+}
+
+func TestOpenMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	idx, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, blocks := testChain(t, idx)
+
+	reopened, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reopened.TokenUtxos(id), idx.TokenUtxos(id)) {
+		t.Error("reopened utxos differ")
+	}
+	if !reflect.DeepEqual(reopened.StatsSnapshot(), idx.StatsSnapshot()) {
+		t.Error("reopened stats differ")
+	}
+	if meta := reopened.Metadata(id); meta == nil || string(meta.Ticker) != "T" {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+
+	// the reopened index can still rewind using the stored journal
+	if _, err := reopened.Rewind(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, height, _ := store.Tip(); height != 0 {
+		t.Errorf("expected stored tip at 0, got %d", height)
+	}
+	if u, _ := store.Undo(1); u != nil {
+		t.Error("expected undo of disconnected block removed")
+	}
+
+	fresh := New()
+	if _, err := fresh.ConnectBlock(blocks[0], 0); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.StatsSnapshot(), fresh.StatsSnapshot()) {
+		t.Error("stats after rewind differ from a fresh index")
+	}
+	if !reflect.DeepEqual(again.TokenUtxos(id), fresh.TokenUtxos(id)) {
+		t.Error("utxos after rewind differ from a fresh index")
+	}
+}
+
+func TestMaxReorgDepth(t *testing.T) {
+	store := NewMemoryStore()
+	idx, err := OpenWithConfig(store, Config{MaxReorgDepth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, blocks := testChain(t, idx)
+
+	// only the tip block keeps its undo data
+	for height, want := range []bool{false, false, true} {
+		if u, _ := store.Undo(int32(height)); (u != nil) != want {
+			t.Errorf("undo at %d stored %v, expected %v", height, u != nil, want)
+		}
+	}
+	if _, err := idx.Rewind(0); err != ErrRewindTooDeep {
+		t.Errorf("expected ErrRewindTooDeep, got %v", err)
+	}
+	if _, err := idx.DisconnectBlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.DisconnectBlock(); err != ErrRewindTooDeep {
+		t.Errorf("expected ErrRewindTooDeep, got %v", err)
+	}
+	if hash, height := idx.Tip(); hash != blocks[1].BlockHash() || height != 1 {
+		t.Errorf("unexpected tip %s at %d", hash, height)
+	}
+
+	// opening with a smaller depth prunes the stored journal
+	store = NewMemoryStore()
+	idx, err = OpenWithConfig(store, Config{MaxReorgDepth: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testChain(t, idx)
+	if _, err := OpenWithConfig(store, Config{MaxReorgDepth: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := store.Undo(0); u != nil {
+		t.Error("expected undo below the reorg depth pruned on open")
+	}
+	if u, _ := store.Undo(1); u == nil {
+		t.Error("expected undo within the reorg depth kept")
+	}
+}
+
+// failingStore fails every commit after the first n
+type failingStore struct {
+	*MemoryStore
+	n int
+}
+
+var errTestCommit = errors.New("commit failed")
+
+func (s *failingStore) Commit(b *Batch) error {
+	if s.n == 0 {
+		return errTestCommit
+	}
+	s.n--
+	return s.MemoryStore.Commit(b)
+}
+
+func TestFailedCommit(t *testing.T) {
+	store := &failingStore{MemoryStore: NewMemoryStore(), n: 1}
+	idx, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := testGenesis(t, 0x01, 10, false)
+	b0 := testBlock(nil, genesis)
+	if _, err := idx.ConnectBlock(b0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.ConnectBlock(testBlock(b0), 1); !errors.Is(err, errTestCommit) {
+		t.Fatalf("expected commit error, got %v", err)
+	}
+	if _, err := idx.DisconnectBlock(); !errors.Is(err, errTestCommit) {
+		t.Errorf("expected index to stay unusable, got %v", err)
+	}
+
+	reopened, err := Open(store.MemoryStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, height := reopened.Tip(); hash != b0.BlockHash() || height != 0 {
+		t.Error("expected store to hold the last committed block")
+	}
+}
+
+func TestSerializeUndo(t *testing.T) {
+	idx := New()
+	testChain(t, idx)
+	undos, err := idx.Rewind(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, undo := range undos {
+		var buf bytes.Buffer
+		if err := undo.Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		var decoded BlockUndo
+		if err := decoded.Deserialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(&decoded, undo) {
+			t.Errorf("decoded undo at height %d differs", undo.Height)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package tokenindex
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+// TokenID is a 32 byte token id in the byte order used by SLP messages
+type TokenID [32]byte
+
+// NewTokenID creates a TokenID from a 32 byte slice
+func NewTokenID(b []byte) (TokenID, error) {
+	var id TokenID
+	if len(b) != len(id) {
+		return id, errors.New("token id must be 32 bytes")
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+// TokenIDFromString parses a hex encoded token id
+func TokenIDFromString(s string) (TokenID, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return TokenID{}, err
+	}
+	return NewTokenID(b)
+}
+
+// String returns the hex encoded token id
+func (id TokenID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// TokenUtxo is an unspent output carrying a valid token amount or baton
+type TokenUtxo struct {
+	TokenID     TokenID
+	TokenType   v1parser.TokenType
+	Amount      uint64
+	IsMintBaton bool
+	Value       int64
+	PkScript    []byte
+	Height      int32
+}
+
+// SpentToken is a token output consumed by a transaction input
+type SpentToken struct {
+	OutPoint wire.OutPoint
+	Utxo     *TokenUtxo
+}
+
+// UtxoLookup returns the token output at op, or nil when op carries no
+// valid tokens
+type UtxoLookup func(op wire.OutPoint) *TokenUtxo
+
+// TxResult is the outcome of applying the SLP rules to a transaction
+type TxResult struct {
+	TxHash chainhash.Hash
+
+	// SlpMsg is the parsed OP_RETURN, nil for non-SLP transactions
+	SlpMsg v1parser.ParseResult
+
+	// TokenID is the token of SlpMsg
+	TokenID TokenID
+
+	Valid         bool
+	InvalidReason string
+
+	// Spent holds the token outputs consumed by the inputs, in input order
+	Spent []*SpentToken
+
+	// Outputs has one entry per transaction output, nil when an output
+	// carries no tokens
+	Outputs []*TokenUtxo
+}
+
+// IsSlp returns true when the transaction has a parsable SLP message
+func (r *TxResult) IsSlp() bool {
+	return r.SlpMsg != nil
+}
+
+// ApplyTx checks tx against the SLP rules using lookup to resolve the token
+// outputs spent by its inputs. The returned outputs are only populated for
+// valid SLP transactions; every spent token output not carried forward is
+// burned.
+func ApplyTx(tx *wire.MsgTx, height int32, lookup UtxoLookup) *TxResult {
+	res := &TxResult{
+		TxHash:  tx.TxHash(),
+		Outputs: make([]*TokenUtxo, len(tx.TxOut)),
+	}
+	for _, in := range tx.TxIn {
+		if u := lookup(in.PreviousOutPoint); u != nil {
+			res.Spent = append(res.Spent, &SpentToken{OutPoint: in.PreviousOutPoint, Utxo: u})
+		}
+	}
+
+	outputs, slpMsg, err := goslp.GetTokenOutputs(tx)
+	if err != nil || slpMsg == nil {
+		return res
+	}
+	res.SlpMsg = slpMsg
+	id, err := goslp.GetSlpTokenID(tx)
+	if err != nil {
+		res.InvalidReason = err.Error()
+		return res
+	}
+	tokenID, err := NewTokenID(id)
+	if err != nil {
+		res.InvalidReason = err.Error()
+		return res
+	}
+	res.TokenID = tokenID
+
+	if reason := checkInputs(tx, lookup, res, slpMsg); reason != "" {
+		res.InvalidReason = reason
+		return res
+	}
+
+	res.Valid = true
+	for vout, out := range outputs {
+		if out == nil {
+			continue
+		}
+		res.Outputs[vout] = &TokenUtxo{
+			TokenID:     tokenID,
+			TokenType:   out.TokenType,
+			Amount:      out.Amount,
+			IsMintBaton: out.IsMintBaton,
+			Value:       tx.TxOut[vout].Value,
+			PkScript:    tx.TxOut[vout].PkScript,
+			Height:      height,
+		}
+	}
+	return res
+}
+
+// checkInputs returns a reason when the inputs of tx do not satisfy slpMsg
+func checkInputs(tx *wire.MsgTx, lookup UtxoLookup, res *TxResult, slpMsg v1parser.ParseResult) string {
+	switch msg := slpMsg.(type) {
+	case *v1parser.SlpGenesis:
+		if msg.TokenType() != v1parser.TokenTypeNft1Child41 {
+			return ""
+		}
+		if len(tx.TxIn) == 0 {
+			return "nft1 child genesis has no inputs"
+		}
+		u := lookup(tx.TxIn[0].PreviousOutPoint)
+		if u == nil || u.TokenType != v1parser.TokenTypeNft1Group81 || u.IsMintBaton || u.Amount == 0 {
+			return "nft1 child genesis input 0 is not an nft1 group token"
+		}
+		return ""
+
+	case *v1parser.SlpMint:
+		for _, s := range res.Spent {
+			if s.Utxo.IsMintBaton && s.Utxo.TokenID == res.TokenID && s.Utxo.TokenType == msg.TokenType() {
+				return ""
+			}
+		}
+		return "mint has no valid baton input"
+
+	case *v1parser.SlpSend:
+		in := new(big.Int)
+		for _, s := range res.Spent {
+			if s.Utxo.IsMintBaton || s.Utxo.TokenID != res.TokenID || s.Utxo.TokenType != msg.TokenType() {
+				continue
+			}
+			in.Add(in, new(big.Int).SetUint64(s.Utxo.Amount))
+		}
+		out, err := msg.TotalSlpMsgOutputValue()
+		if err != nil {
+			return err.Error()
+		}
+		if out.Cmp(in) > 0 {
+			return "send outputs exceed valid token inputs"
+		}
+		return ""
+	}
+	return "unknown slp transaction type"
+}
+
+// sortTxs orders block transactions so parents precede children, which
+// canonical transaction ordering does not guarantee.
+func sortTxs(txs []*wire.MsgTx) []*wire.MsgTx {
+	index := make(map[chainhash.Hash]int, len(txs))
+	for i, tx := range txs {
+		index[tx.TxHash()] = i
+	}
+
+	sorted := make([]*wire.MsgTx, 0, len(txs))
+	visited := make([]bool, len(txs))
+	var visit func(i int)
+	visit = func(i int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		for _, in := range txs[i].TxIn {
+			if j, ok := index[in.PreviousOutPoint.Hash]; ok {
+				visit(j)
+			}
+		}
+		sorted = append(sorted, txs[i])
+	}
+	for i := range txs {
+		visit(i)
+	}
+	return sorted
+}
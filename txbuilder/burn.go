@@ -0,0 +1,161 @@
+package txbuilder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+// ErrUnintendedBurn is returned by CheckBurn when the tokens destroyed by a
+// transaction differ from the intended burn amount.
+var ErrUnintendedBurn = errors.New("transaction burns a different amount than intended")
+
+// BurnParams describes a SEND that intentionally destroys tokens. Every
+// token utxo must carry TokenID and hold tokens, mint batons are rejected.
+type BurnParams struct {
+	TokenType      int
+	TokenID        []byte
+	TokenUtxos     []*Utxo
+	FeeUtxos       []*Utxo
+	BurnAmount     uint64
+	ChangePkScript []byte
+	FeeRate        int64
+	DustValue      int64
+}
+
+// BurnResult is an unsigned burn transaction and the amount it destroys.
+type BurnResult struct {
+	Tx         *wire.MsgTx
+	Inputs     []*Utxo
+	BurnAmount uint64
+}
+
+// Burn creates an unsigned SEND spending p.TokenUtxos that returns all but
+// p.BurnAmount tokens to p.ChangePkScript. The result passes CheckBurn.
+func Burn(p *BurnParams) (*BurnResult, error) {
+	if p.BurnAmount == 0 {
+		return nil, errors.New("burn amount must be greater than 0")
+	}
+	if len(p.TokenUtxos) == 0 {
+		return nil, errors.New("burn requires at least one token input")
+	}
+	if len(p.ChangePkScript) == 0 {
+		return nil, errors.New("change pkScript is required")
+	}
+	if err := checkTokenUtxos(p.TokenUtxos, p.TokenID); err != nil {
+		return nil, err
+	}
+	if err := checkFeeUtxos(p.FeeUtxos); err != nil {
+		return nil, err
+	}
+
+	feeRate := p.FeeRate
+	if feeRate == 0 {
+		feeRate = DefaultFeeRate
+	}
+	dust := p.DustValue
+	if dust == 0 {
+		dust = DustLimit
+	}
+
+	tokensIn, err := sumTokens(p.TokenUtxos)
+	if err != nil {
+		return nil, err
+	}
+	if tokensIn < p.BurnAmount {
+		return nil, ErrInsufficientTokens
+	}
+
+	// a SEND needs at least one amount, so burning everything sends 0 to
+	// the change output
+	slpMsg, err := metadatamaker.CreateOpReturnSend(p.TokenType, p.TokenID, []uint64{tokensIn - p.BurnAmount})
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := append(append([]*Utxo{}, p.TokenUtxos...), p.FeeUtxos...)
+	tx := newTx(inputs, slpMsg)
+	tx.AddTxOut(wire.NewTxOut(0, p.ChangePkScript))
+
+	fee := int64(EstimateSize(tx)) * feeRate
+	change := sumValues(inputs) - fee
+	if change < dust {
+		return nil, ErrInsufficientFunds
+	}
+	tx.TxOut[1].Value = change
+
+	if err := CheckBurn(tx, inputs, p.BurnAmount); err != nil {
+		return nil, err
+	}
+	return &BurnResult{Tx: tx, Inputs: inputs, BurnAmount: p.BurnAmount}, nil
+}
+
+// CheckBurn verifies that tx destroys exactly intendedBurn of the token it
+// sends. Amounts assigned to outputs that do not exist count as burned, as
+// does every input token when tx is not a valid SEND. Inputs of any other
+// token and mint batons are always destroyed and fail the check with
+// ErrUnintendedBurn, so every input carrying tokens or a baton must set
+// TokenID.
+func CheckBurn(tx *wire.MsgTx, inputs []*Utxo, intendedBurn uint64) error {
+	var send *v1parser.SlpSend
+	if len(tx.TxOut) > 0 {
+		slpMsg, err := v1parser.ParseSLP(tx.TxOut[0].PkScript)
+		if s, ok := slpMsg.(*v1parser.SlpSend); err == nil && ok {
+			send = s
+		}
+	}
+
+	// without a SEND the burned token is the one the inputs carry
+	var tokenID []byte
+	if send != nil {
+		tokenID = send.TokenID()
+	}
+	var tokenInputs []*Utxo
+	for _, u := range inputs {
+		if u.TokenID == nil {
+			if u.TokenAmount != 0 {
+				return fmt.Errorf("token input %v has no token id", u.OutPoint)
+			}
+			continue
+		}
+		if tokenID == nil {
+			tokenID = u.TokenID
+		}
+		if !bytes.Equal(u.TokenID, tokenID) {
+			return fmt.Errorf("%w: input %v of token %x holding %d is destroyed", ErrUnintendedBurn, u.OutPoint, u.TokenID, u.TokenAmount)
+		}
+		if u.TokenAmount == 0 {
+			return fmt.Errorf("%w: input %v is the mint baton of token %x and is destroyed", ErrUnintendedBurn, u.OutPoint, u.TokenID)
+		}
+		tokenInputs = append(tokenInputs, u)
+	}
+	tokensIn, err := sumTokens(tokenInputs)
+	if err != nil {
+		return err
+	}
+
+	var tokensOut uint64
+	if send != nil {
+		for i, amt := range send.Amounts {
+			if i+1 >= len(tx.TxOut) {
+				break
+			}
+			if tokensOut+amt < tokensOut {
+				return errors.New("token output amount overflow")
+			}
+			tokensOut += amt
+		}
+	}
+
+	if tokensOut > tokensIn {
+		return fmt.Errorf("outputs total %d exceeds inputs total %d", tokensOut, tokensIn)
+	}
+	if burned := tokensIn - tokensOut; burned != intendedBurn {
+		return fmt.Errorf("%w: burns %d, intended %d", ErrUnintendedBurn, burned, intendedBurn)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package txbuilder
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+func TestBurn(t *testing.T) {
+	res, err := Burn(&BurnParams{
+		TokenType:      0x01,
+		TokenID:        make([]byte, 32),
+		TokenUtxos:     []*Utxo{testUtxo(1, 1, DustLimit, 60), testUtxo(1, 2, DustLimit, 40)},
+		FeeUtxos:       []*Utxo{testUtxo(2, 0, 10000, 0)},
+		BurnAmount:     25,
+		ChangePkScript: testPkScript(0xff),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.BurnAmount != 25 {
+		t.Errorf("unexpected burn amount %d", res.BurnAmount)
+	}
+	slpMsg, err := v1parser.ParseSLP(res.Tx.TxOut[0].PkScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amounts := slpMsg.(*v1parser.SlpSend).Amounts; len(amounts) != 1 || amounts[0] != 75 {
+		t.Errorf("unexpected send amounts %v", amounts)
+	}
+
+	if err := CheckBurn(res.Tx, res.Inputs, 24); !errors.Is(err, ErrUnintendedBurn) {
+		t.Errorf("expected ErrUnintendedBurn, got %v", err)
+	}
+}
+
+func TestBurnAll(t *testing.T) {
+	res, err := Burn(&BurnParams{
+		TokenType:      0x01,
+		TokenID:        make([]byte, 32),
+		TokenUtxos:     []*Utxo{testUtxo(1, 1, 10000, 100)},
+		BurnAmount:     100,
+		ChangePkScript: testPkScript(0xff),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckBurn(res.Tx, res.Inputs, 100); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBurnInsufficientTokens(t *testing.T) {
+	_, err := Burn(&BurnParams{
+		TokenType:      0x01,
+		TokenID:        make([]byte, 32),
+		TokenUtxos:     []*Utxo{testUtxo(1, 1, 10000, 10)},
+		BurnAmount:     11,
+		ChangePkScript: testPkScript(0xff),
+	})
+	if err != ErrInsufficientTokens {
+		t.Fatalf("expected ErrInsufficientTokens, got %v", err)
+	}
+}
+
+func TestCheckBurnMissingOutputs(t *testing.T) {
+	plan, err := PlanDistribution(&DistributionParams{
+		TokenType:      0x01,
+		TokenID:        make([]byte, 32),
+		TokenUtxos:     []*Utxo{testUtxo(1, 1, 100000, 100)},
+		Recipients:     testRecipients(3, 10),
+		ChangePkScript: testPkScript(0xff),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := plan.Steps[0]
+	if err := CheckBurn(step.Tx, step.Inputs, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// dropping the change output burns the token change
+	step.Tx.TxOut = step.Tx.TxOut[:len(step.Tx.TxOut)-1]
+	if err := CheckBurn(step.Tx, step.Inputs, 70); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckBurnOtherToken(t *testing.T) {
+	res, err := Burn(&BurnParams{
+		TokenType:      0x01,
+		TokenID:        make([]byte, 32),
+		TokenUtxos:     []*Utxo{testUtxo(1, 1, 10000, 100)},
+		BurnAmount:     10,
+		ChangePkScript: testPkScript(0xff),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an input of another token is destroyed by the send
+	other := testUtxo(3, 0, DustLimit, 5)
+	other.TokenID = bytes.Repeat([]byte{1}, 32)
+	if err := CheckBurn(res.Tx, append(res.Inputs, other), 10); !errors.Is(err, ErrUnintendedBurn) {
+		t.Errorf("expected ErrUnintendedBurn, got %v", err)
+	}
+
+	unknown := testUtxo(3, 0, DustLimit, 5)
+	unknown.TokenID = nil
+	if err := CheckBurn(res.Tx, append(res.Inputs, unknown), 10); err == nil {
+		t.Error("expected error for a token input without token id")
+	}
+}
+
+func TestBurnBaton(t *testing.T) {
+	baton := testUtxo(2, 2, DustLimit, 0)
+	baton.TokenID = make([]byte, 32)
+	p := &BurnParams{
+		TokenType:      0x01,
+		TokenID:        make([]byte, 32),
+		TokenUtxos:     []*Utxo{testUtxo(1, 1, 10000, 100), baton},
+		BurnAmount:     10,
+		ChangePkScript: testPkScript(0xff),
+	}
+	if _, err := Burn(p); !errors.Is(err, ErrBatonUtxo) {
+		t.Fatalf("expected ErrBatonUtxo, got %v", err)
+	}
+
+	// a baton of the same token spent by a send is destroyed
+	p.TokenUtxos = p.TokenUtxos[:1]
+	res, err := Burn(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckBurn(res.Tx, append(res.Inputs, baton), 10); !errors.Is(err, ErrUnintendedBurn) {
+		t.Errorf("expected ErrUnintendedBurn, got %v", err)
+	}
+}
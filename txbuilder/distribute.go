@@ -0,0 +1,180 @@
+package txbuilder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+)
+
+// DistributionParams describes a token distribution to many recipients.
+// Every token utxo must carry TokenID and hold tokens, mint batons are
+// rejected.
+type DistributionParams struct {
+	TokenType      int
+	TokenID        []byte
+	TokenUtxos     []*Utxo
+	FeeUtxos       []*Utxo
+	Recipients     []*Recipient
+	ChangePkScript []byte
+	FeeRate        int64
+	DustValue      int64
+}
+
+// DistributionStep is a single SEND transaction of a distribution plan
+// together with the outputs it spends.
+type DistributionStep struct {
+	*Step
+	Recipients []*Recipient
+
+	// ChangeVout is the output index holding token and bch change.
+	ChangeVout int
+
+	tokenChange uint64
+}
+
+// DistributionPlan is a sequence of chained SEND transactions, each spending
+// the change output of the previous step.
+type DistributionPlan struct {
+	Steps []*DistributionStep
+
+	// TotalFee is the sum of estimated fees for all steps.
+	TotalFee int64
+
+	// TotalDust is the bch attached to recipient outputs.
+	TotalDust int64
+
+	// TotalCost is the total bch spent by the plan, excluding change.
+	TotalCost int64
+}
+
+// PlanDistribution splits a recipient list into chained SEND transactions
+// that each respect the SEND output and OP_RETURN size limits. The returned
+// transactions are unsigned; use Finalize to sign them in order.
+func PlanDistribution(p *DistributionParams) (*DistributionPlan, error) {
+	if len(p.TokenID) != 32 {
+		return nil, errors.New("tokenID must be 32 bytes")
+	}
+	if len(p.Recipients) == 0 {
+		return nil, errors.New("distribution requires at least one recipient")
+	}
+	if len(p.TokenUtxos) == 0 {
+		return nil, errors.New("distribution requires at least one token input")
+	}
+	if len(p.ChangePkScript) == 0 {
+		return nil, errors.New("change pkScript is required")
+	}
+	if err := checkTokenUtxos(p.TokenUtxos, p.TokenID); err != nil {
+		return nil, err
+	}
+	if err := checkFeeUtxos(p.FeeUtxos); err != nil {
+		return nil, err
+	}
+
+	feeRate := p.FeeRate
+	if feeRate == 0 {
+		feeRate = DefaultFeeRate
+	}
+	dust := p.DustValue
+	if dust == 0 {
+		dust = DustLimit
+	}
+
+	tokensIn, err := sumTokens(p.TokenUtxos)
+	if err != nil {
+		return nil, err
+	}
+	var tokensOut uint64
+	for _, r := range p.Recipients {
+		if tokensOut+r.Amount < tokensOut {
+			return nil, errors.New("recipient amount overflow")
+		}
+		tokensOut += r.Amount
+	}
+	if tokensOut > tokensIn {
+		return nil, ErrInsufficientTokens
+	}
+
+	// one output of every SEND is reserved for change
+	perTx := MaxSendOutputs - 1
+
+	plan := &DistributionPlan{}
+	inputs := append(append([]*Utxo{}, p.TokenUtxos...), p.FeeUtxos...)
+	tokenChange := tokensIn
+	var prev *DistributionStep
+
+	for start := 0; start < len(p.Recipients); start += perTx {
+		end := start + perTx
+		if end > len(p.Recipients) {
+			end = len(p.Recipients)
+		}
+		batch := p.Recipients[start:end]
+
+		amounts := make([]uint64, 0, len(batch)+1)
+		for _, r := range batch {
+			amounts = append(amounts, r.Amount)
+			tokenChange -= r.Amount
+		}
+
+		// the final step omits a zero token change amount, leaving the
+		// change output to carry only bch
+		last := end == len(p.Recipients)
+		if !last || tokenChange > 0 {
+			amounts = append(amounts, tokenChange)
+		}
+
+		slpMsg, err := metadatamaker.CreateOpReturnSend(p.TokenType, p.TokenID, amounts)
+		if err != nil {
+			return nil, err
+		}
+		if len(slpMsg) > MaxOpReturnSize {
+			return nil, fmt.Errorf("op_return size %d exceeds %d bytes", len(slpMsg), MaxOpReturnSize)
+		}
+
+		step := &DistributionStep{Step: &Step{}, Recipients: batch}
+		if prev == nil {
+			step.Tx = newTx(inputs, slpMsg)
+			step.Inputs = inputs
+		} else {
+			step.Tx = newTx(nil, slpMsg)
+			in := step.spend(prev.Step, uint32(prev.ChangeVout))
+			in.TokenID = p.TokenID
+			in.TokenAmount = prev.tokenChange
+		}
+		tx := step.Tx
+		for _, r := range batch {
+			tx.AddTxOut(wire.NewTxOut(dust, r.PkScript))
+		}
+		changeVout := len(tx.TxOut)
+		tx.AddTxOut(wire.NewTxOut(0, p.ChangePkScript))
+
+		fee := int64(EstimateSize(tx)) * feeRate
+		change := sumValues(step.Inputs) - dust*int64(len(batch)) - fee
+		if change < dust {
+			return nil, ErrInsufficientFunds
+		}
+		tx.TxOut[changeVout].Value = change
+
+		step.Fee = fee
+		step.ChangeVout = changeVout
+		step.tokenChange = tokenChange
+		plan.Steps = append(plan.Steps, step)
+		plan.TotalFee += fee
+		plan.TotalDust += dust * int64(len(batch))
+		prev = step
+	}
+
+	plan.TotalCost = plan.TotalFee + plan.TotalDust
+	return plan, nil
+}
+
+// Finalize signs each step in order using sign, relinking each step to the
+// signed txid of the step before it.
+func (p *DistributionPlan) Finalize(sign SignFunc) error {
+	steps := make([]*Step, len(p.Steps))
+	for i, step := range p.Steps {
+		steps[i] = step.Step
+	}
+	return signSteps(steps, sign)
+}
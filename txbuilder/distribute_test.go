@@ -0,0 +1,182 @@
+package txbuilder
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+func testPkScript(b byte) []byte {
+	script := []byte{0x76, 0xa9, 0x14}
+	script = append(script, bytes.Repeat([]byte{b}, 20)...)
+	return append(script, 0x88, 0xac)
+}
+
+// testUtxo creates an output carrying tokens of the zero token id when
+// tokens is not 0
+func testUtxo(b byte, index uint32, value int64, tokens uint64) *Utxo {
+	u := &Utxo{
+		OutPoint:    wire.OutPoint{Hash: chainhash.Hash{b}, Index: index},
+		Value:       value,
+		PkScript:    testPkScript(b),
+		TokenAmount: tokens,
+	}
+	if tokens != 0 {
+		u.TokenID = make([]byte, 32)
+	}
+	return u
+}
+
+func testRecipients(n int, amount uint64) []*Recipient {
+	recipients := make([]*Recipient, n)
+	for i := range recipients {
+		recipients[i] = &Recipient{PkScript: testPkScript(byte(i)), Amount: amount}
+	}
+	return recipients
+}
+
+func TestPlanDistribution(t *testing.T) {
+	plan, err := PlanDistribution(&DistributionParams{
+		TokenType:      0x01,
+		TokenID:        make([]byte, 32),
+		TokenUtxos:     []*Utxo{testUtxo(1, 1, DustLimit, 1000)},
+		FeeUtxos:       []*Utxo{testUtxo(2, 0, 100000, 0)},
+		Recipients:     testRecipients(40, 10),
+		ChangePkScript: testPkScript(0xff),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Steps) != 3 {
+		t.Fatalf("expected 3 steps, got %d", len(plan.Steps))
+	}
+
+	var sent uint64
+	for i, step := range plan.Steps {
+		slpMsg, err := v1parser.ParseSLP(step.Tx.TxOut[0].PkScript)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		send := slpMsg.(*v1parser.SlpSend)
+		for _, r := range step.Recipients {
+			sent += r.Amount
+		}
+		if i > 0 {
+			prev := plan.Steps[i-1]
+			want := wire.OutPoint{Hash: prev.Tx.TxHash(), Index: uint32(prev.ChangeVout)}
+			if step.Tx.TxIn[0].PreviousOutPoint != want {
+				t.Errorf("step %d does not spend previous change", i)
+			}
+		}
+		if i < len(plan.Steps)-1 && send.Amounts[step.ChangeVout-1] != 1000-sent {
+			t.Errorf("step %d has incorrect token change", i)
+		}
+	}
+	if sent != 400 {
+		t.Errorf("expected 400 tokens sent, got %d", sent)
+	}
+	if plan.TotalCost != plan.TotalFee+40*DustLimit {
+		t.Error("incorrect total cost")
+	}
+}
+
+func TestPlanDistributionInsufficientTokens(t *testing.T) {
+	_, err := PlanDistribution(&DistributionParams{
+		TokenType:      0x01,
+		TokenID:        make([]byte, 32),
+		TokenUtxos:     []*Utxo{testUtxo(1, 1, 100000, 5)},
+		Recipients:     testRecipients(2, 3),
+		ChangePkScript: testPkScript(0xff),
+	})
+	if err != ErrInsufficientTokens {
+		t.Fatalf("expected ErrInsufficientTokens, got %v", err)
+	}
+}
+
+func TestPlanDistributionInsufficientFunds(t *testing.T) {
+	_, err := PlanDistribution(&DistributionParams{
+		TokenType:      0x01,
+		TokenID:        make([]byte, 32),
+		TokenUtxos:     []*Utxo{testUtxo(1, 1, DustLimit, 100)},
+		Recipients:     testRecipients(5, 1),
+		ChangePkScript: testPkScript(0xff),
+	})
+	if err != ErrInsufficientFunds {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+}
+
+func TestPlanDistributionTokenFeeUtxo(t *testing.T) {
+	baton := testUtxo(3, 2, 100000, 0)
+	baton.TokenID = make([]byte, 32)
+	for _, fee := range []*Utxo{testUtxo(2, 1, 100000, 5), baton} {
+		_, err := PlanDistribution(&DistributionParams{
+			TokenType:      0x01,
+			TokenID:        make([]byte, 32),
+			TokenUtxos:     []*Utxo{testUtxo(1, 1, 100000, 100)},
+			FeeUtxos:       []*Utxo{fee},
+			Recipients:     testRecipients(2, 3),
+			ChangePkScript: testPkScript(0xff),
+		})
+		if !errors.Is(err, ErrTokenFeeUtxo) {
+			t.Fatalf("expected ErrTokenFeeUtxo for %v, got %v", fee.OutPoint, err)
+		}
+	}
+}
+
+func TestPlanDistributionTokenUtxos(t *testing.T) {
+	other := testUtxo(2, 1, 100000, 50)
+	other.TokenID = bytes.Repeat([]byte{0xee}, 32)
+	baton := testUtxo(3, 2, 100000, 0)
+	baton.TokenID = make([]byte, 32)
+	for _, tc := range []struct {
+		utxo *Utxo
+		err  error
+	}{
+		{other, ErrWrongTokenUtxo},
+		{baton, ErrBatonUtxo},
+	} {
+		_, err := PlanDistribution(&DistributionParams{
+			TokenType:      0x01,
+			TokenID:        make([]byte, 32),
+			TokenUtxos:     []*Utxo{testUtxo(1, 1, 100000, 100), tc.utxo},
+			Recipients:     testRecipients(2, 3),
+			ChangePkScript: testPkScript(0xff),
+		})
+		if !errors.Is(err, tc.err) {
+			t.Errorf("expected %v for %v, got %v", tc.err, tc.utxo.OutPoint, err)
+		}
+	}
+}
+
+func TestDistributionPlanFinalize(t *testing.T) {
+	plan, err := PlanDistribution(&DistributionParams{
+		TokenType:      0x01,
+		TokenID:        make([]byte, 32),
+		TokenUtxos:     []*Utxo{testUtxo(1, 1, 100000, 100)},
+		Recipients:     testRecipients(20, 1),
+		ChangePkScript: testPkScript(0xff),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = plan.Finalize(func(tx *wire.MsgTx, inputs []*Utxo) error {
+		for _, in := range tx.TxIn {
+			in.SignatureScript = []byte{0x51}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := plan.Steps[0].Tx.TxHash()
+	if plan.Steps[1].Tx.TxIn[0].PreviousOutPoint.Hash != first {
+		t.Error("second step was not relinked to the signed first step")
+	}
+}
@@ -0,0 +1,140 @@
+package txbuilder
+
+import (
+	"errors"
+
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+)
+
+// ErrBatonDestroyNotConfirmed is returned when a transaction would destroy
+// the mint baton without explicit confirmation.
+var ErrBatonDestroyNotConfirmed = errors.New("destroying the mint baton permanently fixes supply and must be confirmed")
+
+// MintParams describes a MINT transaction spending a mint baton.
+type MintParams struct {
+	TokenType int
+	TokenID   []byte
+	BatonUtxo *Utxo
+	FeeUtxos  []*Utxo
+	Quantity  uint64
+
+	// PkScript receives the minted tokens.
+	PkScript []byte
+
+	// BatonPkScript receives the mint baton, an empty value destroys it.
+	BatonPkScript []byte
+
+	ChangePkScript []byte
+	FeeRate        int64
+	DustValue      int64
+}
+
+// MintTo creates an unsigned transaction minting p.Quantity to p.PkScript
+// and keeping the mint baton at p.BatonPkScript.
+func MintTo(p *MintParams) (*wire.MsgTx, error) {
+	if p.Quantity == 0 {
+		return nil, errors.New("mint quantity must be greater than 0")
+	}
+	if len(p.PkScript) == 0 {
+		return nil, errors.New("mint pkScript is required")
+	}
+	if len(p.BatonPkScript) == 0 {
+		return nil, errors.New("baton pkScript is required")
+	}
+	return buildMint(p)
+}
+
+// TransferBaton creates an unsigned transaction moving the mint baton to
+// p.BatonPkScript without minting any tokens.
+func TransferBaton(p *MintParams) (*wire.MsgTx, error) {
+	if p.Quantity != 0 {
+		return nil, errors.New("baton transfer cannot mint tokens")
+	}
+	if len(p.BatonPkScript) == 0 {
+		return nil, errors.New("baton pkScript is required")
+	}
+	return buildMint(p)
+}
+
+// DestroyBaton creates an unsigned transaction spending the mint baton
+// without passing it on, permanently fixing the token supply. A final
+// p.Quantity may be minted in the same transaction. confirm must be true.
+func DestroyBaton(p *MintParams, confirm bool) (*wire.MsgTx, error) {
+	if !confirm {
+		return nil, ErrBatonDestroyNotConfirmed
+	}
+	if len(p.BatonPkScript) != 0 {
+		return nil, errors.New("baton pkScript must be empty to destroy the baton")
+	}
+	if p.Quantity > 0 && len(p.PkScript) == 0 {
+		return nil, errors.New("mint pkScript is required")
+	}
+	return buildMint(p)
+}
+
+// buildMint lays out a MINT transaction as the OP_RETURN, the minted tokens
+// at output 1 (or change when nothing is minted), the baton, then change.
+func buildMint(p *MintParams) (*wire.MsgTx, error) {
+	if p.TokenType == 0x41 {
+		return nil, errors.New("nft1 child tokens cannot be minted")
+	}
+	if p.BatonUtxo == nil {
+		return nil, errors.New("baton utxo is required")
+	}
+	if len(p.ChangePkScript) == 0 {
+		return nil, errors.New("change pkScript is required")
+	}
+	if err := checkFeeUtxos(p.FeeUtxos); err != nil {
+		return nil, err
+	}
+
+	feeRate := p.FeeRate
+	if feeRate == 0 {
+		feeRate = DefaultFeeRate
+	}
+	dust := p.DustValue
+	if dust == 0 {
+		dust = DustLimit
+	}
+
+	// output 1 holds the minted quantity, so when nothing is minted the
+	// change output takes its place
+	changeFirst := p.Quantity == 0
+
+	var baton *metadatamaker.MintBatonVout
+	if len(p.BatonPkScript) != 0 {
+		baton = metadatamaker.NewMintBatonVout(2)
+	}
+	slpMsg, err := metadatamaker.CreateOpReturnMint(p.TokenType, p.TokenID, baton, p.Quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := append([]*Utxo{p.BatonUtxo}, p.FeeUtxos...)
+	tx := newTx(inputs, slpMsg)
+	var spent int64
+	changeVout := 1
+	if changeFirst {
+		tx.AddTxOut(wire.NewTxOut(0, p.ChangePkScript))
+	} else {
+		tx.AddTxOut(wire.NewTxOut(dust, p.PkScript))
+		spent += dust
+	}
+	if baton != nil {
+		tx.AddTxOut(wire.NewTxOut(dust, p.BatonPkScript))
+		spent += dust
+	}
+	if !changeFirst {
+		changeVout = len(tx.TxOut)
+		tx.AddTxOut(wire.NewTxOut(0, p.ChangePkScript))
+	}
+
+	fee := int64(EstimateSize(tx)) * feeRate
+	change := sumValues(inputs) - spent - fee
+	if change < dust {
+		return nil, ErrInsufficientFunds
+	}
+	tx.TxOut[changeVout].Value = change
+	return tx, nil
+}
@@ -0,0 +1,114 @@
+package txbuilder
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+func testMintParams() *MintParams {
+	return &MintParams{
+		TokenType:      0x01,
+		TokenID:        make([]byte, 32),
+		BatonUtxo:      testUtxo(1, 2, DustLimit, 0),
+		FeeUtxos:       []*Utxo{testUtxo(2, 0, 10000, 0)},
+		PkScript:       testPkScript(3),
+		BatonPkScript:  testPkScript(4),
+		ChangePkScript: testPkScript(0xff),
+	}
+}
+
+func TestMintTo(t *testing.T) {
+	p := testMintParams()
+	p.Quantity = 1000
+	tx, err := MintTo(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slpMsg, err := v1parser.ParseSLP(tx.TxOut[0].PkScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mint := slpMsg.(*v1parser.SlpMint)
+	if mint.Qty != 1000 || mint.MintBatonVout != 2 {
+		t.Errorf("unexpected mint %+v", mint)
+	}
+	if !bytes.Equal(tx.TxOut[1].PkScript, p.PkScript) || !bytes.Equal(tx.TxOut[2].PkScript, p.BatonPkScript) {
+		t.Error("unexpected output layout")
+	}
+	if len(tx.TxIn) != 2 || len(tx.TxOut) != 4 {
+		t.Errorf("unexpected tx size %d inputs, %d outputs", len(tx.TxIn), len(tx.TxOut))
+	}
+}
+
+func TestTransferBaton(t *testing.T) {
+	tx, err := TransferBaton(testMintParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	slpMsg, err := v1parser.ParseSLP(tx.TxOut[0].PkScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mint := slpMsg.(*v1parser.SlpMint)
+	if mint.Qty != 0 || mint.MintBatonVout != 2 {
+		t.Errorf("unexpected mint %+v", mint)
+	}
+	if len(tx.TxOut) != 3 || !bytes.Equal(tx.TxOut[2].PkScript, testPkScript(4)) {
+		t.Error("baton was not sent to the baton pkScript")
+	}
+
+	p := testMintParams()
+	p.Quantity = 1
+	if _, err := TransferBaton(p); err == nil {
+		t.Error("expected error transferring baton with non-zero quantity")
+	}
+}
+
+func TestDestroyBaton(t *testing.T) {
+	p := testMintParams()
+	p.BatonPkScript = nil
+	if _, err := DestroyBaton(p, false); err != ErrBatonDestroyNotConfirmed {
+		t.Fatalf("expected ErrBatonDestroyNotConfirmed, got %v", err)
+	}
+
+	tx, err := DestroyBaton(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slpMsg, err := v1parser.ParseSLP(tx.TxOut[0].PkScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slpMsg.(*v1parser.SlpMint).MintBatonVout != 0 {
+		t.Error("baton was not destroyed")
+	}
+
+	// an empty baton pkScript destroys the baton like nil rather than
+	// sending it to an anyone-can-spend output
+	p.BatonPkScript = []byte{}
+	tx, err = DestroyBaton(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slpMsg, err = v1parser.ParseSLP(tx.TxOut[0].PkScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slpMsg.(*v1parser.SlpMint).MintBatonVout != 0 {
+		t.Error("baton was not destroyed")
+	}
+	if len(tx.TxOut) > 2 {
+		t.Errorf("expected no output 2, got %d outputs", len(tx.TxOut))
+	}
+}
+
+func TestMintNFT1Child(t *testing.T) {
+	p := testMintParams()
+	p.TokenType = 0x41
+	p.Quantity = 1
+	if _, err := MintTo(p); err == nil {
+		t.Error("expected error minting nft1 child")
+	}
+}
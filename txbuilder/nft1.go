@@ -0,0 +1,311 @@
+package txbuilder
+
+import (
+	"errors"
+
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+)
+
+// NFT1Child is the metadata and receiver of an NFT1 child to be created.
+type NFT1Child struct {
+	Ticker       []byte
+	Name         []byte
+	DocumentURI  []byte
+	DocumentHash []byte
+	PkScript     []byte
+}
+
+// NFT1ChildrenParams describes a batch of NFT1 children minted from a group.
+type NFT1ChildrenParams struct {
+	GroupTokenID []byte
+	GroupUtxos   []*Utxo
+	FeeUtxos     []*Utxo
+	Children     []*NFT1Child
+
+	// PkScript receives the intermediate group outputs consumed by each
+	// child genesis, it defaults to ChangePkScript.
+	PkScript       []byte
+	ChangePkScript []byte
+	FeeRate        int64
+	DustValue      int64
+}
+
+// NFT1ChildrenPlan holds the group fan-out transactions followed by one
+// child genesis transaction per child.
+type NFT1ChildrenPlan struct {
+	// FanOut splits the group tokens into outputs of quantity 1, parents
+	// are always ordered before the steps spending them.
+	FanOut []*Step
+
+	// Genesis holds the child genesis transactions in the same order as
+	// NFT1ChildrenParams.Children.
+	Genesis []*Step
+
+	TotalFee  int64
+	TotalCost int64
+}
+
+// nft1Builder carries state while building an NFT1ChildrenPlan.
+type nft1Builder struct {
+	p          *NFT1ChildrenParams
+	plan       *NFT1ChildrenPlan
+	pkScript   []byte
+	feeRate    int64
+	dust       int64
+	childValue []int64
+}
+
+// PlanNFT1Children builds the NFT1GroupSend transactions needed to prepare
+// one group output of quantity 1 per child, then an NFT1ChildGenesis
+// transaction spending each prepared output at input 0. When there are more
+// children than fit in one SEND the fan-out recurses through intermediate
+// outputs. All transactions are unsigned; use Finalize to sign them.
+func PlanNFT1Children(p *NFT1ChildrenParams) (*NFT1ChildrenPlan, error) {
+	if len(p.GroupTokenID) != 32 {
+		return nil, errors.New("group tokenID must be 32 bytes")
+	}
+	if len(p.Children) == 0 {
+		return nil, errors.New("at least one child is required")
+	}
+	if len(p.GroupUtxos) == 0 {
+		return nil, errors.New("at least one group token input is required")
+	}
+	if len(p.ChangePkScript) == 0 {
+		return nil, errors.New("change pkScript is required")
+	}
+	if err := checkFeeUtxos(p.FeeUtxos); err != nil {
+		return nil, err
+	}
+
+	b := &nft1Builder{
+		p:        p,
+		plan:     &NFT1ChildrenPlan{},
+		pkScript: p.PkScript,
+		feeRate:  p.FeeRate,
+		dust:     p.DustValue,
+	}
+	if b.pkScript == nil {
+		b.pkScript = p.ChangePkScript
+	}
+	if b.feeRate == 0 {
+		b.feeRate = DefaultFeeRate
+	}
+	if b.dust == 0 {
+		b.dust = DustLimit
+	}
+
+	tokensIn, err := sumTokens(p.GroupUtxos)
+	if err != nil {
+		return nil, err
+	}
+	count := uint64(len(p.Children))
+	if tokensIn < count {
+		return nil, ErrInsufficientTokens
+	}
+
+	// each prepared output carries exactly what its child genesis needs
+	b.childValue = make([]int64, len(p.Children))
+	b.plan.Genesis = make([]*Step, len(p.Children))
+	for i, child := range p.Children {
+		tx, err := b.childGenesisTx(child)
+		if err != nil {
+			return nil, err
+		}
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil))
+		b.childValue[i] = b.dust + int64(EstimateSize(tx))*b.feeRate
+	}
+
+	// the root transaction reserves one output for change
+	nodes := b.split(0, len(p.Children), MaxSendOutputs-1)
+	amounts := make([]uint64, 0, len(nodes)+1)
+	for _, n := range nodes {
+		amounts = append(amounts, uint64(n.hi-n.lo))
+	}
+	if tokenChange := tokensIn - count; tokenChange > 0 {
+		amounts = append(amounts, tokenChange)
+	}
+	slpMsg, err := metadatamaker.NFT1GroupSend(p.GroupTokenID, amounts)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := append(append([]*Utxo{}, p.GroupUtxos...), p.FeeUtxos...)
+	root := &Step{Tx: newTx(inputs, slpMsg), Inputs: inputs}
+	var spent int64
+	for _, n := range nodes {
+		value, err := b.cost(n)
+		if err != nil {
+			return nil, err
+		}
+		root.Tx.AddTxOut(wire.NewTxOut(value, b.pkScript))
+		spent += value
+	}
+	root.Tx.AddTxOut(wire.NewTxOut(0, p.ChangePkScript))
+	root.Fee = int64(EstimateSize(root.Tx)) * b.feeRate
+	change := sumValues(inputs) - spent - root.Fee
+	if change < b.dust {
+		return nil, ErrInsufficientFunds
+	}
+	root.Tx.TxOut[len(root.Tx.TxOut)-1].Value = change
+	b.addFanOut(root)
+
+	if err := b.build(root, nodes); err != nil {
+		return nil, err
+	}
+	b.plan.TotalCost = sumValues(inputs) - change
+	return b.plan, nil
+}
+
+// Finalize signs the fan-out transactions followed by the child genesis
+// transactions, relinking each to the signed txids of its parents.
+func (p *NFT1ChildrenPlan) Finalize(sign SignFunc) error {
+	steps := append(append([]*Step{}, p.FanOut...), p.Genesis...)
+	return signSteps(steps, sign)
+}
+
+// fanNode is a contiguous range of children served by a single output.
+type fanNode struct {
+	lo, hi int
+}
+
+// split divides children [lo, hi) into at most capacity nodes, each small
+// enough to be fanned out by a subtree of full SEND transactions.
+func (b *nft1Builder) split(lo, hi, capacity int) []fanNode {
+	size := 1
+	for (hi-lo+size-1)/size > capacity {
+		size *= MaxSendOutputs
+	}
+	nodes := make([]fanNode, 0, capacity)
+	for i := lo; i < hi; i += size {
+		end := i + size
+		if end > hi {
+			end = hi
+		}
+		nodes = append(nodes, fanNode{lo: i, hi: end})
+	}
+	return nodes
+}
+
+// cost returns the bch an output must carry to fund node and all the
+// transactions below it.
+func (b *nft1Builder) cost(n fanNode) (int64, error) {
+	if n.hi-n.lo == 1 {
+		return b.childValue[n.lo], nil
+	}
+	tx, children, err := b.fanOutTx(n)
+	if err != nil {
+		return 0, err
+	}
+	total := int64(EstimateSize(tx)) * b.feeRate
+	for _, c := range children {
+		v, err := b.cost(c)
+		if err != nil {
+			return 0, err
+		}
+		total += v
+	}
+	return total, nil
+}
+
+// fanOutTx creates a transaction without inputs splitting node n into its
+// child nodes. Output values are left at zero.
+func (b *nft1Builder) fanOutTx(n fanNode) (*wire.MsgTx, []fanNode, error) {
+	children := b.split(n.lo, n.hi, MaxSendOutputs)
+	amounts := make([]uint64, len(children))
+	for i, c := range children {
+		amounts[i] = uint64(c.hi - c.lo)
+	}
+	slpMsg, err := metadatamaker.NFT1GroupSend(b.p.GroupTokenID, amounts)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx := newTx(nil, slpMsg)
+	for range children {
+		tx.AddTxOut(wire.NewTxOut(0, b.pkScript))
+	}
+	// account for the single input when estimating size
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil))
+	return tx, children, nil
+}
+
+// build creates the steps spending each of parent's node outputs, which
+// start at output 1.
+func (b *nft1Builder) build(parent *Step, nodes []fanNode) error {
+	for i, n := range nodes {
+		vout := uint32(i + 1)
+		if n.hi-n.lo == 1 {
+			if err := b.buildGenesis(parent, vout, n.lo); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tx, children, err := b.fanOutTx(n)
+		if err != nil {
+			return err
+		}
+		tx.TxIn = nil
+		for j, c := range children {
+			value, err := b.cost(c)
+			if err != nil {
+				return err
+			}
+			tx.TxOut[j+1].Value = value
+		}
+		step := &Step{Tx: tx}
+		in := step.spend(parent, vout)
+		in.TokenID = b.p.GroupTokenID
+		in.TokenAmount = uint64(n.hi - n.lo)
+		step.Fee = int64(EstimateSize(tx)) * b.feeRate
+		b.addFanOut(step)
+
+		if err := b.build(step, children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildGenesis creates the genesis step for child i spending the prepared
+// output vout of parent.
+func (b *nft1Builder) buildGenesis(parent *Step, vout uint32, i int) error {
+	tx, err := b.childGenesisTx(b.p.Children[i])
+	if err != nil {
+		return err
+	}
+	step := &Step{Tx: tx}
+	in := step.spend(parent, vout)
+	in.TokenID = b.p.GroupTokenID
+	in.TokenAmount = 1
+	step.Fee = b.childValue[i] - b.dust
+	b.plan.Genesis[i] = step
+	b.plan.TotalFee += step.Fee
+	return nil
+}
+
+// childGenesisTx creates a child genesis transaction without inputs.
+func (b *nft1Builder) childGenesisTx(child *NFT1Child) (*wire.MsgTx, error) {
+	if len(child.PkScript) == 0 {
+		return nil, errors.New("child pkScript is required")
+	}
+	slpMsg, err := metadatamaker.NFT1ChildGenesis(
+		child.Ticker,
+		child.Name,
+		child.DocumentURI,
+		child.DocumentHash,
+		0,
+		1,
+	)
+	if err != nil {
+		return nil, err
+	}
+	tx := newTx(nil, slpMsg)
+	tx.AddTxOut(wire.NewTxOut(b.dust, child.PkScript))
+	return tx, nil
+}
+
+func (b *nft1Builder) addFanOut(step *Step) {
+	b.plan.FanOut = append(b.plan.FanOut, step)
+	b.plan.TotalFee += step.Fee
+}
@@ -0,0 +1,141 @@
+package txbuilder
+
+import (
+	"testing"
+
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+func testChildren(n int) []*NFT1Child {
+	children := make([]*NFT1Child, n)
+	for i := range children {
+		children[i] = &NFT1Child{
+			Ticker:   []byte("NFT"),
+			Name:     []byte("child"),
+			PkScript: testPkScript(byte(i)),
+		}
+	}
+	return children
+}
+
+func TestPlanNFT1ChildrenSingleFanOut(t *testing.T) {
+	plan, err := PlanNFT1Children(&NFT1ChildrenParams{
+		GroupTokenID:   make([]byte, 32),
+		GroupUtxos:     []*Utxo{testUtxo(1, 1, DustLimit, 10)},
+		FeeUtxos:       []*Utxo{testUtxo(2, 0, 100000, 0)},
+		Children:       testChildren(5),
+		ChangePkScript: testPkScript(0xff),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.FanOut) != 1 || len(plan.Genesis) != 5 {
+		t.Fatalf("unexpected plan size %d fan-out, %d genesis", len(plan.FanOut), len(plan.Genesis))
+	}
+
+	slpMsg, err := v1parser.ParseSLP(plan.FanOut[0].Tx.TxOut[0].PkScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := slpMsg.(*v1parser.SlpSend)
+	if len(send.Amounts) != 6 || send.Amounts[5] != 5 {
+		t.Errorf("unexpected group send amounts %v", send.Amounts)
+	}
+}
+
+func TestPlanNFT1ChildrenRecursive(t *testing.T) {
+	plan, err := PlanNFT1Children(&NFT1ChildrenParams{
+		GroupTokenID:   make([]byte, 32),
+		GroupUtxos:     []*Utxo{testUtxo(1, 1, DustLimit, 400)},
+		FeeUtxos:       []*Utxo{testUtxo(2, 0, 10000000, 0)},
+		Children:       testChildren(400),
+		ChangePkScript: testPkScript(0xff),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, step := range plan.FanOut {
+		slpMsg, err := v1parser.ParseSLP(step.Tx.TxOut[0].PkScript)
+		if err != nil {
+			t.Fatalf("fan-out %d: %v", i, err)
+		}
+		if slpMsg.TokenType() != v1parser.TokenTypeNft1Group81 {
+			t.Errorf("fan-out %d is not a group send", i)
+		}
+		if i == 0 {
+			continue
+		}
+
+		total, _ := slpMsg.TotalSlpMsgOutputValue()
+		if total.Uint64() != step.Inputs[0].TokenAmount {
+			t.Errorf("fan-out %d does not spend all of its group tokens", i)
+		}
+		var out int64
+		for _, o := range step.Tx.TxOut {
+			out += o.Value
+		}
+		if out+step.Fee != step.Inputs[0].Value {
+			t.Errorf("fan-out %d does not balance", i)
+		}
+	}
+
+	for i, step := range plan.Genesis {
+		if step == nil {
+			t.Fatalf("missing genesis for child %d", i)
+		}
+		slpMsg, err := v1parser.ParseSLP(step.Tx.TxOut[0].PkScript)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slpMsg.TokenType() != v1parser.TokenTypeNft1Child41 {
+			t.Errorf("genesis %d is not an nft1 child", i)
+		}
+		if step.Inputs[0].TokenAmount != 1 || step.Inputs[0].Value != DustLimit+step.Fee {
+			t.Errorf("genesis %d input is not a prepared output", i)
+		}
+	}
+}
+
+func TestNFT1ChildrenPlanFinalize(t *testing.T) {
+	plan, err := PlanNFT1Children(&NFT1ChildrenParams{
+		GroupTokenID:   make([]byte, 32),
+		GroupUtxos:     []*Utxo{testUtxo(1, 1, 1000000, 40)},
+		Children:       testChildren(40),
+		ChangePkScript: testPkScript(0xff),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := make(map[wire.OutPoint]bool)
+	err = plan.Finalize(func(tx *wire.MsgTx, inputs []*Utxo) error {
+		for _, in := range tx.TxIn {
+			if in.PreviousOutPoint.Hash[0] != 1 && !signed[in.PreviousOutPoint] {
+				t.Errorf("input spends an unsigned output")
+			}
+			in.SignatureScript = []byte{0x51}
+		}
+		hash := tx.TxHash()
+		for i := range tx.TxOut {
+			signed[wire.OutPoint{Hash: hash, Index: uint32(i)}] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlanNFT1ChildrenInsufficientTokens(t *testing.T) {
+	_, err := PlanNFT1Children(&NFT1ChildrenParams{
+		GroupTokenID:   make([]byte, 32),
+		GroupUtxos:     []*Utxo{testUtxo(1, 1, 1000000, 2)},
+		Children:       testChildren(3),
+		ChangePkScript: testPkScript(0xff),
+	})
+	if err != ErrInsufficientTokens {
+		t.Fatalf("expected ErrInsufficientTokens, got %v", err)
+	}
+}
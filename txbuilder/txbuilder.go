@@ -0,0 +1,196 @@
+package txbuilder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+const (
+	// MaxSendOutputs is the maximum number of token outputs a single SEND
+	// message can describe.
+	MaxSendOutputs = v1parser.MaxSendOutputs
+
+	// MaxOpReturnSize is the largest OP_RETURN scriptPubKey relayed by
+	// default policy.
+	MaxOpReturnSize = 223
+
+	// DustLimit is the default satoshi value attached to token outputs.
+	DustLimit int64 = 546
+
+	// DefaultFeeRate is the default fee rate in satoshis per byte.
+	DefaultFeeRate int64 = 1
+
+	// p2pkhInputSize is the estimated size of a signed P2PKH input.
+	p2pkhInputSize = 148
+
+	// txOverheadSize is the size of version, locktime and the in/out counts
+	// for transactions with fewer than 253 inputs and outputs.
+	txOverheadSize = 10
+)
+
+var (
+	// ErrInsufficientTokens is returned when the token inputs cannot cover
+	// the requested token outputs.
+	ErrInsufficientTokens = errors.New("insufficient token inputs")
+
+	// ErrInsufficientFunds is returned when the inputs cannot cover the dust
+	// outputs and the transaction fee.
+	ErrInsufficientFunds = errors.New("insufficient bch for outputs and fee")
+
+	// ErrTokenFeeUtxo is returned when a fee input holds tokens or a mint
+	// baton, which the transaction would destroy.
+	ErrTokenFeeUtxo = errors.New("fee utxo holds tokens")
+
+	// ErrWrongTokenUtxo is returned when a token input carries another
+	// token than the one being sent.
+	ErrWrongTokenUtxo = errors.New("token utxo holds another token")
+
+	// ErrBatonUtxo is returned when a token input is a mint baton, which a
+	// SEND would destroy.
+	ErrBatonUtxo = errors.New("token utxo is a mint baton")
+)
+
+// Utxo is a spendable output along with its token amount, if any.
+type Utxo struct {
+	OutPoint wire.OutPoint
+	Value    int64
+	PkScript []byte
+
+	// TokenID is the token carried by the output in SLP message byte
+	// order, nil for outputs without tokens. Mint batons carry their token
+	// id with a zero TokenAmount.
+	TokenID     []byte
+	TokenAmount uint64
+}
+
+// Recipient is a token output to be created by a transaction.
+type Recipient struct {
+	PkScript []byte
+	Amount   uint64
+}
+
+// SignFunc signs every input of tx, inputs are the outputs being spent in
+// input order.
+type SignFunc func(tx *wire.MsgTx, inputs []*Utxo) error
+
+// Step is an unsigned transaction belonging to a multi-transaction plan.
+type Step struct {
+	Tx     *wire.MsgTx
+	Inputs []*Utxo
+	Fee    int64
+
+	// links are inputs spending outputs of earlier steps in the same plan
+	links []link
+}
+
+// link records that an input of a step spends an output of parent.
+type link struct {
+	input  int
+	parent *Step
+	vout   uint32
+}
+
+// spend adds an input spending output vout of parent, returning the utxo
+// for that output.
+func (s *Step) spend(parent *Step, vout uint32) *Utxo {
+	out := parent.Tx.TxOut[vout]
+	u := &Utxo{
+		OutPoint: wire.OutPoint{Hash: parent.Tx.TxHash(), Index: vout},
+		Value:    out.Value,
+		PkScript: out.PkScript,
+	}
+	s.links = append(s.links, link{input: len(s.Inputs), parent: parent, vout: vout})
+	s.Inputs = append(s.Inputs, u)
+	op := u.OutPoint
+	s.Tx.AddTxIn(wire.NewTxIn(&op, nil))
+	return u
+}
+
+// signSteps signs steps in order. Since signing changes the txid of a step,
+// inputs spending earlier steps are relinked to the signed txid first, so
+// steps must be ordered with parents before children.
+func signSteps(steps []*Step, sign SignFunc) error {
+	for i, step := range steps {
+		for _, l := range step.links {
+			op := wire.OutPoint{Hash: l.parent.Tx.TxHash(), Index: l.vout}
+			step.Tx.TxIn[l.input].PreviousOutPoint = op
+			step.Inputs[l.input].OutPoint = op
+		}
+		if err := sign(step.Tx, step.Inputs); err != nil {
+			return fmt.Errorf("signing step %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// EstimateSize returns the estimated serialized size of a signed transaction
+// assuming all inputs are P2PKH.
+func EstimateSize(tx *wire.MsgTx) int {
+	size := txOverheadSize + len(tx.TxIn)*p2pkhInputSize
+	for _, out := range tx.TxOut {
+		size += out.SerializeSize()
+	}
+	return size
+}
+
+// sumTokens adds the token amounts of utxos, returning an error on overflow.
+func sumTokens(utxos []*Utxo) (uint64, error) {
+	var total uint64
+	for _, u := range utxos {
+		if total+u.TokenAmount < total {
+			return 0, errors.New("token input amount overflow")
+		}
+		total += u.TokenAmount
+	}
+	return total, nil
+}
+
+// checkFeeUtxos returns ErrTokenFeeUtxo when any of utxos holds tokens or a
+// mint baton.
+func checkFeeUtxos(utxos []*Utxo) error {
+	for _, u := range utxos {
+		if u.TokenID != nil || u.TokenAmount != 0 {
+			return fmt.Errorf("%w: %v", ErrTokenFeeUtxo, u.OutPoint)
+		}
+	}
+	return nil
+}
+
+// checkTokenUtxos returns ErrWrongTokenUtxo when any of utxos carries
+// another token than tokenID and ErrBatonUtxo when one is a mint baton.
+func checkTokenUtxos(utxos []*Utxo, tokenID []byte) error {
+	for _, u := range utxos {
+		if !bytes.Equal(u.TokenID, tokenID) {
+			return fmt.Errorf("%w: %v carries %x", ErrWrongTokenUtxo, u.OutPoint, u.TokenID)
+		}
+		if u.TokenAmount == 0 {
+			return fmt.Errorf("%w: %v", ErrBatonUtxo, u.OutPoint)
+		}
+	}
+	return nil
+}
+
+// sumValues adds the satoshi values of utxos.
+func sumValues(utxos []*Utxo) int64 {
+	var total int64
+	for _, u := range utxos {
+		total += u.Value
+	}
+	return total
+}
+
+// newTx creates an unsigned transaction spending utxos with the given
+// OP_RETURN message at output 0.
+func newTx(utxos []*Utxo, slpMsg []byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for _, u := range utxos {
+		op := u.OutPoint
+		tx.AddTxIn(wire.NewTxIn(&op, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, slpMsg))
+	return tx
+}
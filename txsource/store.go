@@ -0,0 +1,90 @@
+package txsource
+
+import (
+	"sync"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+)
+
+type storedTx struct {
+	tx     *wire.MsgTx
+	header *wire.BlockHeader
+	height int32
+}
+
+// Store is a Source keeping the token transactions of connected blocks
+// in memory. Plain BCH transactions are only kept when a token transaction
+// of the same block spends them, the inputs of other token transactions
+// spending them are described without their previous output.
+type Store struct {
+	mtx    sync.RWMutex
+	txs    map[chainhash.Hash]*storedTx
+	blocks map[chainhash.Hash][]chainhash.Hash
+}
+
+// NewStore creates an empty Store
+func NewStore() *Store {
+	return &Store{
+		txs:    make(map[chainhash.Hash]*storedTx),
+		blocks: make(map[chainhash.Hash][]chainhash.Hash),
+	}
+}
+
+// BlockConnected stores the transactions of a block connected to the index
+// that carry an SLP message or spend token outputs, along with the
+// transactions of the block they spend. results are the ones returned by
+// Index.ConnectBlock for the block.
+func (s *Store) BlockConnected(block *wire.MsgBlock, height int32, results []*tokenindex.TxResult) {
+	keep := make(map[chainhash.Hash]bool)
+	for _, res := range results {
+		if res.IsSlp() || len(res.Spent) > 0 {
+			keep[res.TxHash] = true
+		}
+	}
+	hashes := make([]chainhash.Hash, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		hashes[i] = tx.TxHash()
+		if !keep[hashes[i]] {
+			continue
+		}
+		for _, txIn := range tx.TxIn {
+			keep[txIn.PreviousOutPoint.Hash] = true
+		}
+	}
+
+	header := block.Header
+	var stored []chainhash.Hash
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for i, tx := range block.Transactions {
+		if keep[hashes[i]] {
+			s.txs[hashes[i]] = &storedTx{tx: tx, header: &header, height: height}
+			stored = append(stored, hashes[i])
+		}
+	}
+	s.blocks[header.BlockHash()] = stored
+}
+
+// BlockDisconnected removes the transactions of a block disconnected by
+// Index.DisconnectBlock or Index.Rewind
+func (s *Store) BlockDisconnected(undo *tokenindex.BlockUndo) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, hash := range s.blocks[undo.Hash] {
+		delete(s.txs, hash)
+	}
+	delete(s.blocks, undo.Hash)
+}
+
+// Tx implements Source
+func (s *Store) Tx(hash chainhash.Hash) (*wire.MsgTx, *wire.BlockHeader, int32, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	st, ok := s.txs[hash]
+	if !ok {
+		return nil, nil, 0, false
+	}
+	return st.tx, st.header, st.height, true
+}
@@ -0,0 +1,108 @@
+package txsource
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+)
+
+// testPkScript pays to a p2pkh address
+var testPkScript = append(append([]byte{0x76, 0xa9, 0x14}, bytes.Repeat([]byte{0x01}, 20)...), 0x88, 0xac)
+
+func testTx(slpMsg []byte, spends []wire.OutPoint, n int) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	for i := range spends {
+		tx.AddTxIn(wire.NewTxIn(&spends[i], nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, slpMsg))
+	for i := 0; i < n; i++ {
+		tx.AddTxOut(wire.NewTxOut(546, testPkScript))
+	}
+	return tx
+}
+
+func testBlock(txs ...*wire.MsgTx) *wire.MsgBlock {
+	block := wire.NewMsgBlock(wire.NewBlockHeader(1, &chainhash.Hash{}, &chainhash.Hash{}, 0, 0))
+	for _, tx := range txs {
+		block.AddTransaction(tx)
+	}
+	return block
+}
+
+func TestStoreKeepsTokenTxs(t *testing.T) {
+	genesisMsg, err := metadatamaker.CreateOpReturnGenesis(0x01, []byte("TST"), []byte("test"), nil, nil, 0, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funding := testTx([]byte{0x6a}, []wire.OutPoint{{Index: 7}}, 1)
+	genesis := testTx(genesisMsg, []wire.OutPoint{{Hash: funding.TxHash(), Index: 1}}, 1)
+	unrelated := testTx([]byte{0x6a}, []wire.OutPoint{{Index: 8}}, 1)
+
+	idx := tokenindex.New()
+	txs := NewStore()
+	block := testBlock(funding, genesis, unrelated)
+	results, err := idx.ConnectBlock(block, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs.BlockConnected(block, 0, results)
+
+	for _, tx := range []*wire.MsgTx{funding, genesis} {
+		if _, _, _, ok := txs.Tx(tx.TxHash()); !ok {
+			t.Errorf("expected %v to be stored", tx.TxHash())
+		}
+	}
+	if _, _, _, ok := txs.Tx(unrelated.TxHash()); ok {
+		t.Error("expected the unrelated transaction to be dropped")
+	}
+
+	undo, err := idx.DisconnectBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs.BlockDisconnected(undo)
+	if _, _, _, ok := txs.Tx(genesis.TxHash()); ok {
+		t.Error("expected the genesis to be removed with its block")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	genesisMsg, err := metadatamaker.CreateOpReturnGenesis(0x01, []byte("TST"), []byte("test"), nil, nil, 0, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := testTx(genesisMsg, []wire.OutPoint{{Index: 1}}, 1)
+	idx := tokenindex.New()
+	txs := NewStore()
+	block := testBlock(genesis)
+	results, err := idx.ConnectBlock(block, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs.BlockConnected(block, 0, results)
+
+	mempool := tokenindex.NewMempool(idx.Lookup)
+	pending := testTx([]byte{0x6a}, []wire.OutPoint{{Index: 2}}, 1)
+	if _, err := mempool.AddTx(pending); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &Lookup{Index: idx, Mempool: mempool, Txs: txs}
+	info, ok := l.Tx(genesis.TxHash())
+	if !ok || !info.Valid || info.Height != 0 || info.Header == nil {
+		t.Fatalf("unexpected confirmed tx %+v", info)
+	}
+	if outputs := info.TokenOutputs(); len(outputs) != 2 || outputs[1].Amount != 10 {
+		t.Errorf("unexpected token outputs %v", outputs)
+	}
+	if info, ok := l.Tx(pending.TxHash()); !ok || info.Height != -1 || info.Header != nil || info.TokenOutputs() != nil {
+		t.Errorf("unexpected unconfirmed tx %+v", info)
+	}
+	if _, ok := l.Tx(chainhash.Hash{1}); ok {
+		t.Error("expected an unknown tx to be missing")
+	}
+}
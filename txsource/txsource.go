@@ -0,0 +1,68 @@
+// Package txsource resolves the transactions the API servers describe, from
+// a mempool and a store of confirmed token transactions.
+package txsource
+
+import (
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp"
+	"github.com/simpleledgerinc/goslp/tokenindex"
+)
+
+// Source provides the confirmed transactions the servers describe
+type Source interface {
+	// Tx returns a confirmed transaction with the header and height of its
+	// block, ok is false for unknown transactions
+	Tx(hash chainhash.Hash) (tx *wire.MsgTx, header *wire.BlockHeader, height int32, ok bool)
+}
+
+// Info is a transaction with its block and SLP validity, Header is nil and
+// Height is -1 for unconfirmed transactions
+type Info struct {
+	Tx     *wire.MsgTx
+	Header *wire.BlockHeader
+	Height int32
+	Valid  bool
+}
+
+// TokenOutputs returns the token outputs of a valid transaction, nil
+// otherwise
+func (i *Info) TokenOutputs() []*goslp.TokenOutput {
+	if !i.Valid {
+		return nil
+	}
+	outputs, _, err := goslp.GetTokenOutputs(i.Tx)
+	if err != nil {
+		return nil
+	}
+	return outputs
+}
+
+// Lookup finds transactions in a mempool, then in the confirmed
+// transactions of a Source
+type Lookup struct {
+	Index *tokenindex.Index
+
+	// Mempool and Txs may be nil
+	Mempool *tokenindex.Mempool
+	Txs     Source
+}
+
+// Tx finds a transaction in the mempool, then in the confirmed
+// transactions
+func (l *Lookup) Tx(hash chainhash.Hash) (*Info, bool) {
+	if l.Mempool != nil {
+		if e := l.Mempool.Entry(hash); e != nil {
+			return &Info{Tx: e.Tx, Height: -1, Valid: e.Result.Valid}, true
+		}
+	}
+	if l.Txs == nil {
+		return nil, false
+	}
+	tx, header, height, ok := l.Txs.Tx(hash)
+	if !ok {
+		return nil, false
+	}
+	valid, _ := l.Index.TxValidity(hash)
+	return &Info{Tx: tx, Header: header, Height: height, Valid: valid}, true
+}
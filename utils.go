@@ -1,6 +1,7 @@
 package goslp
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 
@@ -59,6 +60,15 @@ func GetSlpTokenID(tx *wire.MsgTx) ([]byte, error) {
 	}
 }
 
+// slpLokadPrefix is OP_RETURN followed by a push of the SLP lokad id
+var slpLokadPrefix = []byte{0x6a, 0x04, 'S', 'L', 'P', 0x00}
+
+// HasSlpLokadPrefix returns true when pkScript starts with OP_RETURN and the
+// SLP lokad id. It is a cheap filter to run before v1parser.ParseSLP.
+func HasSlpLokadPrefix(pkScript []byte) bool {
+	return bytes.HasPrefix(pkScript, slpLokadPrefix)
+}
+
 func contains(s []int, e int) bool {
 	for _, a := range s {
 		if a == e {
@@ -28,3 +28,19 @@ func TestGetSlpTokenIDGenesis(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestHasSlpLokadPrefix(t *testing.T) {
+	slpMsg, err := hex.DecodeString("6a04534c500001010453454e4420")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !goslp.HasSlpLokadPrefix(slpMsg) {
+		t.Error("expected slp lokad prefix")
+	}
+	if goslp.HasSlpLokadPrefix([]byte{0x6a, 0x04, 'S', 'L', 'P'}) {
+		t.Error("truncated lokad id should not match")
+	}
+	if goslp.HasSlpLokadPrefix([]byte{0x76, 0xa9}) {
+		t.Error("p2pkh script should not match")
+	}
+}
@@ -3,6 +3,7 @@ package v1parser
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"math/big"
 )
 
@@ -16,6 +17,8 @@ const (
 	TokenTypeNft1Child41 TokenType = 0x41
 	// TokenTypeNft1Group81 version type used for ParseResult.TokenType
 	TokenTypeNft1Group81 TokenType = 0x81
+	// MaxSendOutputs is the maximum number of token outputs a SEND can assign
+	MaxSendOutputs = 19
 	// transactionTypeGenesis transaction type used during parsing
 	transactionTypeGenesis string = "GENESIS"
 	// transactionTypeMint transaction type used during parsing
@@ -570,8 +573,8 @@ func ParseSLP(scriptPubKey []byte) (ParseResult, error) {
 			return nil, errors.New("token_amounts size is 0")
 		}
 
-		if len(amounts) > 19 {
-			return nil, errors.New("token_amounts size is greater than 19")
+		if len(amounts) > MaxSendOutputs {
+			return nil, fmt.Errorf("token_amounts size is greater than %d", MaxSendOutputs)
 		}
 
 		return &SlpSend{
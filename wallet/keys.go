@@ -0,0 +1,275 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gcash/bchd/bchec"
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/txscript"
+	"github.com/gcash/bchd/wire"
+	"github.com/gcash/bchutil"
+	"github.com/gcash/bchutil/hdkeychain"
+	"github.com/simpleledgerinc/goslp/address"
+	"github.com/simpleledgerinc/goslp/txbuilder"
+)
+
+const (
+	// SlpCoinType is the BIP44 coin type used for SLP token addresses
+	SlpCoinType uint32 = 245
+
+	// BchCoinType is the BIP44 coin type used for BCH funds
+	BchCoinType uint32 = 145
+
+	// ExternalBranch is the BIP44 change level used for receiving addresses
+	ExternalBranch uint32 = 0
+
+	// InternalBranch is the BIP44 change level used for change addresses
+	InternalBranch uint32 = 1
+
+	// DefaultGapLimit is the number of consecutive unused addresses after
+	// which discovery stops
+	DefaultGapLimit = 20
+
+	purpose uint32 = 44
+)
+
+// ErrWatchOnly is returned when a private key is requested from an account
+// created from an extended public key
+var ErrWatchOnly = errors.New("account is watch-only")
+
+// Account is a BIP44 account, m/44'/coin'/account', from which receiving
+// and change addresses are derived.
+type Account struct {
+	key      *hdkeychain.ExtendedKey
+	params   *chaincfg.Params
+	coinType uint32
+	index    uint32
+	branches [2]*hdkeychain.ExtendedKey
+}
+
+// KeyPair is a derived address along with its keys. PrivKey is nil for
+// watch-only accounts.
+type KeyPair struct {
+	Branch  uint32
+	Index   uint32
+	Address *address.Address
+	PubKey  *bchec.PublicKey
+	PrivKey *bchec.PrivateKey
+}
+
+// PkScript returns the output script paying to the key pair's address
+func (k *KeyPair) PkScript() []byte {
+	return k.Address.PkScript()
+}
+
+// NewAccount derives account m/44'/coinType'/index' from a BIP32 seed
+func NewAccount(seed []byte, coinType, index uint32, params *chaincfg.Params) (*Account, error) {
+	master, err := hdkeychain.NewMaster(seed, params)
+	if err != nil {
+		return nil, err
+	}
+	key := master
+	for _, i := range []uint32{purpose, coinType, index} {
+		key, err = key.Child(hdkeychain.HardenedKeyStart + i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newAccount(key, coinType, index, params)
+}
+
+// NewAccountFromExtendedKey creates an account from a serialized account
+// level xprv or xpub. Accounts created from an xpub are watch-only.
+func NewAccountFromExtendedKey(key string, coinType, index uint32, params *chaincfg.Params) (*Account, error) {
+	k, err := hdkeychain.NewKeyFromString(key)
+	if err != nil {
+		return nil, err
+	}
+	if !k.IsForNet(params) {
+		return nil, errors.New("extended key is for a different network")
+	}
+	if k.Depth() != 3 {
+		return nil, fmt.Errorf("extended key depth is %d, expected account depth 3", k.Depth())
+	}
+	return newAccount(k, coinType, index, params)
+}
+
+func newAccount(key *hdkeychain.ExtendedKey, coinType, index uint32, params *chaincfg.Params) (*Account, error) {
+	a := &Account{key: key, params: params, coinType: coinType, index: index}
+	for _, branch := range []uint32{ExternalBranch, InternalBranch} {
+		k, err := key.Child(branch)
+		if err != nil {
+			return nil, err
+		}
+		a.branches[branch] = k
+	}
+	return a, nil
+}
+
+// CoinType returns the BIP44 coin type of the account
+func (a *Account) CoinType() uint32 {
+	return a.coinType
+}
+
+// Path returns the derivation path of a key in the account
+func (a *Account) Path(branch, index uint32) string {
+	return fmt.Sprintf("m/44'/%d'/%d'/%d/%d", a.coinType, a.index, branch, index)
+}
+
+// IsWatchOnly returns true when the account has no private keys
+func (a *Account) IsWatchOnly() bool {
+	return !a.key.IsPrivate()
+}
+
+// ExtendedPublicKey returns the serialized account xpub
+func (a *Account) ExtendedPublicKey() (string, error) {
+	pub, err := a.key.Neuter()
+	if err != nil {
+		return "", err
+	}
+	return pub.String(), nil
+}
+
+// Derive returns the key pair at branch/index of the account
+func (a *Account) Derive(branch, index uint32) (*KeyPair, error) {
+	if branch != ExternalBranch && branch != InternalBranch {
+		return nil, errors.New("branch must be external or internal")
+	}
+	if index >= hdkeychain.HardenedKeyStart {
+		return nil, errors.New("address index must not be hardened")
+	}
+	k, err := a.branches[branch].Child(index)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := k.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	addr, err := address.NewAddressPubKeyHash(bchutil.Hash160(pub.SerializeCompressed()), a.params)
+	if err != nil {
+		return nil, err
+	}
+	kp := &KeyPair{Branch: branch, Index: index, Address: addr, PubKey: pub}
+	if k.IsPrivate() {
+		if kp.PrivKey, err = k.ECPrivKey(); err != nil {
+			return nil, err
+		}
+	}
+	return kp, nil
+}
+
+// HistoryLookup reports whether an address has ever been used on chain
+type HistoryLookup interface {
+	HasHistory(addr *address.Address) (bool, error)
+}
+
+// Discovery is the result of scanning an account for used addresses
+type Discovery struct {
+	Used []*KeyPair
+
+	// Next is the first index after the last used address on each branch
+	Next [2]uint32
+}
+
+// Discover scans both branches of the account, stopping after gapLimit
+// consecutive unused addresses on each branch. A gapLimit of zero uses
+// DefaultGapLimit.
+func (a *Account) Discover(lookup HistoryLookup, gapLimit int) (*Discovery, error) {
+	if gapLimit <= 0 {
+		gapLimit = DefaultGapLimit
+	}
+	d := &Discovery{}
+	for _, branch := range []uint32{ExternalBranch, InternalBranch} {
+		gap := 0
+		for index := uint32(0); gap < gapLimit; index++ {
+			kp, err := a.Derive(branch, index)
+			if err != nil {
+				return nil, err
+			}
+			used, err := lookup.HasHistory(kp.Address)
+			if err != nil {
+				return nil, err
+			}
+			if !used {
+				gap++
+				continue
+			}
+			gap = 0
+			d.Used = append(d.Used, kp)
+			d.Next[branch] = index + 1
+		}
+	}
+	return d, nil
+}
+
+// Wallet holds the SLP and BCH accounts derived from a single seed
+type Wallet struct {
+	Slp *Account
+	Bch *Account
+}
+
+// NewWallet derives m/44'/245'/account' for tokens and m/44'/145'/account'
+// for BCH funds from seed.
+func NewWallet(seed []byte, account uint32, params *chaincfg.Params) (*Wallet, error) {
+	slp, err := NewAccount(seed, SlpCoinType, account, params)
+	if err != nil {
+		return nil, err
+	}
+	bch, err := NewAccount(seed, BchCoinType, account, params)
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{Slp: slp, Bch: bch}, nil
+}
+
+// KeyRing looks up signing keys by output script
+type KeyRing struct {
+	keys []*KeyPair
+}
+
+// NewKeyRing creates a KeyRing from key pairs with private keys
+func NewKeyRing(keys ...*KeyPair) *KeyRing {
+	return &KeyRing{keys: keys}
+}
+
+// Add adds key pairs to the ring
+func (r *KeyRing) Add(keys ...*KeyPair) {
+	r.keys = append(r.keys, keys...)
+}
+
+// Lookup returns the key pair paid to by pkScript
+func (r *KeyRing) Lookup(pkScript []byte) (*KeyPair, bool) {
+	for _, k := range r.keys {
+		if bytes.Equal(k.PkScript(), pkScript) {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// Sign signs every input of tx with the key paying to the spent output,
+// it satisfies txbuilder.SignFunc.
+func (r *KeyRing) Sign(tx *wire.MsgTx, inputs []*txbuilder.Utxo) error {
+	if len(inputs) != len(tx.TxIn) {
+		return errors.New("inputs do not match transaction inputs")
+	}
+	for i, in := range inputs {
+		k, ok := r.Lookup(in.PkScript)
+		if !ok {
+			return fmt.Errorf("no key for input %d", i)
+		}
+		if k.PrivKey == nil {
+			return ErrWatchOnly
+		}
+		sigScript, err := txscript.SignatureScript(tx, i, in.Value, in.PkScript,
+			txscript.SigHashAll|txscript.SigHashForkID, k.PrivKey, true)
+		if err != nil {
+			return err
+		}
+		tx.TxIn[i].SignatureScript = sigScript
+	}
+	return nil
+}
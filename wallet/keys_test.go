@@ -0,0 +1,152 @@
+package wallet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/txscript"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/address"
+	"github.com/simpleledgerinc/goslp/txbuilder"
+)
+
+var testSeed = bytes.Repeat([]byte{0x01}, 32)
+
+type testHistory map[string]bool
+
+func (h testHistory) HasHistory(addr *address.Address) (bool, error) {
+	return h[addr.String()], nil
+}
+
+func TestNewWallet(t *testing.T) {
+	w, err := NewWallet(testSeed, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slp, err := w.Slp.Derive(ExternalBranch, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bch, err := w.Bch.Derive(ExternalBranch, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slp.Address.String() == bch.Address.String() {
+		t.Error("slp and bch accounts derived the same address")
+	}
+	if w.Slp.Path(ExternalBranch, 0) != "m/44'/245'/0'/0/0" {
+		t.Errorf("unexpected path %s", w.Slp.Path(ExternalBranch, 0))
+	}
+	if slp.PrivKey == nil {
+		t.Error("expected private key")
+	}
+}
+
+func TestWatchOnlyAccount(t *testing.T) {
+	acct, err := NewAccount(testSeed, SlpCoinType, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := acct.ExtendedPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	watch, err := NewAccountFromExtendedKey(xpub, SlpCoinType, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !watch.IsWatchOnly() {
+		t.Error("expected watch-only account")
+	}
+
+	for i := uint32(0); i < 3; i++ {
+		a, _ := acct.Derive(InternalBranch, i)
+		b, err := watch.Derive(InternalBranch, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Address.String() != b.Address.String() || b.PrivKey != nil {
+			t.Errorf("watch-only derivation mismatch at %d", i)
+		}
+	}
+
+	if _, err := NewAccountFromExtendedKey(xpub, SlpCoinType, 0, &chaincfg.TestNet3Params); err == nil {
+		t.Error("expected network mismatch error")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	acct, err := NewAccount(testSeed, SlpCoinType, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := testHistory{}
+	for _, i := range []uint32{0, 4, 9} {
+		kp, _ := acct.Derive(ExternalBranch, i)
+		history[kp.Address.String()] = true
+	}
+	kp, _ := acct.Derive(InternalBranch, 1)
+	history[kp.Address.String()] = true
+
+	// index 20 is beyond the gap after index 9 with a gap limit of 5
+	kp, _ = acct.Derive(ExternalBranch, 20)
+	history[kp.Address.String()] = true
+
+	d, err := acct.Discover(history, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Used) != 4 {
+		t.Errorf("expected 4 used addresses, got %d", len(d.Used))
+	}
+	if d.Next[ExternalBranch] != 10 || d.Next[InternalBranch] != 2 {
+		t.Errorf("unexpected next indexes %v", d.Next)
+	}
+}
+
+func TestKeyRingSign(t *testing.T) {
+	acct, err := NewAccount(testSeed, SlpCoinType, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kp, err := acct.Derive(ExternalBranch, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utxo := &txbuilder.Utxo{
+		OutPoint:    wire.OutPoint{Hash: chainhash.Hash{1}, Index: 1},
+		Value:       10000,
+		PkScript:    kp.PkScript(),
+		TokenID:     make([]byte, 32),
+		TokenAmount: 100,
+	}
+	res, err := txbuilder.Burn(&txbuilder.BurnParams{
+		TokenType:      0x01,
+		TokenID:        make([]byte, 32),
+		TokenUtxos:     []*txbuilder.Utxo{utxo},
+		BurnAmount:     1,
+		ChangePkScript: kp.PkScript(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ring := NewKeyRing(kp)
+	if err := ring.Sign(res.Tx, res.Inputs); err != nil {
+		t.Fatal(err)
+	}
+	vm, err := txscript.NewEngine(utxo.PkScript, res.Tx, 0, txscript.StandardVerifyFlags, nil, nil, utxo.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewKeyRing().Sign(res.Tx, res.Inputs); err == nil {
+		t.Error("expected missing key error")
+	}
+}
@@ -0,0 +1,85 @@
+package wallet
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+)
+
+// Source provides blocks and unconfirmed transactions to a WatchOnly wallet
+type Source interface {
+	// BestHeight returns the height of the chain tip, or -1 for no blocks
+	BestHeight() (int32, error)
+
+	// BlockAtHeight returns the main chain block at height
+	BlockAtHeight(height int32) (*wire.MsgBlock, error)
+
+	// MempoolTxs returns unconfirmed transactions with parents before
+	// children
+	MempoolTxs() ([]*wire.MsgTx, error)
+}
+
+// MemorySource is an in-memory Source, the block at index 0 has height 0
+type MemorySource struct {
+	mtx     sync.RWMutex
+	blocks  []*wire.MsgBlock
+	mempool []*wire.MsgTx
+}
+
+// NewMemorySource creates an empty MemorySource
+func NewMemorySource() *MemorySource {
+	return &MemorySource{}
+}
+
+// AddBlock appends block to the chain, removing its transactions from the
+// mempool
+func (s *MemorySource) AddBlock(block *wire.MsgBlock) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	mined := make(map[chainhash.Hash]bool, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		mined[tx.TxHash()] = true
+	}
+	mempool := s.mempool[:0]
+	for _, tx := range s.mempool {
+		if !mined[tx.TxHash()] {
+			mempool = append(mempool, tx)
+		}
+	}
+	s.mempool = mempool
+	s.blocks = append(s.blocks, block)
+}
+
+// AddMempoolTx adds an unconfirmed transaction
+func (s *MemorySource) AddMempoolTx(tx *wire.MsgTx) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.mempool = append(s.mempool, tx)
+}
+
+// BestHeight implements Source
+func (s *MemorySource) BestHeight() (int32, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return int32(len(s.blocks)) - 1, nil
+}
+
+// BlockAtHeight implements Source
+func (s *MemorySource) BlockAtHeight(height int32) (*wire.MsgBlock, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if height < 0 || int(height) >= len(s.blocks) {
+		return nil, fmt.Errorf("no block at height %d", height)
+	}
+	return s.blocks[height], nil
+}
+
+// MempoolTxs implements Source
+func (s *MemorySource) MempoolTxs() ([]*wire.MsgTx, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return append([]*wire.MsgTx{}, s.mempool...), nil
+}
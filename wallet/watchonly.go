@@ -0,0 +1,428 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp"
+	"github.com/simpleledgerinc/goslp/address"
+	"github.com/simpleledgerinc/goslp/v1parser"
+)
+
+// ErrReorg is returned by Sync when the source chain no longer connects to
+// the last block processed by the wallet
+var ErrReorg = errors.New("source chain does not connect to wallet tip, rescan required")
+
+// ValidatorFunc reports whether an SLP transaction is valid. Token outputs
+// of invalid transactions are treated as plain BCH.
+type ValidatorFunc func(tx *wire.MsgTx) (bool, error)
+
+// Utxo is an unspent output paying to a watched address
+type Utxo struct {
+	OutPoint  wire.OutPoint
+	Value     int64
+	PkScript  []byte
+	Address   *address.Address
+	Token     *goslp.TokenOutput
+	Height    int32
+	Confirmed bool
+}
+
+// TokenBalance is the balance of a single token across watched addresses
+type TokenBalance struct {
+	TokenID   []byte
+	TokenType v1parser.TokenType
+
+	// Spendable is the confirmed amount not spent by unconfirmed txs
+	Spendable uint64
+
+	// Pending is the amount received in unconfirmed transactions
+	Pending uint64
+
+	// Batons are the mint batons owned by watched addresses
+	Batons []wire.OutPoint
+}
+
+type watchedScript struct {
+	addr    *address.Address
+	account *watchedAccount
+	branch  uint32
+	index   uint32
+}
+
+type watchedAccount struct {
+	acct *Account
+	gap  uint32
+	next [2]uint32
+}
+
+// WatchOnly tracks outputs paying to a set of addresses and accounts and
+// reports token and BCH balances without holding any private keys.
+type WatchOnly struct {
+	mtx       sync.RWMutex
+	params    *chaincfg.Params
+	scripts   map[string]*watchedScript
+	confirmed map[wire.OutPoint]*Utxo
+	pending   map[wire.OutPoint]*Utxo
+	spent     map[wire.OutPoint]bool
+	height    int32
+	tip       chainhash.Hash
+	validator ValidatorFunc
+
+	// derived holds the scripts watched since the processed blocks were
+	// last scanned for them, with the lowest height that can pay them.
+	// syncFrom is the first block processed by the current Sync.
+	derived  map[string]int32
+	syncFrom int32
+}
+
+// NewWatchOnly creates an empty watch-only wallet
+func NewWatchOnly(params *chaincfg.Params) *WatchOnly {
+	return &WatchOnly{
+		params:    params,
+		scripts:   make(map[string]*watchedScript),
+		confirmed: make(map[wire.OutPoint]*Utxo),
+		pending:   make(map[wire.OutPoint]*Utxo),
+		spent:     make(map[wire.OutPoint]bool),
+		height:    -1,
+		derived:   make(map[string]int32),
+	}
+}
+
+// SetValidator sets the SLP validity check applied to token transactions,
+// without one every parsable SLP message is trusted.
+func (w *WatchOnly) SetValidator(fn ValidatorFunc) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.validator = fn
+}
+
+// AddAddress watches a single address
+func (w *WatchOnly) AddAddress(addr *address.Address) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.scripts[string(addr.PkScript())] = &watchedScript{addr: addr}
+	w.watch(addr.PkScript(), 0)
+}
+
+// AddAccount watches both branches of an account, keeping gapLimit unused
+// addresses ahead of the last used address on each branch. Accounts are
+// normally created from an xpub with NewAccountFromExtendedKey.
+func (w *WatchOnly) AddAccount(acct *Account, gapLimit int) error {
+	if gapLimit <= 0 {
+		gapLimit = DefaultGapLimit
+	}
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	wa := &watchedAccount{acct: acct, gap: uint32(gapLimit)}
+	for _, branch := range []uint32{ExternalBranch, InternalBranch} {
+		if err := w.extend(wa, branch, 0, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extend derives addresses on branch until gap addresses follow used, the
+// new addresses are looked for in the processed blocks from height from.
+func (w *WatchOnly) extend(wa *watchedAccount, branch, used uint32, from int32) error {
+	for ; wa.next[branch] < used+wa.gap; wa.next[branch]++ {
+		kp, err := wa.acct.Derive(branch, wa.next[branch])
+		if err != nil {
+			return err
+		}
+		w.scripts[string(kp.PkScript())] = &watchedScript{
+			addr:    kp.Address,
+			account: wa,
+			branch:  branch,
+			index:   wa.next[branch],
+		}
+		w.watch(kp.PkScript(), from)
+	}
+	return nil
+}
+
+// watch marks pkScript to be looked for in the processed blocks from
+// height from on
+func (w *WatchOnly) watch(pkScript []byte, from int32) {
+	if h, ok := w.derived[string(pkScript)]; !ok || from < h {
+		w.derived[string(pkScript)] = from
+	}
+}
+
+// Height returns the height of the last block processed
+func (w *WatchOnly) Height() int32 {
+	w.mtx.RLock()
+	defer w.mtx.RUnlock()
+	return w.height
+}
+
+// Sync processes blocks from the source up to its best height, then
+// replaces the unconfirmed state with the source mempool. Addresses added
+// since the last Sync are looked for in every processed block. Addresses
+// derived while extending the gap limit may have been paid in the blocks
+// processed by the same Sync, so those blocks are scanned again for them
+// until no further addresses are derived.
+func (w *WatchOnly) Sync(src Source) error {
+	best, err := src.BestHeight()
+	if err != nil {
+		return err
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	// addresses added since the last Sync are looked for in the blocks
+	// processed then, before the new blocks are processed for every
+	// address
+	w.syncFrom = w.height + 1
+	if err := w.rescan(src); err != nil {
+		return err
+	}
+	for h := w.height + 1; h <= best; h++ {
+		block, err := src.BlockAtHeight(h)
+		if err != nil {
+			return err
+		}
+		if w.height >= 0 && block.Header.PrevBlock != w.tip {
+			return ErrReorg
+		}
+		for _, tx := range block.Transactions {
+			if err := w.processTx(tx, h, true, nil); err != nil {
+				return err
+			}
+		}
+		w.height = h
+		w.tip = block.BlockHash()
+	}
+
+	mempool, err := src.MempoolTxs()
+	if err != nil {
+		return err
+	}
+	for {
+		if err := w.rescan(src); err != nil {
+			return err
+		}
+		w.pending = make(map[wire.OutPoint]*Utxo)
+		w.spent = make(map[wire.OutPoint]bool)
+		for _, tx := range mempool {
+			if err := w.processTx(tx, -1, false, nil); err != nil {
+				return err
+			}
+		}
+		if len(w.derived) == 0 {
+			return nil
+		}
+	}
+}
+
+// rescan scans the processed blocks again for outputs paying the derived
+// scripts, from the lowest height that can pay them, repeating while the
+// outputs found derive more. Spends are replayed as well, they can only
+// remove outputs added by the rescan since every other stored output is
+// unspent at the tip.
+func (w *WatchOnly) rescan(src Source) error {
+	for len(w.derived) > 0 {
+		only := w.derived
+		w.derived = make(map[string]int32)
+		from := w.height + 1
+		for _, h := range only {
+			if h < from {
+				from = h
+			}
+		}
+		if from > w.height {
+			continue
+		}
+		var prev chainhash.Hash
+		for h := from; h <= w.height; h++ {
+			block, err := src.BlockAtHeight(h)
+			if err != nil {
+				return err
+			}
+			if h > from && block.Header.PrevBlock != prev {
+				return ErrReorg
+			}
+			prev = block.BlockHash()
+			for _, tx := range block.Transactions {
+				if err := w.processTx(tx, h, true, only); err != nil {
+					return err
+				}
+			}
+		}
+		if prev != w.tip {
+			return ErrReorg
+		}
+	}
+	return nil
+}
+
+// processTx removes outputs spent by tx and adds outputs paying to watched
+// scripts, or when only is not nil only to its scripts at or above their
+// height.
+func (w *WatchOnly) processTx(tx *wire.MsgTx, height int32, confirmed bool, only map[string]int32) error {
+	for _, in := range tx.TxIn {
+		op := in.PreviousOutPoint
+		if confirmed {
+			delete(w.confirmed, op)
+			continue
+		}
+		if _, ok := w.pending[op]; ok {
+			delete(w.pending, op)
+			continue
+		}
+		if _, ok := w.confirmed[op]; ok {
+			w.spent[op] = true
+		}
+	}
+
+	var tokens []*goslp.TokenOutput
+	txHash := tx.TxHash()
+	for vout, out := range tx.TxOut {
+		ws, ok := w.scripts[string(out.PkScript)]
+		if !ok {
+			continue
+		}
+		// addresses derived from a payment can be paid as early as the
+		// blocks the payment was looked for in
+		from := w.syncFrom
+		if only != nil {
+			var ok bool
+			if from, ok = only[string(out.PkScript)]; !ok || height < from {
+				continue
+			}
+		}
+
+		// classify lazily since most transactions pay no watched script
+		if tokens == nil {
+			var err error
+			tokens, err = w.classify(tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		u := &Utxo{
+			OutPoint:  wire.OutPoint{Hash: txHash, Index: uint32(vout)},
+			Value:     out.Value,
+			PkScript:  out.PkScript,
+			Address:   ws.addr,
+			Token:     tokens[vout],
+			Height:    height,
+			Confirmed: confirmed,
+		}
+		if confirmed {
+			w.confirmed[u.OutPoint] = u
+		} else {
+			w.pending[u.OutPoint] = u
+		}
+
+		if ws.account != nil {
+			if err := w.extend(ws.account, ws.branch, ws.index+1, from); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *WatchOnly) classify(tx *wire.MsgTx) ([]*goslp.TokenOutput, error) {
+	tokens, slpMsg, err := goslp.GetTokenOutputs(tx)
+	if err != nil {
+		// an SLP message without a resolvable token id carries no tokens
+		return make([]*goslp.TokenOutput, len(tx.TxOut)), nil
+	}
+	if slpMsg != nil && w.validator != nil {
+		valid, err := w.validator(tx)
+		if err != nil {
+			return nil, err
+		}
+		if !valid {
+			return make([]*goslp.TokenOutput, len(tx.TxOut)), nil
+		}
+	}
+	return tokens, nil
+}
+
+// Utxos returns all unspent outputs, confirmed outputs spent by unconfirmed
+// transactions are excluded
+func (w *WatchOnly) Utxos() []*Utxo {
+	w.mtx.RLock()
+	defer w.mtx.RUnlock()
+
+	utxos := make([]*Utxo, 0, len(w.confirmed)+len(w.pending))
+	for op, u := range w.confirmed {
+		if !w.spent[op] {
+			utxos = append(utxos, u)
+		}
+	}
+	for _, u := range w.pending {
+		utxos = append(utxos, u)
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		a, b := utxos[i].OutPoint, utxos[j].OutPoint
+		if a.Hash != b.Hash {
+			return a.Hash.String() < b.Hash.String()
+		}
+		return a.Index < b.Index
+	})
+	return utxos
+}
+
+// TokenBalances returns the balance of every token held, ordered by token id
+func (w *WatchOnly) TokenBalances() []*TokenBalance {
+	balances := make(map[string]*TokenBalance)
+	for _, u := range w.Utxos() {
+		if u.Token == nil {
+			continue
+		}
+		key := hex.EncodeToString(u.Token.TokenID)
+		b, ok := balances[key]
+		if !ok {
+			b = &TokenBalance{TokenID: u.Token.TokenID, TokenType: u.Token.TokenType}
+			balances[key] = b
+		}
+		switch {
+		case u.Token.IsMintBaton:
+			b.Batons = append(b.Batons, u.OutPoint)
+		case u.Confirmed:
+			b.Spendable += u.Token.Amount
+		default:
+			b.Pending += u.Token.Amount
+		}
+	}
+
+	keys := make([]string, 0, len(balances))
+	for k := range balances {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := make([]*TokenBalance, len(keys))
+	for i, k := range keys {
+		res[i] = balances[k]
+	}
+	return res
+}
+
+// BchBalance returns the spendable and pending value of outputs without
+// tokens. Token outputs are excluded so their dust is never spent as fee.
+func (w *WatchOnly) BchBalance() (spendable, pending int64) {
+	for _, u := range w.Utxos() {
+		if u.Token != nil {
+			continue
+		}
+		if u.Confirmed {
+			spendable += u.Value
+		} else {
+			pending += u.Value
+		}
+	}
+	return spendable, pending
+}
@@ -0,0 +1,256 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/simpleledgerinc/goslp/metadatamaker"
+)
+
+func testTx(slpMsg []byte, spends []wire.OutPoint, outputs ...[]byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	for i := range spends {
+		tx.AddTxIn(wire.NewTxIn(&spends[i], nil))
+	}
+	if slpMsg != nil {
+		tx.AddTxOut(wire.NewTxOut(0, slpMsg))
+	}
+	for _, pkScript := range outputs {
+		tx.AddTxOut(wire.NewTxOut(546, pkScript))
+	}
+	return tx
+}
+
+func testBlock(src *MemorySource, txs ...*wire.MsgTx) *wire.MsgBlock {
+	var prev chainhash.Hash
+	if h, _ := src.BestHeight(); h >= 0 {
+		b, _ := src.BlockAtHeight(h)
+		prev = b.BlockHash()
+	}
+	block := wire.NewMsgBlock(wire.NewBlockHeader(1, &prev, &chainhash.Hash{}, 0, 0))
+	for _, tx := range txs {
+		block.AddTransaction(tx)
+	}
+	src.AddBlock(block)
+	return block
+}
+
+func TestWatchOnlySync(t *testing.T) {
+	acct, err := NewAccount(testSeed, SlpCoinType, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, _ := acct.ExtendedPublicKey()
+	watch, err := NewAccountFromExtendedKey(xpub, SlpCoinType, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := func(i uint32) []byte {
+		kp, _ := acct.Derive(ExternalBranch, i)
+		return kp.PkScript()
+	}
+	external := []byte{0x51}
+
+	w := NewWatchOnly(&chaincfg.MainNetParams)
+	if err := w.AddAccount(watch, 3); err != nil {
+		t.Fatal(err)
+	}
+	src := NewMemorySource()
+
+	funding := testTx(nil, []wire.OutPoint{{Index: 1}}, addr(0))
+	genesisMsg, err := metadatamaker.TokenType1Genesis([]byte("T"), []byte("test"), nil, nil, 0,
+		metadatamaker.NewMintBatonVout(2), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := testTx(genesisMsg, []wire.OutPoint{{Index: 2}}, addr(0), addr(2))
+	testBlock(src, funding, genesis)
+
+	tokenID := genesis.TxHash()
+	tokenIDBytes := make([]byte, 32)
+	for i := range tokenIDBytes {
+		tokenIDBytes[i] = tokenID[31-i]
+	}
+
+	// address 5 is only watched once address 2 is seen as used
+	sendMsg, err := metadatamaker.TokenType1Send(tokenIDBytes, []uint64{300, 700})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := testTx(sendMsg, []wire.OutPoint{{Hash: tokenID, Index: 1}}, addr(5), external)
+	testBlock(src, send)
+
+	sendMsg, err = metadatamaker.TokenType1Send(tokenIDBytes, []uint64{100, 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unconfirmed := testTx(sendMsg, []wire.OutPoint{{Hash: send.TxHash(), Index: 1}}, addr(1), external)
+	src.AddMempoolTx(unconfirmed)
+
+	if err := w.Sync(src); err != nil {
+		t.Fatal(err)
+	}
+	if w.Height() != 1 {
+		t.Errorf("expected height 1, got %d", w.Height())
+	}
+
+	balances := w.TokenBalances()
+	if len(balances) != 1 {
+		t.Fatalf("expected 1 token balance, got %d", len(balances))
+	}
+	b := balances[0]
+	if b.Spendable != 0 || b.Pending != 100 {
+		t.Errorf("unexpected spendable %d pending %d", b.Spendable, b.Pending)
+	}
+	if len(b.Batons) != 1 || b.Batons[0].Index != 2 {
+		t.Errorf("expected baton at genesis vout 2, got %v", b.Batons)
+	}
+	if spendable, pending := w.BchBalance(); spendable != 546 || pending != 0 {
+		t.Errorf("unexpected bch balance %d, %d", spendable, pending)
+	}
+
+	// confirming the mempool tx makes its tokens spendable
+	testBlock(src, unconfirmed)
+	if err := w.Sync(src); err != nil {
+		t.Fatal(err)
+	}
+	b = w.TokenBalances()[0]
+	if b.Spendable != 100 || b.Pending != 0 {
+		t.Errorf("unexpected spendable %d pending %d", b.Spendable, b.Pending)
+	}
+}
+
+func TestWatchOnlyGapRescan(t *testing.T) {
+	acct, err := NewAccount(testSeed, SlpCoinType, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := func(i uint32) []byte {
+		kp, _ := acct.Derive(ExternalBranch, i)
+		return kp.PkScript()
+	}
+	const gap = 2
+	w := NewWatchOnly(&chaincfg.MainNetParams)
+	if err := w.AddAccount(acct, gap); err != nil {
+		t.Fatal(err)
+	}
+
+	// address gap+1 is paid before address gap-1 is used, which derives
+	// it, both in one sync and across syncs
+	src := NewMemorySource()
+	testBlock(src, testTx(nil, []wire.OutPoint{{Index: 1}}, addr(gap+1)))
+	testBlock(src, testTx(nil, []wire.OutPoint{{Index: 2}}, addr(gap-1)))
+	if err := w.Sync(src); err != nil {
+		t.Fatal(err)
+	}
+	if spendable, _ := w.BchBalance(); spendable != 2*546 {
+		t.Errorf("expected both payments, got %d", spendable)
+	}
+
+	testBlock(src, testTx(nil, []wire.OutPoint{{Index: 3}}, addr(2*gap+3)))
+	testBlock(src, testTx(nil, []wire.OutPoint{{Index: 4}}, addr(gap+3)))
+	if err := w.Sync(src); err != nil {
+		t.Fatal(err)
+	}
+	if spendable, _ := w.BchBalance(); spendable != 4*546 {
+		t.Errorf("expected four payments, got %d", spendable)
+	}
+}
+
+func TestWatchOnlyValidator(t *testing.T) {
+	kp, _ := NewAccount(testSeed, SlpCoinType, 0, &chaincfg.MainNetParams)
+	a, _ := kp.Derive(ExternalBranch, 0)
+
+	w := NewWatchOnly(&chaincfg.MainNetParams)
+	w.AddAddress(a.Address)
+	w.SetValidator(func(tx *wire.MsgTx) (bool, error) {
+		return false, nil
+	})
+
+	sendMsg, _ := metadatamaker.TokenType1Send(make([]byte, 32), []uint64{5})
+	src := NewMemorySource()
+	testBlock(src, testTx(sendMsg, []wire.OutPoint{{Index: 3}}, a.PkScript()))
+	if err := w.Sync(src); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.TokenBalances()) != 0 {
+		t.Error("invalid slp transaction was counted as tokens")
+	}
+	if spendable, _ := w.BchBalance(); spendable != 546 {
+		t.Errorf("expected invalid token output as bch, got %d", spendable)
+	}
+}
+
+func TestWatchOnlyReorg(t *testing.T) {
+	w := NewWatchOnly(&chaincfg.MainNetParams)
+	src := NewMemorySource()
+	testBlock(src)
+	if err := w.Sync(src); err != nil {
+		t.Fatal(err)
+	}
+
+	other := NewMemorySource()
+	testBlock(other)
+	other.blocks[0].Header.Nonce = 1
+	testBlock(other)
+	if err := w.Sync(other); err != ErrReorg {
+		t.Fatalf("expected ErrReorg, got %v", err)
+	}
+}
+
+// countingSource counts the blocks read from a MemorySource
+type countingSource struct {
+	*MemorySource
+	reads int
+}
+
+func (s *countingSource) BlockAtHeight(height int32) (*wire.MsgBlock, error) {
+	s.reads++
+	return s.MemorySource.BlockAtHeight(height)
+}
+
+func TestWatchOnlyRescanRange(t *testing.T) {
+	acct, err := NewAccount(testSeed, SlpCoinType, 0, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatchOnly(&chaincfg.MainNetParams)
+	if err := w.AddAccount(acct, 2); err != nil {
+		t.Fatal(err)
+	}
+	src := &countingSource{MemorySource: NewMemorySource()}
+	for i := 0; i < 5; i++ {
+		testBlock(src.MemorySource)
+	}
+	if err := w.Sync(src); err != nil {
+		t.Fatal(err)
+	}
+	if src.reads != 5 {
+		t.Fatalf("expected 5 block reads, got %d", src.reads)
+	}
+
+	// a payment derives an address, only the block of this sync is
+	// scanned again for it
+	kp, _ := acct.Derive(ExternalBranch, 0)
+	testBlock(src.MemorySource, testTx(nil, []wire.OutPoint{{Index: 1}}, kp.PkScript()))
+	src.reads = 0
+	if err := w.Sync(src); err != nil {
+		t.Fatal(err)
+	}
+	if src.reads != 2 {
+		t.Errorf("expected 2 block reads, got %d", src.reads)
+	}
+
+	// an added address is looked for in every processed block
+	other, _ := acct.Derive(InternalBranch, 10)
+	w.AddAddress(other.Address)
+	src.reads = 0
+	if err := w.Sync(src); err != nil {
+		t.Fatal(err)
+	}
+	if src.reads != 6 {
+		t.Errorf("expected 6 block reads, got %d", src.reads)
+	}
+}